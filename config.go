@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/marceloalmeida/tfpp/packager"
+)
+
+// fileConfig is the declarative configuration file passed with -c or TFPP_CONFIG. JSON is
+// used for files with a .json extension and YAML otherwise.
+type fileConfig struct {
+	Domain   string `yaml:"domain" json:"domain"`
+	Dist     string `yaml:"dist" json:"dist"`
+	Output   string `yaml:"output" json:"output"`
+	AllowNew bool   `yaml:"allow_new" json:"allow_new"`
+
+	// Incremental merges into an existing output tree instead of recreating it.
+	Incremental bool `yaml:"incremental" json:"incremental"`
+
+	// LinkMode is how zips are placed into the output trees, see packager.LinkMode.
+	LinkMode string `yaml:"link_mode" json:"link_mode"`
+
+	// Jobs is the number of zips copied, hashed and published concurrently.
+	Jobs int `yaml:"jobs" json:"jobs"`
+
+	// NetworkMirror and NetworkMirrorURL are the output directory and published base URL of the
+	// Provider Network Mirror Protocol tree.
+	NetworkMirror    string `yaml:"network_mirror" json:"network_mirror"`
+	NetworkMirrorURL string `yaml:"network_mirror_url" json:"network_mirror_url"`
+
+	// FSMirror and FSLayout are the output directory and layout of the filesystem mirror tree.
+	FSMirror string `yaml:"fs_mirror" json:"fs_mirror"`
+	FSLayout string `yaml:"fs_layout" json:"fs_layout"`
+
+	// Platforms, ExcludePlatforms and RequiredPlatforms filter the published platforms and fail
+	// the run when a required one is not published, see packager.Config.
+	Platforms         []string `yaml:"platforms" json:"platforms"`
+	ExcludePlatforms  []string `yaml:"exclude_platforms" json:"exclude_platforms"`
+	RequiredPlatforms []string `yaml:"required_platforms" json:"required_platforms"`
+
+	// Login is published as the login.v1 service of the well-known file, TokenFile restricts
+	// "tfpp serve" to the tokens it lists.
+	Login     *loginConfig `yaml:"login" json:"login"`
+	TokenFile string       `yaml:"token_file" json:"token_file"`
+
+	Key        string                     `yaml:"key" json:"key"`
+	KeySet     []string                   `yaml:"key_set" json:"key_set"`
+	Keys       map[string]keyConfig       `yaml:"keys" json:"keys"`
+	Namespaces map[string]namespaceConfig `yaml:"namespaces" json:"namespaces"`
+}
+
+// loginConfig is the OAuth 2.0 client configuration of "terraform login", see packager.LoginV1.
+type loginConfig struct {
+	Client     string   `yaml:"client" json:"client"`
+	GrantTypes []string `yaml:"grant_types" json:"grant_types"`
+	Authz      string   `yaml:"authz" json:"authz"`
+	Token      string   `yaml:"token" json:"token"`
+	Ports      []int    `yaml:"ports" json:"ports"`
+}
+
+// keyConfig is a named GPG key, referenced by "key" and "key_set" at the top level, in a
+// namespace or in a provider. The most specific reference wins. "key" is the key that signs
+// the SHA256SUMS, "key_set" the other keys published in platform documents, e.g. during a
+// key rotation.
+type keyConfig struct {
+	Fingerprint        string `yaml:"fingerprint" json:"fingerprint"`
+	PublicKeyFile      string `yaml:"public_key_file" json:"public_key_file"`
+	PrivateKeyFile     string `yaml:"private_key_file" json:"private_key_file"`
+	TrustSignatureFile string `yaml:"trust_signature_file" json:"trust_signature_file"`
+	Source             string `yaml:"source" json:"source"`
+	SourceURL          string `yaml:"source_url" json:"source_url"`
+}
+
+// signingKey converts k into a packager signing key.
+func (k keyConfig) signingKey() packager.SigningKey {
+	return packager.SigningKey{
+		KeyID:              k.Fingerprint,
+		PublicKeyFile:      k.PublicKeyFile,
+		TrustSignatureFile: k.TrustSignatureFile,
+		Source:             k.Source,
+		SourceURL:          k.SourceURL,
+	}
+}
+
+type namespaceConfig struct {
+	Key       string                    `yaml:"key" json:"key"`
+	KeySet    []string                  `yaml:"key_set" json:"key_set"`
+	Providers map[string]providerConfig `yaml:"providers" json:"providers"`
+}
+
+// providerConfig describes a provider type. Repo defaults to terraform-provider-<type>.
+type providerConfig struct {
+	Repo      string   `yaml:"repo" json:"repo"`
+	Dist      string   `yaml:"dist" json:"dist"`
+	Key       string   `yaml:"key" json:"key"`
+	KeySet    []string `yaml:"key_set" json:"key_set"`
+	Protocols []string `yaml:"protocols" json:"protocols"`
+
+	// Platforms, ExcludePlatforms and RequiredPlatforms override the top-level values.
+	Platforms         []string `yaml:"platforms" json:"platforms"`
+	ExcludePlatforms  []string `yaml:"exclude_platforms" json:"exclude_platforms"`
+	RequiredPlatforms []string `yaml:"required_platforms" json:"required_platforms"`
+}
+
+// settings are the inputs of the packaging commands. They are resolved from the config file,
+// environment variables and flags, each overriding the non-empty values of the previous one.
+type settings struct {
+	Config           string
+	Domain           string
+	Namespace        string
+	Provider         string
+	Repo             string
+	Version          string
+	Dist             string
+	Output           string
+	GPGFingerprint   string
+	GPGKeyFile       string
+	GPGPrivateKey    string
+	Protocols        string
+	NetworkMirror    string
+	NetworkMirrorURL string
+	FSMirror         string
+	FSLayout         string
+	LinkMode         string
+	TokenFile        string
+	AllowNew         *bool
+	Incremental      *bool
+
+	// Jobs is the number of zips processed concurrently, zero when unset.
+	Jobs int
+
+	// Platforms, ExcludePlatforms and RequiredPlatforms are comma-separated <os>_<arch> lists.
+	Platforms         string
+	ExcludePlatforms  string
+	RequiredPlatforms string
+
+	// ModuleName, ModuleSystem, ModuleSource and ModuleGitRef select the module packaged by
+	// "tfpp module".
+	ModuleName   string
+	ModuleSystem string
+	ModuleSource string
+	ModuleGitRef string
+
+	// Login is read from the config file only.
+	Login *packager.LoginV1
+
+	// SigningKey and KeySet are read from the config file only. SigningKey holds the trust
+	// signature and source of the GPGFingerprint key, KeySet the other published keys.
+	SigningKey packager.SigningKey
+	KeySet     []packager.SigningKey
+}
+
+// settingsEnv maps environment variables onto the string fields of settings.
+var settingsEnv = []struct {
+	name  string
+	field func(*settings) *string
+}{
+	{"TFPP_CONFIG", func(s *settings) *string { return &s.Config }},
+	{"TFPP_DOMAIN", func(s *settings) *string { return &s.Domain }},
+	{"TFPP_NAMESPACE", func(s *settings) *string { return &s.Namespace }},
+	{"TFPP_PROVIDER", func(s *settings) *string { return &s.Provider }},
+	{"TFPP_REPO", func(s *settings) *string { return &s.Repo }},
+	{"TFPP_VERSION", func(s *settings) *string { return &s.Version }},
+	{"TFPP_DIST", func(s *settings) *string { return &s.Dist }},
+	{"TFPP_OUTPUT", func(s *settings) *string { return &s.Output }},
+	{"TFPP_GPG_FINGERPRINT", func(s *settings) *string { return &s.GPGFingerprint }},
+	{"TFPP_GPG_KEY_FILE", func(s *settings) *string { return &s.GPGKeyFile }},
+	{"TFPP_GPG_PRIVATE_KEY_FILE", func(s *settings) *string { return &s.GPGPrivateKey }},
+	{"TFPP_PROTOCOLS", func(s *settings) *string { return &s.Protocols }},
+	{"TFPP_PLATFORMS", func(s *settings) *string { return &s.Platforms }},
+	{"TFPP_EXCLUDE_PLATFORMS", func(s *settings) *string { return &s.ExcludePlatforms }},
+	{"TFPP_REQUIRED_PLATFORMS", func(s *settings) *string { return &s.RequiredPlatforms }},
+	{"TFPP_NETWORK_MIRROR", func(s *settings) *string { return &s.NetworkMirror }},
+	{"TFPP_NETWORK_MIRROR_URL", func(s *settings) *string { return &s.NetworkMirrorURL }},
+	{"TFPP_FS_MIRROR", func(s *settings) *string { return &s.FSMirror }},
+	{"TFPP_FS_LAYOUT", func(s *settings) *string { return &s.FSLayout }},
+	{"TFPP_LINK_MODE", func(s *settings) *string { return &s.LinkMode }},
+	{"TFPP_TOKEN_FILE", func(s *settings) *string { return &s.TokenFile }},
+	{"TFPP_MODULE_NAME", func(s *settings) *string { return &s.ModuleName }},
+	{"TFPP_MODULE_SYSTEM", func(s *settings) *string { return &s.ModuleSystem }},
+	{"TFPP_MODULE_SOURCE", func(s *settings) *string { return &s.ModuleSource }},
+	{"TFPP_MODULE_GIT_REF", func(s *settings) *string { return &s.ModuleGitRef }},
+}
+
+// settingsBoolEnv maps environment variables onto the boolean fields of settings, which are nil
+// when unset.
+var settingsBoolEnv = []struct {
+	name  string
+	field func(*settings) **bool
+}{
+	{"TFPP_ALLOW_NEW", func(s *settings) **bool { return &s.AllowNew }},
+	{"TFPP_INCREMENTAL", func(s *settings) **bool { return &s.Incremental }},
+}
+
+// settingsFromEnv reads the TFPP_* environment variables.
+func settingsFromEnv() (settings, error) {
+	var s settings
+	for _, env := range settingsEnv {
+		*env.field(&s) = os.Getenv(env.name)
+	}
+
+	for _, env := range settingsBoolEnv {
+		value := os.Getenv(env.name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return s, fmt.Errorf("invalid %s: %w", env.name, err)
+		}
+		*env.field(&s) = &b
+	}
+
+	if value := os.Getenv("TFPP_JOBS"); value != "" {
+		jobs, err := strconv.Atoi(value)
+		if err != nil {
+			return s, fmt.Errorf("invalid TFPP_JOBS: %w", err)
+		}
+		s.Jobs = jobs
+	}
+
+	return s, nil
+}
+
+// merge overrides s with the non-empty values of other.
+func (s *settings) merge(other settings) {
+	for _, env := range settingsEnv {
+		if value := *env.field(&other); value != "" {
+			*env.field(s) = value
+		}
+	}
+	for _, env := range settingsBoolEnv {
+		if value := *env.field(&other); value != nil {
+			*env.field(s) = value
+		}
+	}
+	if other.Jobs != 0 {
+		s.Jobs = other.Jobs
+	}
+	if other.Login != nil {
+		s.Login = other.Login
+	}
+	if other.SigningKey != (packager.SigningKey{}) {
+		s.SigningKey = other.SigningKey
+	}
+	if other.KeySet != nil {
+		s.KeySet = other.KeySet
+	}
+}
+
+// packagerConfig converts the resolved settings into a packager configuration.
+func (s settings) packagerConfig() (packager.Config, []packager.Option) {
+	cfg := packager.Config{
+		Namespace:              s.Namespace,
+		Domain:                 s.Domain,
+		Provider:               s.Provider,
+		DistPath:               s.Dist,
+		OutputDir:              s.Output,
+		RepoName:               s.Repo,
+		Version:                s.Version,
+		GPGFingerprint:         s.GPGFingerprint,
+		GPGPubKeyFile:          s.GPGKeyFile,
+		GPGPrivateKeyFile:      s.GPGPrivateKey,
+		NetworkMirrorDir:       s.NetworkMirror,
+		NetworkMirrorURL:       s.NetworkMirrorURL,
+		FilesystemMirrorDir:    s.FSMirror,
+		FilesystemMirrorLayout: packager.FilesystemMirrorLayout(s.FSLayout),
+		LinkMode:               packager.LinkMode(s.LinkMode),
+		Incremental:            s.Incremental != nil && *s.Incremental,
+		Jobs:                   s.Jobs,
+		Login:                  s.Login,
+	}
+	cfg.Protocols = splitList(s.Protocols)
+	cfg.Platforms = splitList(s.Platforms)
+	cfg.ExcludePlatforms = splitList(s.ExcludePlatforms)
+	cfg.RequiredPlatforms = splitList(s.RequiredPlatforms)
+
+	// The signing key comes first, its fingerprint and public key file may be overridden by the
+	// environment and flags.
+	if s.SigningKey != (packager.SigningKey{}) || len(s.KeySet) > 0 {
+		signingKey := s.SigningKey
+		signingKey.KeyID = s.GPGFingerprint
+		signingKey.PublicKeyFile = s.GPGKeyFile
+		cfg.SigningKeys = append([]packager.SigningKey{signingKey}, s.KeySet...)
+	}
+
+	var opts []packager.Option
+	if s.AllowNew != nil {
+		opts = append(opts, packager.WithAllowNew(*s.AllowNew))
+	}
+
+	return cfg, opts
+}
+
+// splitList returns the trimmed values of a comma-separated list, nil when it is empty.
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+
+	return values
+}
+
+// moduleConfig converts the resolved settings into a module packager configuration.
+func (s settings) moduleConfig() (packager.ModuleConfig, []packager.Option) {
+	cfg := packager.ModuleConfig{
+		Namespace:   s.Namespace,
+		Domain:      s.Domain,
+		Name:        s.ModuleName,
+		System:      s.ModuleSystem,
+		Version:     s.Version,
+		SourceDir:   s.ModuleSource,
+		GitRef:      s.ModuleGitRef,
+		OutputDir:   s.Output,
+		Incremental: s.Incremental != nil && *s.Incremental,
+		Login:       s.Login,
+	}
+
+	var opts []packager.Option
+	if s.AllowNew != nil {
+		opts = append(opts, packager.WithAllowNew(*s.AllowNew))
+	}
+
+	return cfg, opts
+}
+
+// resolveSettings applies the documented precedence: flags, then environment variables, then
+// the config file. The namespace and provider used to select an entry of the config file are
+// taken from the flags and environment only.
+func resolveSettings(flagSettings settings) (settings, error) {
+	return resolve(flagSettings, func(file fileConfig, selector settings) (settings, error) {
+		return file.settings(selector.Namespace, selector.Provider)
+	})
+}
+
+// resolveModuleSettings is resolveSettings for "tfpp module", which only reads the top-level
+// values of the config file.
+func resolveModuleSettings(flagSettings settings) (settings, error) {
+	return resolve(flagSettings, func(file fileConfig, _ settings) (settings, error) {
+		return file.globalSettings(), nil
+	})
+}
+
+// resolve merges the config file values returned by fromFile, the environment and flagSettings.
+func resolve(flagSettings settings, fromFile func(fileConfig, settings) (settings, error)) (settings, error) {
+	env, err := settingsFromEnv()
+	if err != nil {
+		return settings{}, err
+	}
+
+	var selector settings
+	selector.merge(env)
+	selector.merge(flagSettings)
+
+	var resolved settings
+	if selector.Config != "" {
+		file, err := loadConfigFile(selector.Config)
+		if err != nil {
+			return settings{}, err
+		}
+		resolved, err = fromFile(file, selector)
+		if err != nil {
+			return settings{}, fmt.Errorf("config file %s: %w", selector.Config, err)
+		}
+	}
+
+	resolved.merge(env)
+	resolved.merge(flagSettings)
+
+	return resolved, nil
+}
+
+// loadConfigFile reads and strictly decodes a YAML or JSON config file.
+func loadConfigFile(path string) (fileConfig, error) {
+	var cfg fileConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// globalSettings returns the top-level settings of the file, shared by all providers.
+func (f fileConfig) globalSettings() settings {
+	s := settings{
+		Domain:           f.Domain,
+		Dist:             f.Dist,
+		Output:           f.Output,
+		NetworkMirror:    f.NetworkMirror,
+		NetworkMirrorURL: f.NetworkMirrorURL,
+		FSMirror:         f.FSMirror,
+		FSLayout:         f.FSLayout,
+		LinkMode:         f.LinkMode,
+		TokenFile:        f.TokenFile,
+		Jobs:             f.Jobs,
+
+		Platforms:         strings.Join(f.Platforms, ","),
+		ExcludePlatforms:  strings.Join(f.ExcludePlatforms, ","),
+		RequiredPlatforms: strings.Join(f.RequiredPlatforms, ","),
+	}
+	if f.Login != nil {
+		s.Login = &packager.LoginV1{
+			Client:     f.Login.Client,
+			GrantTypes: f.Login.GrantTypes,
+			Authz:      f.Login.Authz,
+			Token:      f.Login.Token,
+			Ports:      f.Login.Ports,
+		}
+		if s.Login.Client == "" {
+			s.Login.Client = "terraform-cli"
+		}
+	}
+	if f.AllowNew {
+		s.AllowNew = &f.AllowNew
+	}
+	if f.Incremental {
+		s.Incremental = &f.Incremental
+	}
+
+	return s
+}
+
+// settings returns the settings for the provider selected by namespace and provider. Either may
+// be empty when it identifies a single provider of the file.
+func (f fileConfig) settings(namespace, provider string) (settings, error) {
+	s := f.globalSettings()
+
+	namespace, provider, err := f.selectProvider(namespace, provider)
+	if err != nil {
+		return s, err
+	}
+	s.Namespace = namespace
+	s.Provider = provider
+
+	keyName, keySet := f.Key, f.KeySet
+	ns := f.Namespaces[namespace]
+	if ns.Key != "" {
+		keyName = ns.Key
+	}
+	if ns.KeySet != nil {
+		keySet = ns.KeySet
+	}
+	if p, ok := ns.Providers[provider]; ok {
+		s.Repo = p.Repo
+		if s.Repo == "" {
+			s.Repo = "terraform-provider-" + provider
+		}
+		if p.Dist != "" {
+			s.Dist = p.Dist
+		}
+		if p.Key != "" {
+			keyName = p.Key
+		}
+		if p.KeySet != nil {
+			keySet = p.KeySet
+		}
+		s.Protocols = strings.Join(p.Protocols, ",")
+		for _, list := range []struct {
+			value []string
+			field *string
+		}{
+			{p.Platforms, &s.Platforms},
+			{p.ExcludePlatforms, &s.ExcludePlatforms},
+			{p.RequiredPlatforms, &s.RequiredPlatforms},
+		} {
+			if list.value != nil {
+				*list.field = strings.Join(list.value, ",")
+			}
+		}
+	}
+
+	if keyName == "" && len(keySet) > 0 {
+		keyName = keySet[0]
+	}
+	if keyName == "" && len(f.Keys) == 1 {
+		for name := range f.Keys {
+			keyName = name
+		}
+	}
+	if keyName != "" {
+		key, ok := f.Keys[keyName]
+		if !ok {
+			return s, fmt.Errorf("key %q is not defined", keyName)
+		}
+		s.GPGFingerprint = key.Fingerprint
+		s.GPGKeyFile = key.PublicKeyFile
+		s.GPGPrivateKey = key.PrivateKeyFile
+		s.SigningKey = key.signingKey()
+	}
+
+	for _, name := range keySet {
+		if name == keyName {
+			continue
+		}
+		key, ok := f.Keys[name]
+		if !ok {
+			return s, fmt.Errorf("key %q is not defined", name)
+		}
+		s.KeySet = append(s.KeySet, key.signingKey())
+	}
+
+	return s, nil
+}
+
+// selectProvider finds the single provider of the file matching namespace and provider, where an
+// empty value matches anything. A selection that matches nothing is returned unchanged.
+func (f fileConfig) selectProvider(namespace, provider string) (string, string, error) {
+	var matches [][2]string
+	for nsName, ns := range f.Namespaces {
+		if namespace != "" && nsName != namespace {
+			continue
+		}
+		for pName := range ns.Providers {
+			if provider != "" && pName != provider {
+				continue
+			}
+			matches = append(matches, [2]string{nsName, pName})
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return namespace, provider, nil
+	case 1:
+		return matches[0][0], matches[0][1], nil
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, m[0]+"/"+m[1])
+	}
+	sort.Strings(names)
+
+	return "", "", fmt.Errorf("several providers match (%v), select one with -ns and -p", names)
+}
@@ -1,3 +1,16 @@
 module github.com/marceloalmeida/tfpp
 
 go 1.24.2
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require (
+	github.com/ProtonMail/go-crypto v1.3.0
+	golang.org/x/mod v0.33.0
+)
+
+require (
+	github.com/cloudflare/circl v1.6.1 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -1,557 +1,693 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"strings"
-)
-
-type Platform struct {
-	Os   string `json:"os"`
-	Arch string `json:"arch"`
-}
 
-type Version struct {
-	Version   string     `json:"version"`
-	Protocols []string   `json:"protocols"`
-	Platforms []Platform `json:"platforms"`
-}
+	"github.com/marceloalmeida/tfpp/packager"
+)
 
-type Versions struct {
-	Versions []Version `json:"versions"`
-}
+// errUsage is returned for an invalid command line once its usage has been printed.
+var errUsage = errors.New("invalid usage")
 
-type WellKnown struct {
-	ProvidersV1 string `json:"providers.v1"`
-	ModulesV1   string `json:"modules.v1"`
-}
+// stdout receives command output, as opposed to the progress messages written with log.
+var stdout io.Writer = os.Stdout
 
-var defaultWellKnownData = WellKnown{
-	ProvidersV1: "/v1/providers/",
-	ModulesV1:   "/v1/modules/",
+// command is a tfpp subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
 }
 
-type Architecture struct {
-	Protocols           []string `json:"protocols"`
-	Os                  string   `json:"os"`
-	Arch                string   `json:"arch"`
-	Filename            string   `json:"filename"`
-	DownloadUrl         string   `json:"download_url"`
-	ShasumsUrl          string   `json:"shasums_url"`
-	ShasumsSignatureUrl string   `json:"shasums_signature_url"`
-	Shasum              string   `json:"shasum"`
-	SigningKeys         struct {
-		GpgPublicKeys []struct {
-			KeyId          string `json:"key_id"`
-			AsciiArmor     string `json:"ascii_armor"`
-			TrustSignature string `json:"trust_signature"`
-			Source         string `json:"source"`
-			SourceUrl      string `json:"source_url"`
-		} `json:"gpg_public_keys"`
-	} `json:"signing_keys"`
+var commands []command
+
+func init() {
+	commands = []command{
+		{"package", "Package a provider version into a static registry tree", runPackage},
+		{"mirror-net", "Package a provider version into a network mirror tree only", runNetworkMirror},
+		{"mirror-fs", "Package a provider version into a filesystem mirror tree only", runFilesystemMirror},
+		{"module", "Package a module version into a static module registry tree", runModule},
+		{"serve", "Serve a release tree over the registry protocols", runServe},
+		{"verify", "Check a release tree the way terraform init would", runVerify},
+		{"check", "Install a provider from a live registry the way terraform init would", runCheck},
+		{"lock", "Print the .terraform.lock.hcl block of a provider version", runLock},
+		{"help", "Show this help", func(context.Context, []string) error {
+			usage(os.Stdout)
+			return nil
+		}},
+	}
 }
 
 func main() {
-	log.Println("📦 Packaging Terraform Provider for private registry...")
-
-	namespace := flag.String("ns", "", "Namespace for the Terraform registry.")
-	domain := flag.String("d", "", "Private Terraform registry domain.")
-	providerName := flag.String("p", "", "Name of the Terraform provider.")
-	distPath := flag.String("dp", "dist", "Path to Go Releaser build files.")
-	repoName := flag.String("r", "", "Name of the provider repository used in Go Releaser build name.")
-	version := flag.String("v", "", "Semantic version of build.")
-	gpgFingerprint := flag.String("gf", "", "GPG Fingerprint of key used by Go Releaser")
-	gpgPubKeyFile := flag.String("gk", "pubkey.txt", "Path to GPG Public Key in ASCII Armor format.")
-	flag.Parse()
-
-	if *namespace == "" {
-		log.Fatal("Namespace is required.")
-	}
-	if *domain == "" {
-		log.Fatal("Domain is required.")
-	}
-	if *providerName == "" {
-		log.Fatal("Provider name is required.")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:])
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		stop()
+		os.Exit(2)
+	default:
+		stop()
+		log.Fatal(err)
 	}
-	if *repoName == "" {
-		log.Fatal("Repository name is required.")
+}
+
+// run dispatches args to a subcommand. Flags without a subcommand run "package" for
+// compatibility with the original single-command CLI.
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		usage(os.Stderr)
+		return errUsage
 	}
-	if *version == "" {
-		log.Fatal("Version is required.")
+
+	name := args[0]
+	switch {
+	case name == "-h" || name == "-help" || name == "--help":
+		usage(os.Stdout)
+		return nil
+	case strings.HasPrefix(name, "-"):
+		return runPackage(ctx, args)
 	}
-	if *gpgFingerprint == "" {
-		log.Fatal("GPG Fingerprint is required.")
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(ctx, args[1:])
+		}
 	}
 
-	*distPath = *distPath + "/"
+	fmt.Fprintf(os.Stderr, "tfpp: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return errUsage
+}
 
-	err := deleteDir("release")
-	if err != nil {
-		log.Fatalf("Error deleting 'release' dir: %s", err)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: tfpp <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'tfpp <command> -h' for the flags of a command.")
+}
 
-	err = createDir("release")
-	if err != nil {
-		log.Fatalf("Error creating 'release' dir: %s", err)
+// parseFlags parses the flags of the packaging commands, plus the command specific flags
+// registered by extra. Unset flags are left empty so that the environment and config file can
+// provide them.
+func parseFlags(name string, args []string, extra ...func(*flag.FlagSet)) (settings, error) {
+	var s settings
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&s.Config, "c", "", "Path to a YAML or JSON config file.")
+	flags.StringVar(&s.Namespace, "ns", "", "Namespace for the Terraform registry.")
+	flags.StringVar(&s.Domain, "d", "", "Private Terraform registry domain.")
+	flags.StringVar(&s.Provider, "p", "", "Name of the Terraform provider.")
+	flags.StringVar(&s.Dist, "dp", "", "Path to Go Releaser build files. (default \"dist\")")
+	flags.StringVar(&s.Output, "o", "", "Output directory of the registry tree. (default \"release\")")
+	flags.StringVar(&s.Repo, "r", "", "Name of the provider repository used in Go Releaser build name. (default \"terraform-provider-<provider>\")")
+	flags.StringVar(&s.Version, "v", "", "Semantic version of build.")
+	flags.StringVar(&s.GPGFingerprint, "gf", "", "GPG fingerprint or long key ID of the key used by Go Releaser. (default derived from the public key)")
+	flags.StringVar(&s.GPGKeyFile, "gk", "", "Path to GPG Public Key in ASCII Armor format. (default \"pubkey.txt\")")
+	flags.StringVar(&s.GPGPrivateKey, "gpk", "", "Path to a GPG private key in ASCII Armor format to sign SHA256SUMS with instead of using the Go Releaser signature.")
+	flags.StringVar(&s.Protocols, "protocols", "", "Comma-separated plugin protocol versions, overriding the Go Releaser registry manifest.")
+	flags.StringVar(&s.Platforms, "platforms", "", "Comma-separated <os>_<arch> patterns of the platforms to publish, e.g. \"linux_*,darwin_*\". (default all)")
+	flags.StringVar(&s.ExcludePlatforms, "exclude-platforms", "", "Comma-separated <os>_<arch> patterns of the platforms not to publish.")
+	flags.StringVar(&s.RequiredPlatforms, "require-platforms", "", "Comma-separated <os>_<arch> platforms that must be published, e.g. \"linux_amd64,darwin_arm64\".")
+	flags.StringVar(&s.NetworkMirror, "network-mirror", "", "Also write a network mirror tree to this directory.")
+	flags.StringVar(&s.NetworkMirrorURL, "network-mirror-url", "", "Base URL of the published network mirror, used to merge its index.json.")
+	flags.StringVar(&s.FSMirror, "fs-mirror", "", "Also write a filesystem mirror tree to this directory.")
+	flags.StringVar(&s.FSLayout, "fs-layout", "", "Layout of the filesystem mirror, packed or unpacked. (default \"packed\")")
+	flags.StringVar(&s.LinkMode, "link-mode", "", "How zips are placed into the output trees: copy, hardlink, reflink or symlink. (default \"copy\")")
+	flags.IntVar(&s.Jobs, "jobs", 0, "Number of zips copied, hashed and published concurrently. (default number of CPUs)")
+	allowNew := flags.Bool("allow-new", false, "Allow publishing a provider that is not in the registry yet (versions file returns 404).")
+	incremental := flags.Bool("incremental", false, "Merge into the existing output directory instead of recreating it, using its versions file when present.")
+	for _, register := range extra {
+		register(flags)
+	}
+
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return s, err
 	}
-
-	err = provider(*namespace, *providerName, *distPath, *repoName, *version, *gpgFingerprint, *gpgPubKeyFile, *domain)
 	if err != nil {
-		log.Fatalf("Error creating dir: %s", err)
+		return s, errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected arguments: %v\n", flags.Args())
+		return s, errUsage
 	}
 
-	log.Println("🎉 Packaged Terraform Provider for private registry.")
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "allow-new":
+			s.AllowNew = allowNew
+		case "incremental":
+			s.Incremental = incremental
+		}
+	})
+
+	return s, nil
 }
 
-func provider(namespace, provider, distPath, repoName, version, gpgFingerprint, gpgPubKeyFile, domain string) error {
-	wellKnownData, err := createVersionsFile(namespace, provider, distPath, repoName, version, domain)
+// loadSettings parses the flags of the named command and resolves them with the environment
+// and config file.
+func loadSettings(name string, args []string, extra ...func(*flag.FlagSet)) (settings, error) {
+	flagSettings, err := parseFlags(name, args, extra...)
 	if err != nil {
-		log.Fatalf("Error creating versions file: %s", err)
+		return settings{}, err
 	}
 
-	versionPath := providerDirs(namespace, provider, version, wellKnownData)
+	return resolveSettings(flagSettings)
+}
 
-	copyShaFiles(versionPath, distPath, repoName, version)
-	downloadPath, err := createDownloadsDir(versionPath)
+func runPackage(ctx context.Context, args []string) error {
+	var passphraseFD int
+	var dryRun, diffRegistry bool
+	var format, reportPath, summaryPath string
+	s, err := loadSettings("tfpp package", args, func(flags *flag.FlagSet) {
+		flags.IntVar(&passphraseFD, "gpg-passphrase-fd", -1, "Read the passphrase of the -gpk key from this file descriptor instead of TFPP_GPG_PASSPHRASE.")
+		flags.BoolVar(&dryRun, "dry-run", false, "Print the files packaging would write or delete instead of writing them.")
+		flags.BoolVar(&diffRegistry, "diff-registry", false, "Compare the -dry-run plan with the files published on the registry domain instead of the output directory.")
+		flags.StringVar(&format, "format", "text", "Output format of the -dry-run plan, text or json.")
+		flags.StringVar(&reportPath, "report", "", "Write a JSON report of the published version to this file, or to stdout for \"-\".")
+		flags.StringVar(&summaryPath, "step-summary", "", "Append a Markdown summary of the published version to this file, e.g. $GITHUB_STEP_SUMMARY.")
+	})
 	if err != nil {
 		return err
 	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "invalid -format %q, want text or json\n", format)
+		return errUsage
+	}
+	if dryRun && (reportPath != "" || summaryPath != "") {
+		fmt.Fprintln(os.Stderr, "-report and -step-summary cannot be used with -dry-run")
+		return errUsage
+	}
 
-	err = createTargetDirs(*downloadPath)
-	if err != nil {
-		log.Fatalf("Error creating target dirs: %s", err)
+	if dryRun {
+		log.Println("📋 Planning Terraform Provider packaging for private registry...")
+	} else {
+		log.Println("📦 Packaging Terraform Provider for private registry...")
 	}
 
-	err = copyBuildZips(*downloadPath, distPath, repoName, version)
-	if err != nil {
-		log.Fatalf("Error copying build zips: %s", err)
+	cfg, opts := s.packagerConfig()
+	if cfg.GPGPrivateKeyFile != "" {
+		cfg.GPGPassphrase, err = readPassphrase(passphraseFD)
+		if err != nil {
+			return fmt.Errorf("reading GPG passphrase: %w", err)
+		}
 	}
 
-	err = createArchitectureFiles(namespace, provider, distPath, repoName, version, gpgFingerprint, gpgPubKeyFile, domain, wellKnownData)
+	p, err := packager.New(cfg, opts...)
 	if err != nil {
-		log.Fatalf("Error creating architecture files: %s", err)
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	return nil
-}
-
-func providerDirs(namespace, repoName, version string, wewellKnownData WellKnown) string {
-	log.Println("* Creating release/[well know providers]/[namespace]/[repo]/[version] directories")
-
-	providerPathArr := [5]string{"release", wewellKnownData.ProvidersV1, namespace, repoName, version}
-
-	var currentPath string
-	for _, v := range providerPathArr {
-		currentPath = currentPath + v + "/"
-		err := createDir(currentPath)
+	if dryRun {
+		base := packager.PlanLocal
+		if diffRegistry {
+			base = packager.PlanRemote
+		}
+		plan, err := p.DryRun(ctx, base)
 		if err != nil {
-			log.Fatalf("Error creating directory: %s", err)
+			if errors.Is(err, packager.ErrNotFound) {
+				log.Println("Use -allow-new to publish a provider that is not in the registry yet.")
+			}
+			return fmt.Errorf("planning provider packaging: %w", err)
 		}
+		return printPlan(plan, format)
 	}
 
-	return currentPath
-}
-
-func createVersionsFile(namespace, provider, distPath, repoName, version, domain string) (WellKnown, error) {
-	registryVersionFile, wellKnownData, _ := downloadVersionsFile(namespace, provider, domain)
-
-	versionPath := fmt.Sprintf("%s%s%s/%s/versions", "release", wellKnownData.ProvidersV1, namespace, provider)
-
-	shaSumContents, err := getShaSumContents(distPath, repoName, version)
+	report, err := p.PackageReport(ctx)
 	if err != nil {
-		return wellKnownData, err
+		if errors.Is(err, packager.ErrNotFound) {
+			log.Println("Use -allow-new to publish a provider that is not in the registry yet.")
+		}
+		return fmt.Errorf("packaging provider: %w", err)
 	}
 
-	var ver Version
-	ver.Version = version
-	ver.Protocols = []string{"5.0", "5.1"}
-	ver.Platforms = []Platform{}
-
-	var vers Versions
-	vers.Versions = []Version{}
-
-	for _, line := range shaSumContents {
-		fileName := line[1]
-
-		removeFileExtension := strings.Split(fileName, ".zip")
-		fileNameSplit := strings.Split(removeFileExtension[0], "_")
-
-		if len(fileNameSplit) < 4 {
-			log.Printf("Filename '%s' is not in the expected format, skipping...", fileName)
-			continue
+	if reportPath != "" {
+		err = writeReport(reportPath, report)
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
 		}
+	}
+	if summaryPath != "" {
+		err = appendStepSummary(summaryPath, report)
+		if err != nil {
+			return fmt.Errorf("writing step summary: %w", err)
+		}
+	}
 
-		target := fileNameSplit[2]
-		arch := fileNameSplit[3]
+	log.Println("🎉 Packaged Terraform Provider for private registry.")
 
-		var plat Platform
-		plat.Os = target
-		plat.Arch = arch
+	return nil
+}
 
-		ver.Platforms = append(ver.Platforms, plat)
+// writeReport writes report as JSON to the file at path, or to stdout when path is "-".
+func writeReport(path string, report packager.Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
 	}
+	data = append(data, '\n')
 
-	for _, v := range registryVersionFile.Versions {
-		exists := false
-		for _, existingVersion := range vers.Versions {
-			if existingVersion.Version == v.Version {
-				exists = true
-				break
-			}
-		}
-		if !exists {
-			vers.Versions = append(vers.Versions, v)
-		}
+	if path == "-" {
+		_, err = stdout.Write(data)
+		return err
 	}
 
-	vers.Versions = append(vers.Versions, ver)
+	return os.WriteFile(path, data, 0644)
+}
 
-	versionsFile, err := json.MarshalIndent(vers, "", "  ")
+// appendStepSummary appends the Markdown summary of report to the file at path, as GitHub Actions
+// expects for $GITHUB_STEP_SUMMARY.
+func appendStepSummary(path string, report packager.Report) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Fatalf("Error marshalling JSON: %s", err)
+		return err
 	}
+	defer f.Close()
 
-	versionPathDir := strings.Split(versionPath, "/")
-	err = createDirRecursive(strings.Join(versionPathDir[:len(versionPathDir)-1], "/"))
+	_, err = io.WriteString(f, stepSummary(report))
 	if err != nil {
-		log.Fatalf("Error creating directory: %s", err)
-		return wellKnownData, err
+		return err
 	}
 
-	err = writeFile(versionPath, versionsFile)
-	if err != nil {
-		log.Fatalf("Error writing versions file: %s", err)
-		return wellKnownData, err
+	return f.Close()
+}
+
+// stepSummary returns report as Markdown: a table of the published platforms followed by the
+// warnings and skipped files.
+func stepSummary(report packager.Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### 📦 %s %s\n\n", report.Provider, report.Version)
+	fmt.Fprintf(&b, "Protocols: %s\n\n", strings.Join(report.Protocols, ", "))
+
+	fmt.Fprintln(&b, "| Platform | Filename | SHA256 | Signing keys |")
+	fmt.Fprintln(&b, "| --- | --- | --- | --- |")
+	for _, platform := range report.Platforms {
+		fmt.Fprintf(&b, "| %s_%s | [%s](%s) | `%s` | %s |\n", platform.Os, platform.Arch, platform.Filename, platform.DownloadUrl, platform.Shasum, "`"+strings.Join(platform.SigningKeyIDs, "`, `")+"`")
 	}
 
-	return wellKnownData, nil
-}
+	if len(report.Warnings) > 0 {
+		fmt.Fprint(&b, "\n#### Warnings\n\n")
+		for _, warning := range report.Warnings {
+			fmt.Fprintf(&b, "- %s\n", warning)
+		}
+	}
 
-func downloadVersionsFile(namespace, provider, domain string) (Versions, WellKnown, error) {
-	log.Println("* Downloading versions file")
+	if len(report.Skipped) > 0 {
+		fmt.Fprint(&b, "\n#### Skipped files\n\n")
+		for _, skipped := range report.Skipped {
+			fmt.Fprintf(&b, "- `%s`: %s\n", skipped.Filename, skipped.Reason)
+		}
+	}
+	b.WriteString("\n")
 
-	httpClient := &http.Client{}
-	wellKnownUrl := fmt.Sprintf("https://%s/.well-known/terraform.json", domain)
-	resp, err := httpClient.Get(wellKnownUrl)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Printf("Error downloading well-known file: %s or status code not %d", err.Error(), http.StatusOK)
+	return b.String()
+}
 
-		wellKnownFile, err := json.MarshalIndent(defaultWellKnownData, "", "  ")
+// printPlan writes plan to stdout as JSON, or in the text format as a line per created (+),
+// updated (~) or deleted (-) file followed by a summary.
+func printPlan(plan packager.Plan, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(plan, "", "  ")
 		if err != nil {
-			log.Fatalf("Error marshalling JSON: %s", err)
+			return err
 		}
-		err = createDirRecursive("release/.well-known/")
-		if err != nil {
-			log.Fatalf("Error creating directory: %s", err)
+		_, err = fmt.Fprintln(stdout, string(data))
+		return err
+	}
+
+	symbols := map[packager.ChangeAction]string{
+		packager.ChangeCreate: "+",
+		packager.ChangeUpdate: "~",
+		packager.ChangeDelete: "-",
+	}
+	for _, change := range plan.Changes {
+		symbol, ok := symbols[change.Action]
+		if !ok {
+			continue
 		}
-		err = writeFile("release/"+".well-known/terraform.json", wellKnownFile)
+		_, err := fmt.Fprintf(stdout, "%s %s\n", symbol, change.Path)
 		if err != nil {
-			log.Fatalf("Error writing terraform.json file: %s", err)
+			return err
 		}
-
-		return Versions{}, defaultWellKnownData, fmt.Errorf("error downloading well-known file: %s or status code not %d", err.Error(), http.StatusOK)
 	}
-	defer resp.Body.Close()
 
-	bodyResp, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %s", err)
-		return Versions{}, defaultWellKnownData, err
-	}
-	resp.Body.Close()
+	summary := plan.Summary
+	_, err := fmt.Fprintf(stdout, "Plan: %d to create, %d to update, %d to delete, %d unchanged.\n", summary.Create, summary.Update, summary.Delete, summary.Unchanged)
 
-	var wellKnownData WellKnown
-	err = json.Unmarshal(bodyResp, &wellKnownData)
-	if err != nil {
-		log.Printf("Error unmarshalling JSON: %s", err)
-		return Versions{}, defaultWellKnownData, err
-	}
+	return err
+}
 
-	versionsUrl := fmt.Sprintf("https://%s%s%s/%s/versions", domain, wellKnownData.ProvidersV1, namespace, provider)
-	resp, err = httpClient.Get(versionsUrl)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		log.Printf("Error downloading versions file: %s or status code not %d", err, http.StatusOK)
-		return Versions{}, wellKnownData, fmt.Errorf("error downloading versions file: %s or status code not %d", err, http.StatusOK)
+// readPassphrase returns the passphrase of the GPG private key, read from the file descriptor fd
+// when it is not negative and from TFPP_GPG_PASSPHRASE otherwise.
+func readPassphrase(fd int) ([]byte, error) {
+	if fd < 0 {
+		return []byte(os.Getenv("TFPP_GPG_PASSPHRASE")), nil
 	}
-	defer resp.Body.Close()
 
-	bodyResp, err = io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %s", err)
-		return Versions{}, wellKnownData, err
+	f := os.NewFile(uintptr(fd), "gpg-passphrase-fd")
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
 	}
-	resp.Body.Close()
-	var versionsData Versions
-	err = json.Unmarshal(bodyResp, &versionsData)
+	defer f.Close()
+
+	return readPassphraseFrom(f)
+}
+
+// readPassphraseFrom reads a passphrase up to EOF and removes trailing newlines.
+func readPassphraseFrom(r io.Reader) ([]byte, error) {
+	passphrase, err := io.ReadAll(r)
 	if err != nil {
-		log.Printf("Error unmarshalling JSON: %s", err)
-		return Versions{}, wellKnownData, err
+		return nil, err
 	}
 
-	return versionsData, wellKnownData, nil
+	return bytes.TrimRight(passphrase, "\r\n"), nil
 }
 
-func copyShaFiles(destPath, srcPath, repoName, version string) {
-	log.Printf("* Copying SHA files in %s directory", srcPath)
+func runNetworkMirror(ctx context.Context, args []string) error {
+	s, err := loadSettings("tfpp mirror-net", args)
+	if err != nil {
+		return err
+	}
+	if s.NetworkMirror == "" {
+		s.NetworkMirror = "mirror"
+	}
 
-	shaSum := repoName + "_" + version + "_SHA256SUMS"
-	shaSumPath := srcPath + "/" + shaSum
+	log.Println("📦 Packaging Terraform Provider for network mirror...")
 
-	err := copyFile(shaSumPath, destPath+shaSum)
+	cfg, opts := s.packagerConfig()
+	p, err := packager.New(cfg, opts...)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	err = copyFile(shaSumPath+".sig", destPath+shaSum+".sig")
+	err = p.PackageNetworkMirror(ctx)
 	if err != nil {
-		log.Fatal(err)
+		if errors.Is(err, packager.ErrNotFound) {
+			log.Println("Use -allow-new to publish a provider that is not in the network mirror yet.")
+		}
+		return fmt.Errorf("packaging network mirror: %w", err)
 	}
-}
 
-func createDownloadsDir(destPath string) (*string, error) {
-	log.Printf("* Creating download/ in %s directory", destPath)
+	log.Println("🎉 Packaged Terraform Provider for network mirror.")
 
-	downloadPath := destPath + "download/"
+	return nil
+}
 
-	err := createDir(downloadPath)
+func runFilesystemMirror(ctx context.Context, args []string) error {
+	s, err := loadSettings("tfpp mirror-fs", args)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if s.FSMirror == "" {
+		s.FSMirror = "mirror"
 	}
 
-	return &downloadPath, nil
-}
-
-func createTargetDirs(destPath string) error {
-	log.Printf("* Creating target dirs in %s directory", destPath)
+	log.Println("📦 Packaging Terraform Provider for filesystem mirror...")
 
-	targets := [4]string{"darwin", "freebsd", "linux", "windows"}
+	cfg, opts := s.packagerConfig()
+	p, err := packager.New(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
 
-	for _, v := range targets {
-		err := createDir(destPath + v)
-		if err != nil {
-			return err
-		}
+	err = p.PackageFilesystemMirror(ctx)
+	if err != nil {
+		return fmt.Errorf("packaging filesystem mirror: %w", err)
 	}
 
+	log.Println("🎉 Packaged Terraform Provider for filesystem mirror.")
+
 	return nil
 }
 
-func copyBuildZips(destPath, distPath, repoName, version string) error {
-	log.Println("* Copying build zips")
-
-	shaSumContents, err := getShaSumContents(distPath, repoName, version)
+// parseModuleFlags parses the flags of the module command. Like parseFlags, unset flags are left
+// empty so that the environment and config file can provide them.
+func parseModuleFlags(args []string) (settings, error) {
+	var s settings
+
+	flags := flag.NewFlagSet("tfpp module", flag.ContinueOnError)
+	flags.StringVar(&s.Config, "c", "", "Path to a YAML or JSON config file, of which only the top-level settings are used.")
+	flags.StringVar(&s.Namespace, "ns", "", "Namespace for the Terraform registry.")
+	flags.StringVar(&s.Domain, "d", "", "Private Terraform registry domain.")
+	flags.StringVar(&s.ModuleName, "name", "", "Name of the module.")
+	flags.StringVar(&s.ModuleSystem, "system", "", "Target system of the module, e.g. aws.")
+	flags.StringVar(&s.Version, "v", "", "Semantic version of the module. (default the -git-ref tag without its leading v)")
+	flags.StringVar(&s.ModuleSource, "src", "", "Module directory, or git repository of -git-ref. (default \".\")")
+	flags.StringVar(&s.ModuleGitRef, "git-ref", "", "Git tag or commit to archive instead of the working tree.")
+	flags.StringVar(&s.Output, "o", "", "Output directory of the registry tree. (default \"release\")")
+	allowNew := flags.Bool("allow-new", false, "Allow publishing a module that is not in the registry yet (versions file returns 404).")
+	incremental := flags.Bool("incremental", false, "Merge into the existing output directory instead of recreating it, using its versions file when present.")
+
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return s, err
+	}
 	if err != nil {
-		return err
+		return s, errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected arguments: %v\n", flags.Args())
+		return s, errUsage
 	}
 
-	for _, v := range shaSumContents {
-		zipName := v[1]
-
-		if !strings.HasSuffix(zipName, ".zip") {
-			log.Printf("Filename '%s' is not a zip file, skipping...", zipName)
-			continue
-		}
-
-		zipSrcPath := distPath + zipName
-		zipDestPath := destPath + zipName
-
-		log.Printf("  - Zip Source: %s", zipSrcPath)
-		log.Printf("   - Zip Dest:  %s", zipDestPath)
-
-		err := copyFile(zipSrcPath, zipDestPath)
-		if err != nil {
-			return err
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "allow-new":
+			s.AllowNew = allowNew
+		case "incremental":
+			s.Incremental = incremental
 		}
-	}
+	})
 
-	return nil
+	return s, nil
 }
 
-func getShaSumContents(distPath, repoName, version string) ([][]string, error) {
-	shaSumFileName := repoName + "_" + version + "_SHA256SUMS"
-	shaSumPath := distPath + "/" + shaSumFileName
-
-	shaSumLine, err := readFile(shaSumPath)
+func runModule(ctx context.Context, args []string) error {
+	flagSettings, err := parseModuleFlags(args)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	s, err := resolveModuleSettings(flagSettings)
+	if err != nil {
+		return err
 	}
 
-	buildsAndShaSums := [][]string{}
-
-	for _, line := range shaSumLine {
-		lineSplit := strings.Split(line, "  ")
+	log.Println("📦 Packaging Terraform Module for private registry...")
 
-		row := []string{lineSplit[0], lineSplit[1]}
-		buildsAndShaSums = append(buildsAndShaSums, row)
+	cfg, opts := s.moduleConfig()
+	m, err := packager.NewModule(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	return buildsAndShaSums, nil
-}
+	err = m.Package(ctx)
+	if err != nil {
+		if errors.Is(err, packager.ErrNotFound) {
+			log.Println("Use -allow-new to publish a module that is not in the registry yet.")
+		}
+		return fmt.Errorf("packaging module: %w", err)
+	}
 
-func createArchitectureFiles(namespace, provider, distPath, repoName, version, gpgFingerprint, gpgPubKeyFile, domain string, wellKnownData WellKnown) error {
-	log.Println("* Creating architecture files in target directories")
+	log.Println("🎉 Packaged Terraform Module for private registry.")
 
-	prefix := fmt.Sprintf("%s%s/%s/%s/", wellKnownData.ProvidersV1, namespace, provider, version)
-	pathPrefix := fmt.Sprintf("release%s", prefix)
-	urlPrefix := fmt.Sprintf("https://%s%s", domain, prefix)
+	return nil
+}
 
-	downloadUrlPrefix := urlPrefix + "download/"
-	downloadPathPrefix := pathPrefix + "download/"
+// errProblems is returned by the checking commands when problems were found and printed.
+var errProblems = errors.New("problems found")
 
-	shasumsUrl := urlPrefix + fmt.Sprintf("%s_%s_SHA256SUMS", repoName, version)
-	shasumsSigUrl := shasumsUrl + ".sig"
+func runVerify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tfpp verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tfpp verify [flags] [release-dir]")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "json", "Output format of the problems, json or text.")
 
-	shaSumContents, err := getShaSumContents(distPath, repoName, version)
-	if err != nil {
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
 		return err
 	}
-
-	gpgFile, err := readFile(gpgPubKeyFile)
 	if err != nil {
-		log.Fatalf("Error reading '%s' file: %s", gpgPubKeyFile, err)
+		return errUsage
 	}
-
-	gpgAsciiPub := ""
-	for _, line := range gpgFile {
-		gpgAsciiPub = gpgAsciiPub + line + "\n"
+	if flags.NArg() > 1 || (*format != "json" && *format != "text") {
+		flags.Usage()
+		return errUsage
 	}
 
-	for _, line := range shaSumContents {
-		shasum := line[0]
-		fileName := line[1]
+	root := "release"
+	if flags.NArg() == 1 {
+		root = flags.Arg(0)
+	}
 
-		downloadUrl := downloadUrlPrefix + fileName
+	log.Printf("🔍 Verifying release tree %s...", root)
 
-		removeFileExtension := strings.Split(fileName, ".zip")
-		fileNameSplit := strings.Split(removeFileExtension[0], "_")
+	problems, err := packager.Verify(ctx, root)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", root, err)
+	}
 
-		if len(fileNameSplit) < 4 {
-			log.Printf("Filename '%s' is not in the expected format, skipping...", fileName)
-			continue
-		}
+	err = printProblems(problems, *format)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d %w", len(problems), errProblems)
+	}
 
-		target := fileNameSplit[2]
-		arch := fileNameSplit[3]
-
-		archFileName := downloadPathPrefix + target + "/" + arch
-
-		var architecture Architecture
-		architecture.Protocols = []string{"4.0", "5.0", "5.1"}
-		architecture.Os = target
-		architecture.Arch = arch
-		architecture.Filename = fileName
-		architecture.DownloadUrl = downloadUrl
-		architecture.ShasumsUrl = shasumsUrl
-		architecture.ShasumsSignatureUrl = shasumsSigUrl
-		architecture.Shasum = shasum
-		architecture.SigningKeys.GpgPublicKeys = []struct {
-			KeyId          string `json:"key_id"`
-			AsciiArmor     string `json:"ascii_armor"`
-			TrustSignature string `json:"trust_signature"`
-			Source         string `json:"source"`
-			SourceUrl      string `json:"source_url"`
-		}{
-			{
-				KeyId:          gpgFingerprint,
-				AsciiArmor:     gpgAsciiPub,
-				TrustSignature: "",
-				Source:         "",
-				SourceUrl:      "",
-			},
-		}
-		architectureTemplate, err := json.MarshalIndent(architecture, "", "  ")
-		if err != nil {
-			log.Fatalf("Error marshalling JSON: %s", err)
-		}
+	log.Println("🎉 Release tree is valid.")
 
-		log.Printf("  - Arch file: %s", archFileName)
+	return nil
+}
 
-		err = writeFile(archFileName, architectureTemplate)
-		if err != nil {
-			return err
+// printProblems writes problems to stdout as a JSON array, or one per line in the text format.
+func printProblems(problems []packager.Problem, format string) error {
+	if format == "text" {
+		for _, problem := range problems {
+			_, err := fmt.Fprintln(stdout, problem)
+			if err != nil {
+				return err
+			}
 		}
+		return nil
 	}
 
-	return nil
-}
-
-func deleteDir(path string) error {
-	err := os.RemoveAll(path)
+	if problems == nil {
+		problems = []packager.Problem{}
+	}
+	data, err := json.MarshalIndent(problems, "", "  ")
 	if err != nil {
 		return err
 	}
+	_, err = fmt.Fprintln(stdout, string(data))
 
-	return nil
+	return err
 }
 
-func createDir(path string) error {
-	if _, err := os.Stat(path); !os.IsNotExist(err) {
-		return nil
+func runCheck(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("tfpp check", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: tfpp check [flags] https://<domain>/<namespace>/<type>")
+		flags.PrintDefaults()
 	}
-	err := os.Mkdir(path, os.ModePerm)
-	return err
-}
+	format := flags.String("format", "text", "Output format of the report, text or json.")
 
-func createDirRecursive(path string) error {
-	err := os.MkdirAll(path, os.ModePerm)
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 || (*format != "json" && *format != "text") {
+		flags.Usage()
+		return errUsage
+	}
+
+	report, err := packager.Check(ctx, flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("checking %s: %w", flags.Arg(0), err)
+	}
+
+	err = printCheckReport(report, *format)
 	if err != nil {
 		return err
 	}
+	if !report.OK() {
+		return fmt.Errorf("%d %w", len(report.Problems), errProblems)
+	}
+
+	log.Printf("🎉 Terraform can install every platform of %s.", report.Provider)
 
 	return nil
 }
 
-func copyFile(src, dst string) error {
-	sourceFileStat, err := os.Stat(src)
-	if err != nil {
+// printCheckReport writes the report to stdout as JSON, or as a line per platform followed by
+// its problems in the text format.
+func printCheckReport(report packager.CheckReport, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, string(data))
 		return err
 	}
 
-	if !sourceFileStat.Mode().IsRegular() {
-		return fmt.Errorf("%s is not a regular file", src)
+	for _, platform := range report.Platforms {
+		status := "ok"
+		if !platform.OK() {
+			status = "FAILED"
+		}
+		_, err := fmt.Fprintf(stdout, "%s %s %s\n", platform.Version, platform.Platform, status)
+		if err != nil {
+			return err
+		}
+		for _, problem := range platform.Problems {
+			_, err := fmt.Fprintf(stdout, "  %s: %s\n", problem.Path, problem.Message)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	source, err := os.Open(src)
-	if err != nil {
-		return err
+	// Problems of the service discovery and versions document are not tied to a platform.
+	var other []packager.Problem
+	for _, problem := range report.Problems {
+		if problem.Platform == "" {
+			other = append(other, problem)
+		}
 	}
-	defer source.Close()
 
-	destination, err := os.Create(dst)
+	return printProblems(other, format)
+}
+
+func runLock(ctx context.Context, args []string) error {
+	var fromDist bool
+	s, err := loadSettings("tfpp lock", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&fromDist, "from-dist", false, "Compute the hashes from the Go Releaser dist instead of the published hashes.json.")
+	})
 	if err != nil {
 		return err
 	}
-	defer destination.Close()
-	_, err = io.Copy(destination, source)
-	return err
-}
-
-func readFile(filePath string) ([]string, error) {
-	readFile, err := os.Open(filePath)
 
+	cfg, opts := s.packagerConfig()
+	p, err := packager.New(cfg, opts...)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
-	fileScanner := bufio.NewScanner(readFile)
-	fileScanner.Split(bufio.ScanLines)
-	var fileLines []string
 
-	for fileScanner.Scan() {
-		fileLines = append(fileLines, fileScanner.Text())
+	var hashes packager.VersionHashes
+	if fromDist {
+		hashes, err = p.Hashes(ctx)
+	} else {
+		hashes, err = p.FetchHashes(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("reading hashes: %w", err)
 	}
 
-	readFile.Close()
-
-	return fileLines, nil
-}
+	address := fmt.Sprintf("%s/%s/%s", cfg.Domain, cfg.Namespace, cfg.Provider)
+	_, err = fmt.Fprint(stdout, packager.LockBlock(address, hashes))
 
-func writeFile(fileName string, fileContents []byte) error {
-	err := os.WriteFile(fileName, fileContents, 0644)
 	return err
 }
@@ -1,929 +1,778 @@
 package main
 
 import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/marceloalmeida/tfpp/packager"
 )
 
-// TestCreateDir tests the createDir function.
-func TestCreateDir(t *testing.T) {
-	tests := []struct {
-		name      string
-		createNew bool
-		wantErr   bool
-	}{
-		{
-			name:      "create new directory",
-			createNew: true,
-			wantErr:   false,
-		},
-		{
-			name:      "create existing directory",
-			createNew: false,
-			wantErr:   false,
-		},
+// writeConfigFile writes content to a config file with the given name in a temporary directory.
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			testPath := filepath.Join(tmpDir, "test_dir")
-
-			// For existing directory test, create it first
-			if !tt.createNew {
-				err := os.Mkdir(testPath, os.ModePerm)
-				if err != nil {
-					t.Fatalf("Failed to setup test: %v", err)
-				}
-			}
+	return path
+}
 
-			err := createDir(testPath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("createDir() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+const testConfigYAML = `
+domain: registry.example.com
+output: public
+key: release
+keys:
+  release:
+    fingerprint: AAAA
+    public_key_file: release.asc
+    private_key_file: release-private.asc
+  partner:
+    fingerprint: BBBB
+    public_key_file: partner.asc
+namespaces:
+  example-org:
+    providers:
+      example: {}
+      other:
+        repo: tf-other
+        dist: other/dist
+        protocols: ["6.0"]
+  partner-org:
+    key: partner
+    providers:
+      partner: {}
+`
+
+// TestParseFlags tests that command line flags are mapped onto settings.
+func TestParseFlags(t *testing.T) {
+	args := []string{
+		"-ns", "example-org",
+		"-d", "registry.example.com",
+		"-p", "example",
+		"-r", "terraform-provider-example",
+		"-v", "1.0.0",
+		"-gf", "1234567890ABCDEF",
+		"-allow-new",
+		"-incremental",
+	}
+
+	s, err := parseFlags("tfpp package", args)
+	if err != nil {
+		t.Fatalf("parseFlags() error = %v", err)
+	}
 
-			// Verify directory exists
-			if _, err := os.Stat(testPath); os.IsNotExist(err) && !tt.wantErr {
-				t.Errorf("Directory was not created: %v", testPath)
-			}
-		})
+	if s.Namespace != "example-org" || s.Domain != "registry.example.com" || s.Provider != "example" {
+		t.Errorf("parseFlags() settings = %+v", s)
+	}
+	if s.Dist != "" || s.GPGKeyFile != "" {
+		t.Errorf("parseFlags() unset flags = %q, %q, want empty", s.Dist, s.GPGKeyFile)
+	}
+	if s.AllowNew == nil || !*s.AllowNew || s.Incremental == nil || !*s.Incremental {
+		t.Errorf("parseFlags() AllowNew = %v, Incremental = %v, want true", s.AllowNew, s.Incremental)
 	}
 }
 
-// TestCreateDirRecursive tests the createDirRecursive function.
-func TestCreateDirRecursive(t *testing.T) {
+// TestParseFlagsError tests that unknown flags and positional arguments are rejected.
+func TestParseFlagsError(t *testing.T) {
+	for _, args := range [][]string{{"-unknown"}, {"-p", "example", "extra"}} {
+		_, err := parseFlags("tfpp package", args)
+		if !errors.Is(err, errUsage) {
+			t.Errorf("parseFlags(%v) error = %v, want errUsage", args, err)
+		}
+	}
+}
+
+// TestLoadConfigFile tests loading YAML and JSON config files.
+func TestLoadConfigFile(t *testing.T) {
 	tests := []struct {
-		name    string
-		subpath string
-		wantErr bool
+		name       string
+		file       string
+		content    string
+		wantDomain string
+		wantErr    bool
 	}{
 		{
-			name:    "create nested directories",
-			subpath: "level1/level2/level3",
-			wantErr: false,
+			name:       "yaml",
+			file:       "tfpp.yaml",
+			content:    testConfigYAML,
+			wantDomain: "registry.example.com",
 		},
 		{
-			name:    "create single directory",
-			subpath: "single",
-			wantErr: false,
+			name:       "json",
+			file:       "tfpp.json",
+			content:    `{"domain": "registry.example.com", "namespaces": {"example-org": {"providers": {"example": {}}}}}`,
+			wantDomain: "registry.example.com",
+		},
+		{
+			name:    "empty yaml",
+			file:    "tfpp.yaml",
+			content: "",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			testPath := filepath.Join(tmpDir, tt.subpath)
-
-			err := createDirRecursive(testPath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("createDirRecursive() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			// Verify directory exists
-			if _, err := os.Stat(testPath); os.IsNotExist(err) && !tt.wantErr {
-				t.Errorf("Directory was not created: %v", testPath)
-			}
-		})
-	}
-}
-
-// TestDeleteDir tests the deleteDir function.
-func TestDeleteDir(t *testing.T) {
-	tests := []struct {
-		name      string
-		createDir bool
-		wantErr   bool
-	}{
 		{
-			name:      "delete existing directory",
-			createDir: true,
-			wantErr:   false,
+			name:    "unknown yaml field",
+			file:    "tfpp.yaml",
+			content: "domian: registry.example.com\n",
+			wantErr: true,
 		},
 		{
-			name:      "delete non-existing directory",
-			createDir: false,
-			wantErr:   false,
+			name:    "unknown json field",
+			file:    "tfpp.json",
+			content: `{"domian": "registry.example.com"}`,
+			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			testPath := filepath.Join(tmpDir, "test_delete")
-
-			// Setup: create directory if needed
-			if tt.createDir {
-				if err := os.MkdirAll(testPath, os.ModePerm); err != nil {
-					t.Fatalf("Failed to setup test: %v", err)
-				}
-			}
+			path := writeConfigFile(t, tt.file, tt.content)
 
-			err := deleteDir(testPath)
+			cfg, err := loadConfigFile(path)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("deleteDir() error = %v, wantErr %v", err, tt.wantErr)
-				return
+				t.Fatalf("loadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
-
-			// Verify directory doesn't exist
-			if _, err := os.Stat(testPath); !os.IsNotExist(err) && !tt.wantErr {
-				t.Errorf("Directory was not deleted: %v", testPath)
+			if cfg.Domain != tt.wantDomain {
+				t.Errorf("loadConfigFile() domain = %q, want %q", cfg.Domain, tt.wantDomain)
 			}
 		})
 	}
 }
 
-// TestCopyFile tests the copyFile function.
-func TestCopyFile(t *testing.T) {
+// TestFileConfigSettings tests provider selection and key resolution in a config file.
+func TestFileConfigSettings(t *testing.T) {
+	cfg, err := loadConfigFile(writeConfigFile(t, "tfpp.yaml", testConfigYAML))
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
 	tests := []struct {
-		name      string
-		content   string
-		setupErr  bool
-		wantErr   bool
-		errString string
+		name            string
+		namespace       string
+		provider        string
+		wantNamespace   string
+		wantRepo        string
+		wantDist        string
+		wantFingerprint string
+		wantProtocols   string
+		wantErr         bool
 	}{
 		{
-			name:    "copy regular file",
-			content: "test content\nline 2\nline 3",
-			wantErr: false,
+			name:            "default repo and top-level key",
+			namespace:       "example-org",
+			provider:        "example",
+			wantNamespace:   "example-org",
+			wantRepo:        "terraform-provider-example",
+			wantFingerprint: "AAAA",
 		},
 		{
-			name:      "copy non-existing file",
-			content:   "",
-			setupErr:  true,
-			wantErr:   true,
-			errString: "no such file or directory",
+			name:            "provider overrides",
+			provider:        "other",
+			wantNamespace:   "example-org",
+			wantRepo:        "tf-other",
+			wantDist:        "other/dist",
+			wantFingerprint: "AAAA",
+			wantProtocols:   "6.0",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			srcPath := filepath.Join(tmpDir, "src.txt")
-			dstPath := filepath.Join(tmpDir, "dst.txt")
-
-			// Setup: create source file
-			if !tt.setupErr {
-				err := os.WriteFile(srcPath, []byte(tt.content), 0644)
-				if err != nil {
-					t.Fatalf("Failed to setup test: %v", err)
-				}
-			}
-
-			err := copyFile(srcPath, dstPath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("copyFile() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if tt.wantErr && err != nil && tt.errString != "" {
-				if !strings.Contains(err.Error(), tt.errString) {
-					t.Errorf("Expected error containing %q, got %q", tt.errString, err.Error())
-				}
-				return
-			}
-
-			if !tt.wantErr {
-				// Verify file was copied correctly
-				content, err := os.ReadFile(dstPath)
-				if err != nil {
-					t.Errorf("Failed to read destination file: %v", err)
-					return
-				}
-				if string(content) != tt.content {
-					t.Errorf("File content mismatch. Got %q, want %q", string(content), tt.content)
-				}
-			}
-		})
-	}
-}
-
-// TestReadFile tests the readFile function.
-func TestReadFile(t *testing.T) {
-	tests := []struct {
-		name    string
-		content string
-		want    []string
-		wantErr bool
-	}{
 		{
-			name:    "read multi-line file",
-			content: "line 1\nline 2\nline 3",
-			want:    []string{"line 1", "line 2", "line 3"},
-			wantErr: false,
+			name:            "namespace key",
+			namespace:       "partner-org",
+			wantNamespace:   "partner-org",
+			wantRepo:        "terraform-provider-partner",
+			wantFingerprint: "BBBB",
 		},
 		{
-			name:    "read empty file",
-			content: "",
-			want:    []string{},
-			wantErr: false,
+			name:            "provider not in file",
+			namespace:       "example-org",
+			provider:        "unknown",
+			wantNamespace:   "example-org",
+			wantFingerprint: "AAAA",
 		},
 		{
-			name:    "read single line file",
-			content: "single line",
-			want:    []string{"single line"},
-			wantErr: false,
+			name:      "ambiguous selection",
+			namespace: "example-org",
+			wantErr:   true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			filePath := filepath.Join(tmpDir, "test_file.txt")
-
-			// Setup: create file with content
-			err := os.WriteFile(filePath, []byte(tt.content), 0644)
-			if err != nil {
-				t.Fatalf("Failed to setup test: %v", err)
-			}
-
-			got, err := readFile(filePath)
+			s, err := cfg.settings(tt.namespace, tt.provider)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("readFile() error = %v, wantErr %v", err, tt.wantErr)
-				return
+				t.Fatalf("settings() error = %v, wantErr %v", err, tt.wantErr)
 			}
-
-			if len(got) != len(tt.want) {
-				t.Errorf("readFile() returned %d lines, want %d lines", len(got), len(tt.want))
+			if tt.wantErr {
 				return
 			}
 
-			for i, line := range got {
-				if line != tt.want[i] {
-					t.Errorf("readFile() line %d = %q, want %q", i, line, tt.want[i])
-				}
+			if s.Namespace != tt.wantNamespace || s.Repo != tt.wantRepo || s.Dist != tt.wantDist || s.GPGFingerprint != tt.wantFingerprint || s.Protocols != tt.wantProtocols {
+				t.Errorf("settings() = %+v", s)
+			}
+			if s.Domain != "registry.example.com" || s.Output != "public" {
+				t.Errorf("settings() top-level values = %q, %q", s.Domain, s.Output)
 			}
 		})
 	}
 }
 
-// TestReadFileError tests the readFile function with non-existing file.
-func TestReadFileError(t *testing.T) {
-	tmpDir := t.TempDir()
-	nonExistentPath := filepath.Join(tmpDir, "non_existing_file.txt")
-	_, err := readFile(nonExistentPath)
-	if err == nil {
-		t.Error("readFile() expected error for non-existing file, got nil")
+// TestFileConfigSettingsLogin tests the login.v1 and token file settings of the config file.
+func TestFileConfigSettingsLogin(t *testing.T) {
+	content := `
+domain: registry.example.com
+token_file: tokens.yaml
+login:
+  grant_types: [authz_code]
+  authz: https://sso.example.com/authorize
+  token: https://sso.example.com/token
+  ports: [10000, 10010]
+`
+	cfg, err := loadConfigFile(writeConfigFile(t, "tfpp.yaml", content))
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
+	s, err := cfg.settings("example-org", "example")
+	if err != nil {
+		t.Fatalf("settings() error = %v", err)
+	}
+	if s.TokenFile != "tokens.yaml" {
+		t.Errorf("settings() TokenFile = %q, want tokens.yaml", s.TokenFile)
+	}
+
+	packagerCfg, _ := s.packagerConfig()
+	login := packagerCfg.Login
+	if login == nil || login.Client != "terraform-cli" || login.Token != "https://sso.example.com/token" || !slices.Equal(login.Ports, []int{10000, 10010}) {
+		t.Errorf("packagerConfig() Login = %+v", login)
 	}
 }
 
-// TestWriteFile tests the writeFile function.
-func TestWriteFile(t *testing.T) {
-	tests := []struct {
-		name    string
-		content []byte
-		wantErr bool
-	}{
-		{
-			name:    "write text content",
-			content: []byte("test content"),
-			wantErr: false,
-		},
-		{
-			name:    "write empty content",
-			content: []byte(""),
-			wantErr: false,
-		},
-		{
-			name:    "write JSON content",
-			content: []byte(`{"key": "value"}`),
-			wantErr: false,
-		},
+// TestFileConfigSettingsPlatforms tests the platform lists of the config file, overridden by a
+// provider and by the environment.
+func TestFileConfigSettingsPlatforms(t *testing.T) {
+	content := `
+domain: registry.example.com
+platforms: ["linux_*", "darwin_*"]
+required_platforms: [linux_amd64]
+namespaces:
+  example-org:
+    providers:
+      example:
+        required_platforms: [linux_amd64, darwin_arm64]
+`
+	t.Setenv("TFPP_CONFIG", writeConfigFile(t, "tfpp.yaml", content))
+	t.Setenv("TFPP_EXCLUDE_PLATFORMS", "linux_386, linux_arm")
+
+	s, err := resolveSettings(settings{})
+	if err != nil {
+		t.Fatalf("resolveSettings() error = %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			filePath := filepath.Join(tmpDir, "test_file.txt")
+	cfg, _ := s.packagerConfig()
+	if !slices.Equal(cfg.Platforms, []string{"linux_*", "darwin_*"}) {
+		t.Errorf("packagerConfig() Platforms = %q", cfg.Platforms)
+	}
+	if !slices.Equal(cfg.ExcludePlatforms, []string{"linux_386", "linux_arm"}) {
+		t.Errorf("packagerConfig() ExcludePlatforms = %q", cfg.ExcludePlatforms)
+	}
+	if !slices.Equal(cfg.RequiredPlatforms, []string{"linux_amd64", "darwin_arm64"}) {
+		t.Errorf("packagerConfig() RequiredPlatforms = %q", cfg.RequiredPlatforms)
+	}
+}
 
-			err := writeFile(filePath, tt.content)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("writeFile() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+// TestFileConfigSettingsUndefinedKey tests that referencing an undefined key is an error.
+func TestFileConfigSettingsUndefinedKey(t *testing.T) {
+	cfg := fileConfig{
+		Namespaces: map[string]namespaceConfig{
+			"example-org": {Key: "missing", Providers: map[string]providerConfig{"example": {}}},
+		},
+	}
 
-			// Verify file was written correctly
-			content, err := os.ReadFile(filePath)
-			if err != nil {
-				t.Errorf("Failed to read written file: %v", err)
-				return
-			}
-			if string(content) != string(tt.content) {
-				t.Errorf("File content mismatch. Got %q, want %q", string(content), string(tt.content))
-			}
-		})
+	if _, err := cfg.settings("", ""); err == nil {
+		t.Error("settings() expected error for undefined key, got nil")
 	}
 }
 
-// TestGetShaSumContents tests the getShaSumContents function.
-func TestGetShaSumContents(t *testing.T) {
+// TestFileConfigSettingsKeySet tests resolving the signing key and the published key set.
+func TestFileConfigSettingsKeySet(t *testing.T) {
+	cfg, err := loadConfigFile(writeConfigFile(t, "tfpp.yaml", `
+key: current
+key_set: [current, next]
+keys:
+  current:
+    fingerprint: AAAA
+    public_key_file: current.asc
+    source: Example Org
+    source_url: https://example.com/security
+  next:
+    fingerprint: BBBB
+    public_key_file: next.asc
+    trust_signature_file: next.trust.asc
+namespaces:
+  example-org:
+    providers:
+      example: {}
+      rotated:
+        key: next
+      single:
+        key_set: []
+`))
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
+	current := packager.SigningKey{KeyID: "AAAA", PublicKeyFile: "current.asc", Source: "Example Org", SourceURL: "https://example.com/security"}
+	next := packager.SigningKey{KeyID: "BBBB", PublicKeyFile: "next.asc", TrustSignatureFile: "next.trust.asc"}
+
 	tests := []struct {
-		name    string
-		content string
-		want    [][]string
-		wantErr bool
+		provider        string
+		wantFingerprint string
+		wantSigningKeys []packager.SigningKey
 	}{
 		{
-			name: "parse valid SHA256SUMS",
-			content: "abc123  terraform-provider-example_1.0.0_linux_amd64.zip\n" +
-				"def456  terraform-provider-example_1.0.0_darwin_amd64.zip\n" +
-				"ghi789  terraform-provider-example_1.0.0_windows_amd64.zip",
-			want: [][]string{
-				{"abc123", "terraform-provider-example_1.0.0_linux_amd64.zip"},
-				{"def456", "terraform-provider-example_1.0.0_darwin_amd64.zip"},
-				{"ghi789", "terraform-provider-example_1.0.0_windows_amd64.zip"},
-			},
-			wantErr: false,
+			provider:        "example",
+			wantFingerprint: "AAAA",
+			wantSigningKeys: []packager.SigningKey{current, next},
+		},
+		{
+			provider:        "rotated",
+			wantFingerprint: "BBBB",
+			wantSigningKeys: []packager.SigningKey{next, current},
 		},
 		{
-			name:    "parse single entry",
-			content: "abc123  terraform-provider-example_1.0.0_linux_amd64.zip",
-			want: [][]string{
-				{"abc123", "terraform-provider-example_1.0.0_linux_amd64.zip"},
-			},
-			wantErr: false,
+			provider:        "single",
+			wantFingerprint: "AAAA",
+			wantSigningKeys: []packager.SigningKey{current},
 		},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Setup test directory and file
-			tmpDir := t.TempDir()
-			repoName := "terraform-provider-example"
-			version := "1.0.0"
-			shaSumFileName := repoName + "_" + version + "_SHA256SUMS"
-
-			shaSumPath := filepath.Join(tmpDir, shaSumFileName)
-			err := os.WriteFile(shaSumPath, []byte(tt.content), 0644)
+		t.Run(tt.provider, func(t *testing.T) {
+			s, err := cfg.settings("example-org", tt.provider)
 			if err != nil {
-				t.Fatalf("Failed to setup test: %v", err)
+				t.Fatalf("settings() error = %v", err)
 			}
-
-			got, err := getShaSumContents(tmpDir, repoName, version)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("getShaSumContents() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			if s.GPGFingerprint != tt.wantFingerprint {
+				t.Errorf("settings() GPGFingerprint = %q, want %q", s.GPGFingerprint, tt.wantFingerprint)
 			}
 
-			if len(got) != len(tt.want) {
-				t.Errorf("getShaSumContents() returned %d entries, want %d entries", len(got), len(tt.want))
-				return
-			}
-
-			for i, entry := range got {
-				if len(entry) != 2 {
-					t.Errorf("Entry %d has %d elements, want 2", i, len(entry))
-					continue
-				}
-				if entry[0] != tt.want[i][0] || entry[1] != tt.want[i][1] {
-					t.Errorf("Entry %d = %v, want %v", i, entry, tt.want[i])
-				}
+			pcfg, _ := s.packagerConfig()
+			if !slices.Equal(pcfg.SigningKeys, tt.wantSigningKeys) {
+				t.Errorf("packagerConfig() SigningKeys = %+v, want %+v", pcfg.SigningKeys, tt.wantSigningKeys)
 			}
 		})
 	}
-}
 
-// TestGetShaSumContentsError tests error case for getShaSumContents.
-func TestGetShaSumContentsError(t *testing.T) {
-	tmpDir := t.TempDir()
-	_, err := getShaSumContents(tmpDir, "nonexistent-repo", "1.0.0")
-	if err == nil {
-		t.Error("getShaSumContents() expected error for non-existing file, got nil")
-	}
-}
-
-// TestPlatformJSON tests Platform struct JSON marshalling.
-func TestPlatformJSON(t *testing.T) {
-	platform := Platform{
-		Os:   "linux",
-		Arch: "amd64",
-	}
-
-	data, err := json.Marshal(platform)
+	s, err := cfg.settings("example-org", "example")
 	if err != nil {
-		t.Fatalf("Failed to marshal Platform: %v", err)
+		t.Fatalf("settings() error = %v", err)
 	}
-
-	var decoded Platform
-	err = json.Unmarshal(data, &decoded)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal Platform: %v", err)
+	s.merge(settings{GPGKeyFile: "override.asc"})
+	pcfg, _ := s.packagerConfig()
+	if pcfg.SigningKeys[0].PublicKeyFile != "override.asc" || pcfg.SigningKeys[0].Source != "Example Org" || pcfg.SigningKeys[1] != next {
+		t.Errorf("packagerConfig() with -gk = %+v, want the overridden public key file first", pcfg.SigningKeys)
 	}
 
-	if decoded.Os != platform.Os || decoded.Arch != platform.Arch {
-		t.Errorf("Platform mismatch after marshal/unmarshal. Got %+v, want %+v", decoded, platform)
+	cfg.KeySet = []string{"current", "missing"}
+	if _, err := cfg.settings("example-org", "example"); err == nil {
+		t.Error("settings() expected error for undefined key in key_set, got nil")
 	}
 }
 
-// TestVersionJSON tests Version struct JSON marshalling.
-func TestVersionJSON(t *testing.T) {
-	version := Version{
-		Version:   "1.0.0",
-		Protocols: []string{"4.0", "5.0", "5.1"},
-		Platforms: []Platform{
-			{Os: "linux", Arch: "amd64"},
-			{Os: "darwin", Arch: "amd64"},
-		},
-	}
-
-	data, err := json.Marshal(version)
+// TestResolveSettings tests that flags override environment variables, which override the config file.
+func TestResolveSettings(t *testing.T) {
+	path := writeConfigFile(t, "tfpp.yaml", testConfigYAML)
+
+	t.Setenv("TFPP_CONFIG", path)
+	t.Setenv("TFPP_PROVIDER", "example")
+	t.Setenv("TFPP_VERSION", "1.0.0")
+	t.Setenv("TFPP_DOMAIN", "env.example.com")
+	t.Setenv("TFPP_OUTPUT", "env-output")
+	t.Setenv("TFPP_ALLOW_NEW", "true")
+	t.Setenv("TFPP_PROTOCOLS", "5.0, 5.1")
+	t.Setenv("TFPP_INCREMENTAL", "1")
+	t.Setenv("TFPP_JOBS", "4")
+	t.Setenv("TFPP_LINK_MODE", "hardlink")
+
+	s, err := resolveSettings(settings{Output: "flag-output"})
 	if err != nil {
-		t.Fatalf("Failed to marshal Version: %v", err)
+		t.Fatalf("resolveSettings() error = %v", err)
 	}
 
-	var decoded Version
-	err = json.Unmarshal(data, &decoded)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal Version: %v", err)
+	if s.Namespace != "example-org" || s.Repo != "terraform-provider-example" || s.GPGFingerprint != "AAAA" {
+		t.Errorf("resolveSettings() config file values = %+v", s)
 	}
-
-	if decoded.Version != version.Version {
-		t.Errorf("Version mismatch. Got %v, want %v", decoded.Version, version.Version)
+	if s.Domain != "env.example.com" || s.Version != "1.0.0" {
+		t.Errorf("resolveSettings() environment values = %q, %q", s.Domain, s.Version)
 	}
-	if len(decoded.Protocols) != len(version.Protocols) {
-		t.Errorf("Protocols length mismatch. Got %d, want %d", len(decoded.Protocols), len(version.Protocols))
+	if s.Output != "flag-output" {
+		t.Errorf("resolveSettings() output = %q, want flag-output", s.Output)
 	}
-	if len(decoded.Platforms) != len(version.Platforms) {
-		t.Errorf("Platforms length mismatch. Got %d, want %d", len(decoded.Platforms), len(version.Platforms))
+	if s.AllowNew == nil || !*s.AllowNew {
+		t.Errorf("resolveSettings() AllowNew = %v, want true", s.AllowNew)
 	}
-}
 
-// TestVersionsJSON tests Versions struct JSON marshalling.
-func TestVersionsJSON(t *testing.T) {
-	versions := Versions{
-		Versions: []Version{
-			{
-				Version:   "1.0.0",
-				Protocols: []string{"4.0", "5.1"},
-				Platforms: []Platform{{Os: "linux", Arch: "amd64"}},
-			},
-			{
-				Version:   "1.1.0",
-				Protocols: []string{"5.0", "5.1"},
-				Platforms: []Platform{{Os: "darwin", Arch: "arm64"}},
-			},
-		},
+	cfg, opts := s.packagerConfig()
+	if cfg.RepoName != "terraform-provider-example" || cfg.GPGPubKeyFile != "release.asc" || cfg.GPGPrivateKeyFile != "release-private.asc" || len(opts) != 1 {
+		t.Errorf("packagerConfig() = %+v, %d options", cfg, len(opts))
 	}
-
-	data, err := json.Marshal(versions)
-	if err != nil {
-		t.Fatalf("Failed to marshal Versions: %v", err)
+	if !cfg.Incremental {
+		t.Error("packagerConfig() Incremental = false, want true")
 	}
-
-	var decoded Versions
-	err = json.Unmarshal(data, &decoded)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal Versions: %v", err)
+	if cfg.Jobs != 4 || cfg.LinkMode != packager.LinkHardlink {
+		t.Errorf("packagerConfig() Jobs = %d, LinkMode = %q, want 4 and hardlink", cfg.Jobs, cfg.LinkMode)
 	}
-
-	if len(decoded.Versions) != len(versions.Versions) {
-		t.Errorf("Versions length mismatch. Got %d, want %d", len(decoded.Versions), len(versions.Versions))
+	if !slices.Equal(cfg.Protocols, []string{"5.0", "5.1"}) {
+		t.Errorf("packagerConfig() protocols = %q, want [5.0 5.1]", cfg.Protocols)
 	}
 }
 
-// TestWellKnownJSON tests WellKnown struct JSON marshalling.
-func TestWellKnownJSON(t *testing.T) {
-	wellKnown := WellKnown{
-		ProvidersV1: "/v1/providers/",
-		ModulesV1:   "/v1/modules/",
-	}
+// TestResolveModuleSettings tests that the module command only takes the top-level values of the
+// config file, so that a namespace with several providers does not need a provider selection.
+func TestResolveModuleSettings(t *testing.T) {
+	path := writeConfigFile(t, "tfpp.yaml", testConfigYAML)
+
+	t.Setenv("TFPP_CONFIG", path)
+	t.Setenv("TFPP_MODULE_SYSTEM", "aws")
+	t.Setenv("TFPP_INCREMENTAL", "true")
 
-	data, err := json.Marshal(wellKnown)
+	flagSettings, err := parseModuleFlags([]string{"-ns", "example-org", "-name", "network", "-git-ref", "v1.2.0", "-src", "modules/network"})
 	if err != nil {
-		t.Fatalf("Failed to marshal WellKnown: %v", err)
+		t.Fatalf("parseModuleFlags() error = %v", err)
 	}
 
-	var decoded WellKnown
-	err = json.Unmarshal(data, &decoded)
+	s, err := resolveModuleSettings(flagSettings)
 	if err != nil {
-		t.Fatalf("Failed to unmarshal WellKnown: %v", err)
+		t.Fatalf("resolveModuleSettings() error = %v", err)
 	}
 
-	if decoded.ProvidersV1 != wellKnown.ProvidersV1 || decoded.ModulesV1 != wellKnown.ModulesV1 {
-		t.Errorf("WellKnown mismatch. Got %+v, want %+v", decoded, wellKnown)
+	cfg, opts := s.moduleConfig()
+	want := packager.ModuleConfig{
+		Namespace:   "example-org",
+		Domain:      "registry.example.com",
+		Name:        "network",
+		System:      "aws",
+		SourceDir:   "modules/network",
+		GitRef:      "v1.2.0",
+		OutputDir:   "public",
+		Incremental: true,
 	}
-}
-
-// TestArchitectureJSON tests Architecture struct JSON marshalling.
-func TestArchitectureJSON(t *testing.T) {
-	architecture := Architecture{
-		Protocols:           []string{"4.0", "5.1"},
-		Os:                  "linux",
-		Arch:                "amd64",
-		Filename:            "terraform-provider-example_1.0.0_linux_amd64.zip",
-		DownloadUrl:         "https://example.com/download/terraform-provider-example_1.0.0_linux_amd64.zip",
-		ShasumsUrl:          "https://example.com/SHA256SUMS",
-		ShasumsSignatureUrl: "https://example.com/SHA256SUMS.sig",
-		Shasum:              "abc123def456",
+	if cfg != want || len(opts) != 0 {
+		t.Errorf("moduleConfig() = %+v, %d options, want %+v", cfg, len(opts), want)
 	}
 
-	data, err := json.Marshal(architecture)
-	if err != nil {
-		t.Fatalf("Failed to marshal Architecture: %v", err)
+	if _, err := parseModuleFlags([]string{"-p", "example"}); !errors.Is(err, errUsage) {
+		t.Errorf("parseModuleFlags() with provider flag error = %v, want errUsage", err)
 	}
+}
 
-	var decoded Architecture
-	err = json.Unmarshal(data, &decoded)
-	if err != nil {
-		t.Fatalf("Failed to unmarshal Architecture: %v", err)
-	}
+// TestReadPassphrase tests reading the GPG passphrase from the environment and a file descriptor.
+func TestReadPassphrase(t *testing.T) {
+	t.Setenv("TFPP_GPG_PASSPHRASE", "from env")
 
-	if decoded.Os != architecture.Os {
-		t.Errorf("Os mismatch. Got %v, want %v", decoded.Os, architecture.Os)
+	got, err := readPassphrase(-1)
+	if err != nil || string(got) != "from env" {
+		t.Errorf("readPassphrase(-1) = %q, %v, want \"from env\"", got, err)
 	}
-	if decoded.Arch != architecture.Arch {
-		t.Errorf("Arch mismatch. Got %v, want %v", decoded.Arch, architecture.Arch)
-	}
-	if decoded.Filename != architecture.Filename {
-		t.Errorf("Filename mismatch. Got %v, want %v", decoded.Filename, architecture.Filename)
-	}
-	if decoded.Shasum != architecture.Shasum {
-		t.Errorf("Shasum mismatch. Got %v, want %v", decoded.Shasum, architecture.Shasum)
+
+	got, err = readPassphraseFrom(strings.NewReader("from fd\n"))
+	if err != nil || string(got) != "from fd" {
+		t.Errorf("readPassphraseFrom() = %q, %v, want \"from fd\"", got, err)
 	}
 }
 
-// TestDefaultWellKnownData tests the default well-known data.
-func TestDefaultWellKnownData(t *testing.T) {
-	if defaultWellKnownData.ProvidersV1 != "/v1/providers/" {
-		t.Errorf("ProvidersV1 = %v, want /v1/providers/", defaultWellKnownData.ProvidersV1)
-	}
-	if defaultWellKnownData.ModulesV1 != "/v1/modules/" {
-		t.Errorf("ModulesV1 = %v, want /v1/modules/", defaultWellKnownData.ModulesV1)
+// TestResolveSettingsInvalidEnv tests that an invalid boolean or number environment variable is
+// an error.
+func TestResolveSettingsInvalidEnv(t *testing.T) {
+	for _, name := range []string{"TFPP_ALLOW_NEW", "TFPP_INCREMENTAL", "TFPP_JOBS"} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, "maybe")
+
+			if _, err := resolveSettings(settings{}); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("resolveSettings() error = %v, want error for invalid %s", err, name)
+			}
+		})
 	}
 }
 
-// TestCreateDownloadsDir tests the createDownloadsDir function.
-func TestCreateDownloadsDir(t *testing.T) {
+// TestRun tests subcommand dispatch.
+func TestRun(t *testing.T) {
 	tests := []struct {
 		name    string
-		wantErr bool
+		args    []string
+		wantErr error
 	}{
 		{
-			name:    "create downloads directory",
-			wantErr: false,
+			name:    "no arguments",
+			args:    nil,
+			wantErr: errUsage,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"publish"},
+			wantErr: errUsage,
+		},
+		{
+			name: "help",
+			args: []string{"help"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			basePath := filepath.Join(tmpDir, "base") + "/"
-
-			// Create base directory first
-			if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup test: %v", err)
-			}
-
-			downloadPath, err := createDownloadsDir(basePath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("createDownloadsDir() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-
-			if !tt.wantErr {
-				// Verify download directory was created
-				if downloadPath == nil {
-					t.Error("createDownloadsDir() returned nil downloadPath")
-					return
-				}
-				expectedPath := basePath + "download/"
-				if *downloadPath != expectedPath {
-					t.Errorf("createDownloadsDir() path = %v, want %v", *downloadPath, expectedPath)
-				}
-				if _, err := os.Stat(*downloadPath); os.IsNotExist(err) {
-					t.Errorf("Download directory was not created: %v", *downloadPath)
-				}
+			err := run(context.Background(), tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("run() error = %v, want %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-// TestCreateTargetDirs tests the createTargetDirs function.
-func TestCreateTargetDirs(t *testing.T) {
-	tests := []struct {
-		name    string
-		wantErr bool
-	}{
-		{
-			name:    "create target directories",
-			wantErr: false,
-		},
+// writeTestDist writes a dist directory with a single linux_amd64 zip and its SHA256SUMS, and
+// returns the name and SHA256 of the zip.
+func writeTestDist(t *testing.T) (string, string) {
+	t.Helper()
+
+	if err := os.MkdirAll("dist", os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+	zipName := "terraform-provider-example_1.0.0_linux_amd64.zip"
+	zipFile, err := os.Create(filepath.Join("dist", zipName))
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	w := zip.NewWriter(zipFile)
+	f, err := w.Create("terraform-provider-example_v1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	// The ELF header of a linux_amd64 executable, enough for the binary inspection.
+	header := elf.Header64{Type: uint16(elf.ET_EXEC), Machine: uint16(elf.EM_X86_64), Version: uint32(elf.EV_CURRENT), Ehsize: 64}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if err := binary.Write(f, binary.LittleEndian, header); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+	w.Close()
+	zipFile.Close()
+	content, err := os.ReadFile(filepath.Join("dist", zipName))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	shasum := hex.EncodeToString(sum[:])
+	shaSumContent := shasum + "  " + zipName + "\n"
+	if err := os.WriteFile("dist/terraform-provider-example_1.0.0_SHA256SUMS", []byte(shaSumContent), 0644); err != nil {
+		t.Fatalf("Failed to create SHA256SUMS: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			basePath := filepath.Join(tmpDir, "downloads") + "/"
+	return zipName, shasum
+}
 
-			// Create base directory first
-			if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup test: %v", err)
-			}
+// TestRunNetworkMirror tests the mirror-net command on a minimal dist directory.
+func TestRunNetworkMirror(t *testing.T) {
+	t.Chdir(t.TempDir())
+	zipName, _ := writeTestDist(t)
 
-			err := createTargetDirs(basePath)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("createTargetDirs() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+	args := []string{"mirror-net", "-ns", "example-org", "-d", "registry.example.com", "-p", "example", "-r", "terraform-provider-example", "-v", "1.0.0"}
+	if err := run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
 
-			if !tt.wantErr {
-				// Verify all target directories were created
-				targets := []string{"darwin", "freebsd", "linux", "windows"}
-				for _, target := range targets {
-					targetPath := basePath + target
-					if _, err := os.Stat(targetPath); os.IsNotExist(err) {
-						t.Errorf("Target directory %s was not created", target)
-					}
-				}
-			}
-		})
+	for _, file := range []string{"index.json", "1.0.0.json", zipName} {
+		if _, err := os.Stat(filepath.Join("mirror/registry.example.com/example-org/example", file)); err != nil {
+			t.Errorf("Expected mirror file %s: %v", file, err)
+		}
+	}
+	if _, err := os.Stat("release"); !os.IsNotExist(err) {
+		t.Error("mirror-net must not write the registry tree")
 	}
 }
 
-// TestCopyShaFiles tests the copyShaFiles function.
-func TestCopyShaFiles(t *testing.T) {
-	tests := []struct {
-		name      string
-		repoName  string
-		version   string
-		createSig bool
-		wantPanic bool
-	}{
-		{
-			name:      "copy SHA files with signature",
-			repoName:  "terraform-provider-example",
-			version:   "1.0.0",
-			createSig: true,
-			wantPanic: false,
-		},
-	}
+// TestRunFilesystemMirror tests the mirror-fs command with the unpacked layout.
+func TestRunFilesystemMirror(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestDist(t)
+	t.Setenv("TFPP_FS_LAYOUT", "unpacked")
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			srcPath := filepath.Join(tmpDir, "src")
-			destPath := filepath.Join(tmpDir, "dest") + "/"
+	args := []string{"mirror-fs", "-ns", "example-org", "-d", "registry.example.com", "-p", "example", "-r", "terraform-provider-example", "-v", "1.0.0", "-fs-mirror", "plugins"}
+	if err := run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
 
-			// Setup source and destination directories
-			if err := os.MkdirAll(srcPath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup src: %v", err)
-			}
-			if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup dest: %v", err)
-			}
+	binary := "plugins/registry.example.com/example-org/example/1.0.0/linux_amd64/terraform-provider-example_v1.0.0"
+	if _, err := os.Stat(binary); err != nil {
+		t.Errorf("Expected unpacked provider binary: %v", err)
+	}
+}
 
-			// Create SHA256SUMS file
-			shaSum := tt.repoName + "_" + tt.version + "_SHA256SUMS"
-			shaSumPath := filepath.Join(srcPath, shaSum)
-			if err := os.WriteFile(shaSumPath, []byte("test content"), 0644); err != nil {
-				t.Fatalf("Failed to create SHA256SUMS: %v", err)
-			}
+// TestRunLock tests that the lock command prints a provider block computed from the dist directory.
+func TestRunLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, shasum := writeTestDist(t)
 
-			// Create signature file
-			if tt.createSig {
-				sigPath := shaSumPath + ".sig"
-				if err := os.WriteFile(sigPath, []byte("signature"), 0644); err != nil {
-					t.Fatalf("Failed to create signature: %v", err)
-				}
-			}
+	var out strings.Builder
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
 
-			// Test function - note it uses log.Fatal on error
-			if tt.wantPanic {
-				defer func() {
-					if r := recover(); r == nil {
-						t.Errorf("copyShaFiles() expected panic but didn't panic")
-					}
-				}()
-			}
+	args := []string{"lock", "-from-dist", "-ns", "example-org", "-d", "registry.example.com", "-p", "example", "-r", "terraform-provider-example", "-v", "1.0.0"}
+	if err := run(context.Background(), args); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
 
-			copyShaFiles(destPath, srcPath, tt.repoName, tt.version)
-
-			if !tt.wantPanic {
-				// Verify files were copied
-				destShaPath := filepath.Join(destPath, shaSum)
-				if _, err := os.Stat(destShaPath); os.IsNotExist(err) {
-					t.Error("SHA256SUMS file was not copied")
-				}
-
-				if tt.createSig {
-					destSigPath := destShaPath + ".sig"
-					if _, err := os.Stat(destSigPath); os.IsNotExist(err) {
-						t.Error("Signature file was not copied")
-					}
-				}
-			}
-		})
+	got := out.String()
+	for _, want := range []string{`provider "registry.example.com/example-org/example" {`, `version = "1.0.0"`, `"h1:`, `"zh:` + shasum + `",`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("lock output is missing %q:\n%s", want, got)
+		}
 	}
 }
 
-// TestCopyBuildZips tests the copyBuildZips function.
-func TestCopyBuildZips(t *testing.T) {
-	tests := []struct {
-		name     string
-		zipFiles []string
-		wantErr  bool
-	}{
-		{
-			name: "copy valid zip files",
-			zipFiles: []string{
-				"terraform-provider-example_1.0.0_linux_amd64.zip",
-				"terraform-provider-example_1.0.0_darwin_amd64.zip",
-			},
-			wantErr: false,
-		},
-		{
-			name: "skip non-zip files",
-			zipFiles: []string{
-				"terraform-provider-example_1.0.0_linux_amd64.zip",
-				"terraform-provider-example_1.0.0_linux_amd64.txt",
-			},
-			wantErr: false,
-		},
+// TestRunVerify tests that the verify command prints the problems of a release tree as JSON.
+func TestRunVerify(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("release", os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			distPath := filepath.Join(tmpDir, "dist") + "/"
-			destPath := filepath.Join(tmpDir, "dest") + "/"
-			repoName := "terraform-provider-example"
-			version := "1.0.0"
-
-			// Setup directories
-			if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup dist: %v", err)
-			}
-			if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup dest: %v", err)
-			}
+	var out strings.Builder
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
 
-			// Create SHA256SUMS file
-			shaSumContent := ""
-			for _, zipFile := range tt.zipFiles {
-				shaSumContent += "abc123  " + zipFile + "\n"
-				// Create zip files
-				zipPath := filepath.Join(distPath, zipFile)
-				if err := os.WriteFile(zipPath, []byte("zip content"), 0644); err != nil {
-					t.Fatalf("Failed to create zip file: %v", err)
-				}
-			}
-			shaSumPath := filepath.Join(distPath, repoName+"_"+version+"_SHA256SUMS")
-			if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
-				t.Fatalf("Failed to create SHA256SUMS: %v", err)
-			}
+	err := run(context.Background(), []string{"verify", "release"})
+	if !errors.Is(err, errProblems) {
+		t.Fatalf("run() error = %v, want %v", err, errProblems)
+	}
 
-			err := copyBuildZips(destPath, distPath, repoName, version)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("copyBuildZips() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+	var problems []packager.Problem
+	if err := json.Unmarshal([]byte(out.String()), &problems); err != nil {
+		t.Fatalf("Failed to parse output %q: %v", out.String(), err)
+	}
+	if len(problems) == 0 {
+		t.Error("Expected problems for an empty release tree")
+	}
 
-			if !tt.wantErr {
-				// Verify zip files were copied
-				for _, zipFile := range tt.zipFiles {
-					if strings.HasSuffix(zipFile, ".zip") {
-						destZipPath := filepath.Join(destPath, zipFile)
-						if _, err := os.Stat(destZipPath); os.IsNotExist(err) {
-							t.Errorf("Zip file %s was not copied", zipFile)
-						}
-					}
-				}
-			}
-		})
+	for _, args := range [][]string{{"verify", "a", "b"}, {"verify", "-format", "xml"}} {
+		if err := run(context.Background(), args); !errors.Is(err, errUsage) {
+			t.Errorf("run(%v) error = %v, want %v", args, err, errUsage)
+		}
 	}
 }
 
-// TestProviderDirs tests the providerDirs function.
-func TestProviderDirs(t *testing.T) {
-	tests := []struct {
-		name          string
-		namespace     string
-		repoName      string
-		version       string
-		wellKnownData WellKnown
-	}{
-		{
-			name:      "create provider directory structure",
-			namespace: "example-org",
-			repoName:  "terraform-provider-example",
-			version:   "1.0.0",
-			wellKnownData: WellKnown{
-				ProvidersV1: "providers",
-				ModulesV1:   "modules",
-			},
-		},
-	}
+// TestRunCheck tests that the check command reports a registry without service discovery.
+func TestRunCheck(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Change to temp directory for test
-			tmpDir := t.TempDir()
-			t.Chdir(tmpDir)
+	var out strings.Builder
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
 
-			resultPath := providerDirs(tt.namespace, tt.repoName, tt.version, tt.wellKnownData)
-
-			// Verify the returned path
-			expectedPath := "release/" + tt.wellKnownData.ProvidersV1 + "/" + tt.namespace + "/" + tt.repoName + "/" + tt.version + "/"
-			if resultPath != expectedPath {
-				t.Errorf("providerDirs() path = %v, want %v", resultPath, expectedPath)
-			}
+	err := run(context.Background(), []string{"check", server.URL + "/example-org/example"})
+	if !errors.Is(err, errProblems) {
+		t.Fatalf("run() error = %v, want %v", err, errProblems)
+	}
+	if want := server.URL + "/.well-known/terraform.json: not found"; !strings.Contains(out.String(), want) {
+		t.Errorf("check output = %q, want %q", out.String(), want)
+	}
 
-			// Verify directory structure was created
-			if _, err := os.Stat(resultPath); os.IsNotExist(err) {
-				t.Errorf("Provider directory structure was not created: %v", resultPath)
-			}
-		})
+	for _, args := range [][]string{{"check"}, {"check", "-format", "xml", server.URL + "/example-org/example"}} {
+		if err := run(context.Background(), args); !errors.Is(err, errUsage) {
+			t.Errorf("run(%v) error = %v, want %v", args, err, errUsage)
+		}
 	}
 }
 
-// TestCreateArchitectureFiles tests the createArchitectureFiles function.
-func TestCreateArchitectureFiles(t *testing.T) {
-	tests := []struct {
-		name    string
-		wantErr bool
-	}{
-		{
-			name:    "create architecture files",
-			wantErr: false,
+// TestPrintPlan tests the text format of a dry run plan, which omits unchanged files.
+func TestPrintPlan(t *testing.T) {
+	var out strings.Builder
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
+
+	plan := packager.Plan{
+		Summary: packager.PlanSummary{Create: 1, Update: 1, Delete: 1, Unchanged: 1},
+		Changes: []packager.FileChange{
+			{Action: packager.ChangeCreate, Path: "release/v1/providers/example-org/example/1.0.0/hashes.json"},
+			{Action: packager.ChangeDelete, Path: "release/stale.txt"},
+			{Action: packager.ChangeUnchanged, Path: "release/.well-known/terraform.json"},
+			{Action: packager.ChangeUpdate, Path: "release/v1/providers/example-org/example/versions"},
 		},
 	}
+	if err := printPlan(plan, "text"); err != nil {
+		t.Fatalf("printPlan() error = %v", err)
+	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tmpDir := t.TempDir()
-			namespace := "example-org"
-			provider := "example"
-			distPath := filepath.Join(tmpDir, "dist") + "/"
-			repoName := "terraform-provider-example"
-			version := "1.0.0"
-			gpgFingerprint := "1234567890ABCDEF"
-			domain := "registry.example.com"
-			wellKnownData := WellKnown{
-				ProvidersV1: "/providers/",
-				ModulesV1:   "/modules/",
-			}
-
-			// Setup directories
-			if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
-				t.Fatalf("Failed to setup dist: %v", err)
-			}
-
-			// Create GPG public key file
-			gpgPubKeyFile := filepath.Join(tmpDir, "pubkey.txt")
-			gpgContent := "-----BEGIN PGP PUBLIC KEY BLOCK-----\ntest key\n-----END PGP PUBLIC KEY BLOCK-----"
-			if err := os.WriteFile(gpgPubKeyFile, []byte(gpgContent), 0644); err != nil {
-				t.Fatalf("Failed to create GPG key file: %v", err)
-			}
-
-			// Create SHA256SUMS file
-			shaSumContent := "abc123def456  terraform-provider-example_1.0.0_linux_amd64.zip\n"
-			shaSumPath := filepath.Join(distPath, repoName+"_"+version+"_SHA256SUMS")
-			if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
-				t.Fatalf("Failed to create SHA256SUMS: %v", err)
-			}
+	want := "+ release/v1/providers/example-org/example/1.0.0/hashes.json\n" +
+		"- release/stale.txt\n" +
+		"~ release/v1/providers/example-org/example/versions\n" +
+		"Plan: 1 to create, 1 to update, 1 to delete, 1 unchanged.\n"
+	if out.String() != want {
+		t.Errorf("printPlan() output = %q, want %q", out.String(), want)
+	}
 
-			// Change to temp directory for test
-			t.Chdir(tmpDir)
+	if err := run(context.Background(), []string{"package", "-dry-run", "-format", "xml"}); !errors.Is(err, errUsage) {
+		t.Errorf("run() error = %v, want %v", err, errUsage)
+	}
+}
 
-			// Create the directory structure - match what createArchitectureFiles expects
-			prefix := wellKnownData.ProvidersV1 + "/" + namespace + "/" + provider + "/" + version + "/"
-			releasePath := "release" + prefix
-			downloadPath := releasePath + "download/"
-			if err := os.MkdirAll(downloadPath+"linux", os.ModePerm); err != nil {
-				t.Fatalf("Failed to create directory structure: %v", err)
-			}
+// TestStepSummary tests the Markdown summary appended to $GITHUB_STEP_SUMMARY.
+func TestStepSummary(t *testing.T) {
+	report := packager.Report{
+		Provider:  "registry.example.com/example-org/example",
+		Version:   "1.0.0",
+		Protocols: []string{"5.0", "6.0"},
+		Platforms: []packager.PlatformReport{{
+			Os:            "linux",
+			Arch:          "amd64",
+			Filename:      "terraform-provider-example_1.0.0_linux_amd64.zip",
+			Shasum:        "abc123",
+			DownloadUrl:   "https://registry.example.com/download/terraform-provider-example_1.0.0_linux_amd64.zip",
+			SigningKeyIDs: []string{"1234567890ABCDEF"},
+		}},
+		Warnings: []string{"No registry manifest at dist/terraform-provider-example_1.0.0_manifest.json, using protocol versions [5.0 5.1]"},
+		Skipped:  []packager.SkippedFile{{Filename: "terraform-provider-example_1.0.0_manifest.json", Reason: "not in the expected format"}},
+	}
 
-			err := createArchitectureFiles(namespace, provider, distPath, repoName, version, gpgFingerprint, gpgPubKeyFile, domain, wellKnownData)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("createArchitectureFiles() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	if err := os.WriteFile(summaryPath, []byte("previous step\n"), 0644); err != nil {
+		t.Fatalf("Failed to setup step summary: %v", err)
+	}
+	if err := appendStepSummary(summaryPath, report); err != nil {
+		t.Fatalf("appendStepSummary() error = %v", err)
+	}
 
-			if !tt.wantErr {
-				// Verify architecture file was created
-				archFilePath := downloadPath + "linux/amd64"
-				if _, err := os.Stat(archFilePath); os.IsNotExist(err) {
-					t.Errorf("Architecture file was not created: %v", archFilePath)
-				} else {
-					// Verify the content is valid JSON
-					content, err := os.ReadFile(archFilePath)
-					if err != nil {
-						t.Errorf("Failed to read architecture file: %v", err)
-					} else {
-						var arch Architecture
-						if err := json.Unmarshal(content, &arch); err != nil {
-							t.Errorf("Architecture file is not valid JSON: %v", err)
-						}
-						if arch.Os != "linux" || arch.Arch != "amd64" {
-							t.Errorf("Architecture file has incorrect data: os=%s, arch=%s", arch.Os, arch.Arch)
-						}
-					}
-				}
-			}
-		})
+	content, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatalf("Failed to read step summary: %v", err)
+	}
+	got := string(content)
+	for _, want := range []string{
+		"previous step\n### 📦 registry.example.com/example-org/example 1.0.0\n",
+		"Protocols: 5.0, 6.0\n",
+		"| linux_amd64 | [terraform-provider-example_1.0.0_linux_amd64.zip](https://registry.example.com/download/terraform-provider-example_1.0.0_linux_amd64.zip) | `abc123` | `1234567890ABCDEF` |\n",
+		"#### Warnings\n\n- No registry manifest at",
+		"#### Skipped files\n\n- `terraform-provider-example_1.0.0_manifest.json`: not in the expected format\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("step summary is missing %q:\n%s", want, got)
+		}
+	}
+
+	if err := run(context.Background(), []string{"package", "-dry-run", "-report", "-"}); !errors.Is(err, errUsage) {
+		t.Errorf("run() error = %v, want %v", err, errUsage)
 	}
 }
@@ -0,0 +1,145 @@
+package packager
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// goOSes are the GOOS values GoReleaser can name archives after.
+var goOSes = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js", "linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows"}
+
+// archVariants matches the GoReleaser variant suffixes of every Terraform arch: GOAMD64, GOARM,
+// GOARM64, GO386, GOMIPS, GOMIPS64, GOPPC64 and GORISCV64 levels. An empty variant always matches.
+var archVariants = map[string]*regexp.Regexp{
+	"386":      regexp.MustCompile(`^(sse2|softfloat)$`),
+	"amd64":    regexp.MustCompile(`^v[1-4]$`),
+	"arm":      regexp.MustCompile(`^v?[5-7]$`),
+	"arm64":    regexp.MustCompile(`^v(8|9)\.[0-9]$`),
+	"loong64":  nil,
+	"mips":     regexp.MustCompile(`^(hardfloat|softfloat)$`),
+	"mipsle":   regexp.MustCompile(`^(hardfloat|softfloat)$`),
+	"mips64":   regexp.MustCompile(`^(hardfloat|softfloat)$`),
+	"mips64le": regexp.MustCompile(`^(hardfloat|softfloat)$`),
+	"ppc64":    regexp.MustCompile(`^power(8|9|10)$`),
+	"ppc64le":  regexp.MustCompile(`^power(8|9|10)$`),
+	"riscv64":  regexp.MustCompile(`^rva2[02]u64$`),
+	"s390x":    nil,
+	"wasm":     nil,
+}
+
+// armVersionPattern matches the armv<GOARM> arch of the default GoReleaser archive name template.
+var armVersionPattern = regexp.MustCompile(`^armv[5-7]$`)
+
+// universalArches are the Terraform arches of a darwin_all universal binary archive.
+var universalArches = []string{"amd64", "arm64"}
+
+// parseArchiveName returns the Terraform platforms of the zip fileName of version of repoName,
+// named <repo>_<version>_<os>_<arch>[_<variant>].zip by GoReleaser. The repository name and
+// version may contain underscores, only the rest of the name is split. GoReleaser arch variants,
+// such as linux_amd64_v1, linux_arm_7 or linux_armv7, are normalized to the Terraform arch, and a
+// darwin_all universal archive is both darwin_amd64 and darwin_arm64.
+func parseArchiveName(fileName, repoName, version string) ([]Platform, bool) {
+	prefix := repoName + "_" + version + "_"
+	if repoName == "" || version == "" || !strings.HasPrefix(fileName, prefix) || !strings.HasSuffix(fileName, ".zip") {
+		return nil, false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(fileName, prefix), ".zip"), "_")
+	if len(parts) < 2 || len(parts) > 3 || !slices.Contains(goOSes, parts[0]) {
+		return nil, false
+	}
+	goos, arch, variant := parts[0], parts[1], ""
+	if len(parts) == 3 {
+		variant = parts[2]
+	}
+
+	if arch == "all" {
+		if goos != "darwin" || variant != "" {
+			return nil, false
+		}
+		platforms := make([]Platform, 0, len(universalArches))
+		for _, universalArch := range universalArches {
+			platforms = append(platforms, Platform{Os: goos, Arch: universalArch})
+		}
+		return platforms, true
+	}
+
+	if armVersionPattern.MatchString(arch) && variant == "" {
+		arch = "arm"
+	}
+	pattern, ok := archVariants[arch]
+	if !ok || (variant != "" && (pattern == nil || !pattern.MatchString(variant))) {
+		return nil, false
+	}
+
+	return []Platform{{Os: goos, Arch: arch}}, true
+}
+
+// archivePlatforms returns the published Terraform platforms of the zip fileName of the
+// configured version, and whether it is a platform zip. The platforms filtered out by
+// Config.Platforms and Config.ExcludePlatforms are left out, so the list may be empty.
+func (p *Packager) archivePlatforms(fileName string) ([]Platform, bool) {
+	platforms, ok := parseArchiveName(fileName, p.cfg.RepoName, p.cfg.Version)
+	if !ok {
+		return nil, false
+	}
+
+	published := platforms[:0]
+	for _, platform := range platforms {
+		name := platform.Os + "_" + platform.Arch
+		if len(p.cfg.Platforms) > 0 && !matchPlatform(p.cfg.Platforms, name) || matchPlatform(p.cfg.ExcludePlatforms, name) {
+			continue
+		}
+		published = append(published, platform)
+	}
+
+	return published, true
+}
+
+// matchPlatform reports whether the <os>_<arch> platform matches one of patterns.
+func matchPlatform(patterns []string, platform string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, platform); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkPlatforms fails when two zips of files publish the same platform, e.g. the linux_amd64_v1
+// and linux_amd64_v3 variants or a darwin_all zip and a darwin_amd64 one, when one of
+// Config.RequiredPlatforms is missing from files or filtered out, or when no platform is left to
+// publish.
+func (p *Packager) checkPlatforms(files []releaseFile) error {
+	var published []string
+	zips := map[string]string{}
+	for _, file := range files {
+		for _, platform := range file.platforms {
+			name := platform.Os + "_" + platform.Arch
+			if zip, ok := zips[name]; ok {
+				return fmt.Errorf("platform %s is published by both %s and %s", name, zip, file.name)
+			}
+			zips[name] = file.name
+			published = append(published, name)
+		}
+	}
+
+	var missing []string
+	for _, required := range p.cfg.RequiredPlatforms {
+		if !slices.Contains(published, required) {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required platforms %s are not published", strings.Join(missing, ", "))
+	}
+	if len(published) == 0 {
+		return fmt.Errorf("no platform zip to publish in %s", p.cfg.DistPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseArchiveName tests the platforms parsed from GoReleaser zip names.
+func TestParseArchiveName(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		repoName string
+		want     []Platform
+	}{
+		{
+			name:     "os and arch",
+			fileName: "terraform-provider-example_1.0.0_linux_amd64.zip",
+			want:     []Platform{{Os: "linux", Arch: "amd64"}},
+		},
+		{
+			name:     "repository name with underscores",
+			fileName: "terraform_provider_my_example_1.0.0_windows_386.zip",
+			repoName: "terraform_provider_my_example",
+			want:     []Platform{{Os: "windows", Arch: "386"}},
+		},
+		{
+			name:     "amd64 level",
+			fileName: "terraform-provider-example_1.0.0_linux_amd64_v1.zip",
+			want:     []Platform{{Os: "linux", Arch: "amd64"}},
+		},
+		{
+			name:     "arm version",
+			fileName: "terraform-provider-example_1.0.0_linux_arm_7.zip",
+			want:     []Platform{{Os: "linux", Arch: "arm"}},
+		},
+		{
+			name:     "armv6",
+			fileName: "terraform-provider-example_1.0.0_freebsd_armv6.zip",
+			want:     []Platform{{Os: "freebsd", Arch: "arm"}},
+		},
+		{
+			name:     "arm64 version",
+			fileName: "terraform-provider-example_1.0.0_linux_arm64_v8.0.zip",
+			want:     []Platform{{Os: "linux", Arch: "arm64"}},
+		},
+		{
+			name:     "mips float",
+			fileName: "terraform-provider-example_1.0.0_linux_mipsle_softfloat.zip",
+			want:     []Platform{{Os: "linux", Arch: "mipsle"}},
+		},
+		{
+			name:     "darwin universal",
+			fileName: "terraform-provider-example_1.0.0_darwin_all.zip",
+			want:     []Platform{{Os: "darwin", Arch: "amd64"}, {Os: "darwin", Arch: "arm64"}},
+		},
+		{
+			name:     "linux universal",
+			fileName: "terraform-provider-example_1.0.0_linux_all.zip",
+		},
+		{
+			name:     "variant of another arch",
+			fileName: "terraform-provider-example_1.0.0_linux_arm64_v1.zip",
+		},
+		{
+			name:     "unknown OS",
+			fileName: "terraform-provider-example_1.0.0_beos_amd64.zip",
+		},
+		{
+			name:     "other version",
+			fileName: "terraform-provider-example_1.0.1_linux_amd64.zip",
+		},
+		{
+			name:     "not a zip",
+			fileName: "terraform-provider-example_1.0.0_SHA256SUMS",
+		},
+		{
+			name:     "manifest",
+			fileName: "terraform-provider-example_1.0.0_manifest.json",
+		},
+		{
+			name:     "missing arch",
+			fileName: "terraform-provider-example_1.0.0_linux.zip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoName := tt.repoName
+			if repoName == "" {
+				repoName = "terraform-provider-example"
+			}
+
+			got, ok := parseArchiveName(tt.fileName, repoName, "1.0.0")
+			if ok != (tt.want != nil) {
+				t.Fatalf("parseArchiveName() ok = %v, want %v", ok, tt.want != nil)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseArchiveName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzParseArchiveName tests that parsed platforms are Terraform platforms, and that the zip name
+// of every parsed platform parses back to it.
+func FuzzParseArchiveName(f *testing.F) {
+	for _, fileName := range []string{
+		"terraform-provider-example_1.0.0_linux_amd64.zip",
+		"terraform-provider-example_1.0.0_linux_amd64_v3.zip",
+		"terraform-provider-example_1.0.0_linux_arm_6.zip",
+		"terraform-provider-example_1.0.0_darwin_all.zip",
+		"terraform-provider-example_1.0.0_windows_arm64_v9.2.zip",
+		"terraform-provider-example_1.0.0_SHA256SUMS",
+	} {
+		f.Add(fileName, "terraform-provider-example", "1.0.0")
+	}
+	f.Add("a_b_1.0.0_rc_1_linux_386_sse2.zip", "a_b", "1.0.0_rc_1")
+
+	f.Fuzz(func(t *testing.T, fileName, repoName, version string) {
+		platforms, ok := parseArchiveName(fileName, repoName, version)
+		if !ok {
+			if platforms != nil {
+				t.Errorf("parseArchiveName(%q) = %v, want no platforms", fileName, platforms)
+			}
+			return
+		}
+		if len(platforms) == 0 || !strings.HasPrefix(fileName, repoName+"_"+version+"_") || !strings.HasSuffix(fileName, ".zip") {
+			t.Fatalf("parseArchiveName(%q, %q, %q) = %v", fileName, repoName, version, platforms)
+		}
+
+		for _, platform := range platforms {
+			if _, ok := archVariants[platform.Arch]; !ok || strings.Contains(platform.Os, "_") {
+				t.Errorf("parseArchiveName(%q) platform %v is not a Terraform platform", fileName, platform)
+			}
+
+			canonical := fmt.Sprintf("%s_%s_%s_%s.zip", repoName, version, platform.Os, platform.Arch)
+			got, ok := parseArchiveName(canonical, repoName, version)
+			if !ok || len(got) != 1 || got[0] != platform {
+				t.Errorf("parseArchiveName(%q) = %v, want [%v]", canonical, got, platform)
+			}
+		}
+	})
+}
+
+// TestPackageArchiveVariants tests the platform documents of GoReleaser arch variants and
+// universal darwin archives.
+func TestPackageArchiveVariants(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestDist(t, "dist", "linux_amd64_v1", "linux_arm_7", "darwin_all")
+	writeTestSignature(t, key, filepath.Join("dist", "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	providerPath := "release/v1/providers/example-org/example"
+	var versions Versions
+	if _, err := readJSONFile(filepath.Join(providerPath, "versions"), &versions); err != nil {
+		t.Fatalf("Failed to read versions file: %v", err)
+	}
+	want := []Platform{{Os: "linux", Arch: "amd64"}, {Os: "linux", Arch: "arm"}, {Os: "darwin", Arch: "amd64"}, {Os: "darwin", Arch: "arm64"}}
+	if len(versions.Versions) != 1 || !reflect.DeepEqual(versions.Versions[0].Platforms, want) {
+		t.Fatalf("versions = %+v, want platforms %v", versions.Versions, want)
+	}
+
+	for _, platform := range []string{"darwin/amd64", "darwin/arm64"} {
+		data, err := os.ReadFile(filepath.Join(providerPath, "1.0.0/download", platform))
+		if err != nil {
+			t.Fatalf("Expected platform document %s: %v", platform, err)
+		}
+		var architecture Architecture
+		if err := json.Unmarshal(data, &architecture); err != nil {
+			t.Fatalf("Failed to parse platform document %s: %v", platform, err)
+		}
+		if architecture.Filename != "terraform-provider-example_1.0.0_darwin_all.zip" || architecture.Os+"/"+architecture.Arch != platform {
+			t.Errorf("platform document %s = %+v, want the universal zip", platform, architecture)
+		}
+	}
+
+	problems, err := Verify(context.Background(), "release")
+	if err != nil || len(problems) != 0 {
+		t.Errorf("Verify() = %v, %v, want no problems", problems, err)
+	}
+}
+
+// TestPackagePlatforms tests the platform filter, the required platforms, zips publishing the same
+// platform and that target directories are only created for published platforms.
+func TestPackagePlatforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       func(c Config) Config
+		platforms []string
+		wantDocs  []string
+		wantErr   string
+	}{
+		{
+			name:     "every platform",
+			cfg:      func(c Config) Config { return c },
+			wantDocs: []string{"darwin/arm64", "linux/amd64", "openbsd/amd64"},
+		},
+		{
+			name: "allowed and denied platforms",
+			cfg: func(c Config) Config {
+				c.Platforms = []string{"linux_*", "openbsd_*"}
+				c.ExcludePlatforms = []string{"openbsd_*"}
+				return c
+			},
+			wantDocs: []string{"linux/amd64"},
+		},
+		{
+			name: "required platforms",
+			cfg: func(c Config) Config {
+				c.RequiredPlatforms = []string{"linux_amd64", "darwin_arm64"}
+				return c
+			},
+			wantDocs: []string{"darwin/arm64", "linux/amd64", "openbsd/amd64"},
+		},
+		{
+			name: "missing required platform",
+			cfg: func(c Config) Config {
+				c.RequiredPlatforms = []string{"linux_amd64", "windows_amd64"}
+				return c
+			},
+			wantErr: "required platforms windows_amd64 are not published",
+		},
+		{
+			name: "filtered required platform",
+			cfg: func(c Config) Config {
+				c.ExcludePlatforms = []string{"darwin_*"}
+				c.RequiredPlatforms = []string{"darwin_arm64"}
+				return c
+			},
+			wantErr: "required platforms darwin_arm64 are not published",
+		},
+		{
+			name: "every platform filtered",
+			cfg: func(c Config) Config {
+				c.Platforms = []string{"windows_*"}
+				return c
+			},
+			wantErr: "no platform zip to publish",
+		},
+		{
+			name:      "duplicate arch variants",
+			cfg:       func(c Config) Config { return c },
+			platforms: []string{"linux_amd64_v1", "linux_amd64_v3"},
+			wantErr:   "platform linux_amd64 is published by both terraform-provider-example_1.0.0_linux_amd64_v1.zip and terraform-provider-example_1.0.0_linux_amd64_v3.zip",
+		},
+		{
+			name:      "universal and single arch darwin zips",
+			cfg:       func(c Config) Config { return c },
+			platforms: []string{"darwin_all", "darwin_amd64"},
+			wantErr:   "platform darwin_amd64 is published by both terraform-provider-example_1.0.0_darwin_all.zip and terraform-provider-example_1.0.0_darwin_amd64.zip",
+		},
+		{
+			name: "duplicate platform filtered",
+			cfg: func(c Config) Config {
+				c.ExcludePlatforms = []string{"darwin_amd64"}
+				return c
+			},
+			platforms: []string{"darwin_all", "darwin_amd64"},
+			wantDocs:  []string{"darwin/arm64"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			key := newTestKey(t)
+			writeTestPublicKey(t, key, "pubkey.txt")
+			platforms := tt.platforms
+			if platforms == nil {
+				platforms = []string{"linux_amd64", "darwin_arm64", "openbsd_amd64"}
+			}
+			writeTestDist(t, "dist", platforms...)
+			writeTestSignature(t, key, filepath.Join("dist", "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+			domain, client := newTestRegistry(t, map[string]testResponse{})
+			cfg := testConfig("dist")
+			cfg.Domain = domain
+			cfg.GPGFingerprint = ""
+			p := newTestPackager(t, tt.cfg(cfg), WithHTTPClient(client), WithAllowNew(true))
+
+			err := p.Package(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Package() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, err := os.Stat("release"); !os.IsNotExist(err) {
+					t.Error("Package() must not write the release tree when failing")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Package() error = %v", err)
+			}
+
+			downloadPath := "release/v1/providers/example-org/example/1.0.0/download"
+			var docs []string
+			err = filepath.WalkDir(downloadPath, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && !strings.HasSuffix(path, ".zip") {
+					docs = append(docs, filepath.ToSlash(strings.TrimPrefix(path, downloadPath+string(filepath.Separator))))
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatalf("Failed to walk %s: %v", downloadPath, err)
+			}
+			if !reflect.DeepEqual(docs, tt.wantDocs) {
+				t.Errorf("platform documents = %v, want %v", docs, tt.wantDocs)
+			}
+
+			entries, err := os.ReadDir(downloadPath)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", downloadPath, err)
+			}
+			var zips int
+			for _, entry := range entries {
+				if strings.HasSuffix(entry.Name(), ".zip") {
+					zips++
+				}
+			}
+			if zips != len(tt.wantDocs) {
+				t.Errorf("published %d zips, want %d", zips, len(tt.wantDocs))
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package packager
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AllNamespaces grants a token of a TokenACL access to every namespace.
+const AllNamespaces = "*"
+
+// TokenACL maps the API tokens a Server accepts to the namespaces they give access to. Clients
+// send them as bearer tokens, as configured in the credentials "<domain>" blocks of the
+// Terraform CLI configuration.
+type TokenACL map[string][]string
+
+// LoadTokenACL reads a YAML or JSON token file mapping every token to the list of namespaces it
+// gives access to, AllNamespaces for all of them:
+//
+//	ci-token: ["*"]
+//	team-token: [example-org, partner-org]
+func LoadTokenACL(path string) (TokenACL, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	acl := TokenACL{}
+	err = yaml.Unmarshal(data, &acl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing token file %s: %w", path, err)
+	}
+
+	// Tokens are secrets, errors only name the namespaces.
+	for token, namespaces := range acl {
+		if token == "" {
+			return nil, fmt.Errorf("token file %s: empty token for %v", path, namespaces)
+		}
+		if len(namespaces) == 0 {
+			return nil, fmt.Errorf("token file %s: a token has no namespace", path)
+		}
+	}
+
+	return acl, nil
+}
+
+// namespaces returns the namespaces of token and whether the token is known. Every token is
+// compared in constant time.
+func (acl TokenACL) namespaces(token string) ([]string, bool) {
+	var namespaces []string
+	found := false
+	for known, allowed := range acl {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			namespaces = allowed
+			found = true
+		}
+	}
+
+	return namespaces, found
+}
+
+// allows reports whether token gives access to namespace. An empty namespace only requires a
+// known token.
+func (acl TokenACL) allows(token, namespace string) bool {
+	namespaces, ok := acl.namespaces(token)
+	if !ok {
+		return false
+	}
+
+	return namespace == "" || slices.Contains(namespaces, namespace) || slices.Contains(namespaces, AllNamespaces)
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header.
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+// downloadSignatureParam is the query parameter of signed download URLs. Terraform does not send
+// registry credentials when downloading provider packages and module archives, so the URLs of
+// documents served to an authorized client are signed instead.
+const downloadSignatureParam = "tfpp-sig"
+
+// downloadSignatureTTL is how long a signed download URL stays valid.
+const downloadSignatureTTL = time.Hour
+
+// signPath returns the downloadSignatureParam value for urlPath, valid until expires.
+func signPath(secret []byte, urlPath string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + hex.EncodeToString(pathMAC(secret, urlPath, exp))
+}
+
+// verifyPathSignature reports whether sig is a signature of urlPath by signPath that has not
+// expired at now.
+func verifyPathSignature(secret []byte, urlPath, sig string, now time.Time) bool {
+	exp, mac, ok := strings.Cut(sig, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	got, err := hex.DecodeString(mac)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(got, pathMAC(secret, urlPath, exp))
+}
+
+func pathMAC(secret []byte, urlPath, exp string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(urlPath + "\n" + exp))
+	return h.Sum(nil)
+}
@@ -0,0 +1,115 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadTokenACL tests reading token files.
+func TestLoadTokenACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    TokenACL
+		wantErr bool
+	}{
+		{
+			name:    "YAML",
+			content: "ci-token: [\"*\"]\nteam-token:\n  - example-org\n  - partner-org\n",
+			want:    TokenACL{"ci-token": {"*"}, "team-token": {"example-org", "partner-org"}},
+		},
+		{
+			name:    "JSON",
+			content: `{"team-token": ["example-org"]}`,
+			want:    TokenACL{"team-token": {"example-org"}},
+		},
+		{
+			name:    "empty file",
+			content: "",
+			want:    TokenACL{},
+		},
+		{
+			name:    "token without namespace",
+			content: "team-token: []\n",
+			wantErr: true,
+		},
+		{
+			name:    "namespaces not a list",
+			content: "team-token: example-org\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to setup token file: %v", err)
+			}
+
+			got, err := LoadTokenACL(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTokenACL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadTokenACL() = %v, want %v", got, tt.want)
+			}
+			for token, namespaces := range tt.want {
+				if len(got[token]) != len(namespaces) {
+					t.Errorf("LoadTokenACL()[%s] = %v, want %v", token, got[token], namespaces)
+				}
+			}
+		})
+	}
+}
+
+// TestBearerToken tests parsing Authorization headers.
+func TestBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer abc":  "abc",
+		"bearer abc ": "abc",
+		"Basic abc":   "",
+		"abc":         "",
+		"":            "",
+	}
+	for header, want := range tests {
+		if got := bearerToken(header); got != want {
+			t.Errorf("bearerToken(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// TestVerifyPathSignature tests signed download paths.
+func TestVerifyPathSignature(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	sig := signPath(secret, "/v1/providers/a/b/1.0.0/download/b.zip", now.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		secret []byte
+		path   string
+		sig    string
+		now    time.Time
+		want   bool
+	}{
+		{"valid", secret, "/v1/providers/a/b/1.0.0/download/b.zip", sig, now, true},
+		{"expired", secret, "/v1/providers/a/b/1.0.0/download/b.zip", sig, now.Add(2 * time.Hour), false},
+		{"other path", secret, "/v1/providers/a/b/1.0.0/download/c.zip", sig, now, false},
+		{"other secret", []byte("other"), "/v1/providers/a/b/1.0.0/download/b.zip", sig, now, false},
+		{"malformed", secret, "/v1/providers/a/b/1.0.0/download/b.zip", "garbage", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPathSignature(tt.secret, tt.path, tt.sig, tt.now); got != tt.want {
+				t.Errorf("verifyPathSignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// elfOSes are the GOOS values of ELF executables that do not record their OS ABI.
+var elfOSes = []string{"linux", "netbsd", "openbsd", "dragonfly", "solaris", "illumos"}
+
+// machOMagics are the magic numbers of 32 and 64-bit Mach-O executables, in either byte order.
+var machOMagics = []uint32{macho.Magic32, macho.Magic64}
+
+// executable is the platform an executable was built for, as read from its headers.
+type executable struct {
+	// format is ELF, Mach-O or PE.
+	format string
+	// oses are the GOOS values the executable can be built for, more than one for ELF
+	// executables that do not record their OS ABI.
+	oses []string
+	// arches are the GOARCH values of the executable, more than one for universal binaries.
+	arches []string
+}
+
+func (e executable) String() string {
+	return fmt.Sprintf("%s executable for %s_%s", e.format, strings.Join(e.oses, "|"), strings.Join(e.arches, "|"))
+}
+
+// runsOn reports whether the executable was built for goos and goarch.
+func (e executable) runsOn(goos, goarch string) bool {
+	return slices.Contains(e.oses, goos) && slices.Contains(e.arches, goarch)
+}
+
+// binaryName returns the name of the provider executable Terraform expects in the zip of goos.
+func (p *Packager) binaryName(goos string) string {
+	name := fmt.Sprintf("terraform-provider-%s_v%s", p.cfg.Provider, p.cfg.Version)
+	if goos == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
+
+// inspectBinaries checks that every published platform zip of files contains exactly one
+// provider executable, named after the provider version and built for the platform of the zip
+// name, so that no platform document claims a platform the provider cannot run on. Config.Jobs
+// zips are inspected at a time.
+func (p *Packager) inspectBinaries(ctx context.Context, files []releaseFile) error {
+	p.logger.Println("* Inspecting provider binaries")
+
+	return p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		fileName := file.name
+		platforms := file.platforms
+		if !file.platformZip || len(platforms) == 0 {
+			return nil
+		}
+
+		// The platforms of an archive, several for universal binaries, share the OS.
+		binaryName := p.binaryName(platforms[0].Os)
+		zipPath := filepath.Join(p.cfg.DistPath, fileName)
+		exe, err := inspectZip(zipPath, binaryName)
+		for _, platform := range platforms {
+			if err == nil && !exe.runsOn(platform.Os, platform.Arch) {
+				err = fmt.Errorf("%s: %s, not %s_%s", binaryName, exe, platform.Os, platform.Arch)
+			}
+		}
+		if err != nil {
+			return &BinaryError{Path: zipPath, Err: err}
+		}
+
+		p.logger.Printf("  - %s: %s", fileName, exe)
+
+		return nil
+	})
+}
+
+// inspectZip returns the platform of the provider executable binaryName, which must be the only
+// terraform-provider-* file of the zip at zipPath.
+func inspectZip(zipPath, binaryName string) (executable, error) {
+	zipFile, err := os.Open(zipPath)
+	if err != nil {
+		return executable{}, err
+	}
+	defer zipFile.Close()
+
+	info, err := zipFile.Stat()
+	if err != nil {
+		return executable{}, err
+	}
+	reader, err := zip.NewReader(zipFile, info.Size())
+	if err != nil {
+		return executable{}, err
+	}
+
+	var entry *zip.File
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || !strings.HasPrefix(path.Base(f.Name), "terraform-provider-") {
+			continue
+		}
+		if entry != nil {
+			return executable{}, fmt.Errorf("more than one provider executable: %s and %s", entry.Name, f.Name)
+		}
+		entry = f
+	}
+
+	switch {
+	case entry == nil:
+		return executable{}, fmt.Errorf("no provider executable %s", binaryName)
+	case entry.Name != binaryName:
+		return executable{}, fmt.Errorf("provider executable is %s, want %s", entry.Name, binaryName)
+	}
+
+	exe, err := inspectZipEntry(zipFile, entry)
+	if err != nil {
+		return executable{}, fmt.Errorf("%s: %w", entry.Name, err)
+	}
+
+	return exe, nil
+}
+
+// inspectZipEntry reads the platform of the entry f of the zip zipFile. The debug packages need
+// random access to the executable, so stored entries are read in place and compressed ones are
+// decompressed in memory, and nothing is written to disk, also during a dry run.
+func inspectZipEntry(zipFile io.ReaderAt, f *zip.File) (executable, error) {
+	if f.Method == zip.Store {
+		offset, err := f.DataOffset()
+		if err != nil {
+			return executable{}, err
+		}
+		return inspectExecutable(io.NewSectionReader(zipFile, offset, int64(f.UncompressedSize64)))
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return executable{}, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return executable{}, err
+	}
+
+	return inspectExecutable(bytes.NewReader(data))
+}
+
+// inspectExecutable returns the platform of the ELF, Mach-O or PE executable r.
+func inspectExecutable(r io.ReaderAt) (executable, error) {
+	magic := make([]byte, 4)
+	_, err := r.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return executable{}, err
+	}
+
+	switch {
+	case string(magic) == elf.ELFMAG:
+		return inspectELF(r)
+	case strings.HasPrefix(string(magic), "MZ"):
+		return inspectPE(r)
+	case slices.Contains(machOMagics, binary.BigEndian.Uint32(magic)), slices.Contains(machOMagics, binary.LittleEndian.Uint32(magic)):
+		return inspectMachO(r)
+	case binary.BigEndian.Uint32(magic) == macho.MagicFat:
+		return inspectFatMachO(r)
+	}
+
+	return executable{}, errors.New("not an ELF, Mach-O or PE executable")
+}
+
+func inspectELF(r io.ReaderAt) (executable, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return executable{}, err
+	}
+	defer f.Close()
+
+	exe := executable{format: "ELF"}
+	switch f.OSABI {
+	case elf.ELFOSABI_NONE:
+		exe.oses = elfOSes
+	case elf.ELFOSABI_LINUX:
+		exe.oses = []string{"linux"}
+	case elf.ELFOSABI_FREEBSD:
+		exe.oses = []string{"freebsd"}
+	case elf.ELFOSABI_NETBSD:
+		exe.oses = []string{"netbsd"}
+	case elf.ELFOSABI_OPENBSD:
+		exe.oses = []string{"openbsd"}
+	case elf.ELFOSABI_SOLARIS:
+		exe.oses = []string{"solaris", "illumos"}
+	default:
+		exe.oses = []string{fmt.Sprint(f.OSABI)}
+	}
+
+	arch := fmt.Sprint(f.Machine)
+	littleEndian := f.ByteOrder == binary.LittleEndian
+	switch f.Machine {
+	case elf.EM_X86_64:
+		arch = "amd64"
+	case elf.EM_386:
+		arch = "386"
+	case elf.EM_AARCH64:
+		arch = "arm64"
+	case elf.EM_ARM:
+		arch = "arm"
+	case elf.EM_PPC64:
+		arch = "ppc64"
+		if littleEndian {
+			arch = "ppc64le"
+		}
+	case elf.EM_S390:
+		arch = "s390x"
+	case elf.EM_RISCV:
+		arch = "riscv64"
+	case elf.EM_LOONGARCH:
+		arch = "loong64"
+	case elf.EM_MIPS:
+		arch = "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch = "mips64"
+		}
+		if littleEndian {
+			arch += "le"
+		}
+	}
+
+	exe.arches = []string{arch}
+
+	return exe, nil
+}
+
+func inspectMachO(r io.ReaderAt) (executable, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return executable{}, err
+	}
+	defer f.Close()
+
+	return executable{format: "Mach-O", oses: []string{"darwin"}, arches: []string{machOArch(f.Cpu)}}, nil
+}
+
+// inspectFatMachO returns the platform of a universal Mach-O executable, with the arches of all
+// its executables.
+func inspectFatMachO(r io.ReaderAt) (executable, error) {
+	f, err := macho.NewFatFile(r)
+	if err != nil {
+		return executable{}, err
+	}
+	defer f.Close()
+
+	exe := executable{format: "universal Mach-O", oses: []string{"darwin"}}
+	for _, arch := range f.Arches {
+		exe.arches = append(exe.arches, machOArch(arch.Cpu))
+	}
+
+	return exe, nil
+}
+
+func machOArch(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	case macho.Cpu386:
+		return "386"
+	case macho.CpuArm:
+		return "arm"
+	}
+
+	return fmt.Sprint(cpu)
+}
+
+func inspectPE(r io.ReaderAt) (executable, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return executable{}, err
+	}
+	defer f.Close()
+
+	arch := fmt.Sprintf("machine %#x", f.Machine)
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		arch = "amd64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		arch = "386"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		arch = "arm64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		arch = "arm"
+	}
+
+	return executable{format: "PE", oses: []string{"windows"}, arches: []string{arch}}, nil
+}
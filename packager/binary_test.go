@@ -0,0 +1,229 @@
+package packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testExecutable returns the headers of an executable for platform (<os>_<arch>), enough for the
+// debug packages to read its platform.
+func testExecutable(t testing.TB, platform string) string {
+	t.Helper()
+
+	goos, goarch, _ := strings.Cut(platform, "_")
+	goarch, _, _ = strings.Cut(goarch, "_")
+	var buf bytes.Buffer
+	write := func(v any) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatalf("Failed to write executable header: %v", err)
+		}
+	}
+
+	switch {
+	case platform == "darwin_all":
+		// A universal binary is a big endian header followed by the executable of every arch.
+		arches := []string{testExecutable(t, "darwin_amd64"), testExecutable(t, "darwin_arm64")}
+		header := []uint32{macho.MagicFat, uint32(len(arches))}
+		offset := uint32(4 * (2 + 5*len(arches)))
+		for i, cpu := range []macho.Cpu{macho.CpuAmd64, macho.CpuArm64} {
+			header = append(header, uint32(cpu), 0, offset, uint32(len(arches[i])), 0)
+			offset += uint32(len(arches[i]))
+		}
+		if err := binary.Write(&buf, binary.BigEndian, header); err != nil {
+			t.Fatalf("Failed to write executable header: %v", err)
+		}
+		buf.WriteString(strings.Join(arches, ""))
+	case goos == "darwin":
+		cpus := map[string]macho.Cpu{"amd64": macho.CpuAmd64, "arm64": macho.CpuArm64}
+		write(macho.FileHeader{Magic: macho.Magic64, Cpu: cpus[goarch], Type: macho.TypeExec})
+		write(uint32(0))
+	case goos == "windows":
+		machines := map[string]uint16{"amd64": pe.IMAGE_FILE_MACHINE_AMD64, "386": pe.IMAGE_FILE_MACHINE_I386, "arm64": pe.IMAGE_FILE_MACHINE_ARM64}
+		dosHeader := make([]byte, 128)
+		copy(dosHeader, "MZ")
+		binary.LittleEndian.PutUint32(dosHeader[0x3c:], uint32(len(dosHeader)))
+		write(dosHeader)
+		write([]byte("PE\x00\x00"))
+		write(pe.FileHeader{Machine: machines[goarch]})
+	default:
+		machines := map[string]elf.Machine{"amd64": elf.EM_X86_64, "arm": elf.EM_ARM, "arm64": elf.EM_AARCH64}
+		osABIs := map[string]elf.OSABI{"linux": elf.ELFOSABI_NONE, "freebsd": elf.ELFOSABI_FREEBSD}
+		header := elf.Header64{Type: uint16(elf.ET_EXEC), Machine: uint16(machines[goarch]), Version: uint32(elf.EV_CURRENT), Ehsize: 64}
+		copy(header.Ident[:], elf.ELFMAG)
+		header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+		header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+		header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+		header.Ident[elf.EI_OSABI] = byte(osABIs[goos])
+		write(header)
+	}
+
+	return buf.String()
+}
+
+// TestInspectExecutable tests the platform read from the headers of executables.
+func TestInspectExecutable(t *testing.T) {
+	tests := []struct {
+		name       string
+		executable string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "linux amd64",
+			executable: testExecutable(t, "linux_amd64"),
+			want:       "ELF executable for linux|netbsd|openbsd|dragonfly|solaris|illumos_amd64",
+		},
+		{
+			name:       "freebsd arm64",
+			executable: testExecutable(t, "freebsd_arm64"),
+			want:       "ELF executable for freebsd_arm64",
+		},
+		{
+			name:       "darwin arm64",
+			executable: testExecutable(t, "darwin_arm64"),
+			want:       "Mach-O executable for darwin_arm64",
+		},
+		{
+			name:       "darwin universal",
+			executable: testExecutable(t, "darwin_all"),
+			want:       "universal Mach-O executable for darwin_amd64|arm64",
+		},
+		{
+			name:       "windows 386",
+			executable: testExecutable(t, "windows_386"),
+			want:       "PE executable for windows_386",
+		},
+		{
+			name:       "script",
+			executable: "#!/bin/sh\n",
+			wantErr:    true,
+		},
+		{
+			name:       "empty",
+			executable: "",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspectExecutable(strings.NewReader(tt.executable))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inspectExecutable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("inspectExecutable() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestInspectZipStored tests that executables stored without compression are inspected in place.
+func TestInspectZipStored(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "terraform-provider-example_1.0.0_linux_arm64.zip")
+	zipFile, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	w := zip.NewWriter(zipFile)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "terraform-provider-example_v1.0.0", Method: zip.Store})
+	if err != nil {
+		t.Fatalf("Failed to add executable to zip: %v", err)
+	}
+	if _, err := f.Write([]byte(testExecutable(t, "linux_arm64"))); err != nil {
+		t.Fatalf("Failed to write executable to zip: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+	if err := zipFile.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+
+	exe, err := inspectZip(zipPath, "terraform-provider-example_v1.0.0")
+	if err != nil {
+		t.Fatalf("inspectZip() error = %v", err)
+	}
+	if !exe.runsOn("linux", "arm64") || exe.runsOn("linux", "amd64") {
+		t.Errorf("inspectZip() = %s, want linux_arm64", exe)
+	}
+}
+
+// TestInspectBinaries tests that packaging fails for zips whose executable does not match the
+// platform of their file name.
+func TestInspectBinaries(t *testing.T) {
+	zipName := "terraform-provider-example_1.0.0_windows_amd64.zip"
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:  "matching executable",
+			files: map[string]string{"terraform-provider-example_v1.0.0.exe": testExecutable(t, "windows_amd64"), "README.md": "readme"},
+		},
+		{
+			name:    "other architecture",
+			files:   map[string]string{"terraform-provider-example_v1.0.0.exe": testExecutable(t, "windows_arm64")},
+			wantErr: "PE executable for windows_arm64, not windows_amd64",
+		},
+		{
+			name:    "other OS",
+			files:   map[string]string{"terraform-provider-example_v1.0.0.exe": testExecutable(t, "linux_amd64")},
+			wantErr: "not windows_amd64",
+		},
+		{
+			name:    "missing .exe",
+			files:   map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "windows_amd64")},
+			wantErr: "provider executable is terraform-provider-example_v1.0.0, want terraform-provider-example_v1.0.0.exe",
+		},
+		{
+			name:    "other version",
+			files:   map[string]string{"terraform-provider-example_v0.9.0.exe": testExecutable(t, "windows_amd64")},
+			wantErr: "want terraform-provider-example_v1.0.0.exe",
+		},
+		{
+			name:    "two executables",
+			files:   map[string]string{"terraform-provider-example_v1.0.0.exe": testExecutable(t, "windows_amd64"), "terraform-provider-other_v1.0.0.exe": testExecutable(t, "windows_amd64")},
+			wantErr: "more than one provider executable",
+		},
+		{
+			name:    "no executable",
+			files:   map[string]string{"README.md": "readme"},
+			wantErr: "no provider executable terraform-provider-example_v1.0.0.exe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distPath := t.TempDir()
+			shasum := writeTestZip(t, filepath.Join(distPath, zipName), tt.files)
+			writeTestTree(t, distPath, map[string]string{"terraform-provider-example_1.0.0_SHA256SUMS": shasum + "  " + zipName + "\n"})
+
+			p := newTestPackager(t, testConfig(distPath))
+			err := p.inspectBinaries(context.Background(), testReleaseFiles(t, p))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("inspectBinaries() error = %v", err)
+				}
+				return
+			}
+
+			var binaryErr *BinaryError
+			if !errors.As(err, &binaryErr) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("inspectBinaries() error = %v, want *BinaryError containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package packager
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PlatformResult is the outcome of checking a platform of a provider version.
+type PlatformResult struct {
+	Version  string    `json:"version"`
+	Platform string    `json:"platform"`
+	Problems []Problem `json:"problems,omitempty"`
+}
+
+// OK reports whether Terraform can install the platform.
+func (r PlatformResult) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// CheckReport is the outcome of Check for a provider.
+type CheckReport struct {
+	// Provider is the <domain>/<namespace>/<type> address of the provider.
+	Provider string `json:"provider"`
+	// Problems are all the problems found, during service discovery or for a platform.
+	Problems  []Problem        `json:"problems,omitempty"`
+	Platforms []PlatformResult `json:"platforms"`
+}
+
+// OK reports whether Terraform can install every platform of the provider.
+func (r CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// httpSource reads a release tree from a registry over HTTP, as Terraform does.
+type httpSource struct {
+	client *http.Client
+}
+
+func (h httpSource) open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, &FetchError{URL: ref, Err: err}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, &FetchError{URL: ref, Err: err}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, &FetchError{URL: ref, StatusCode: resp.StatusCode, Err: ErrNotFound}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &FetchError{URL: ref, StatusCode: resp.StatusCode}
+	}
+
+	return resp.Body, nil
+}
+
+// Check installs the provider at providerURL, https://<domain>/<namespace>/<type>, the way
+// "terraform init" would: it discovers the providers.v1 service of the domain, then, for every
+// platform of the versions document, fetches the platform document, downloads the zip, SHA256SUMS
+// and signature, and checks them as Verify does. The error is only set for an invalid URL or a
+// canceled context, the problems of the registry are in the report.
+//
+// Only the WithHTTPClient and WithLogger options apply.
+func Check(ctx context.Context, providerURL string, opts ...Option) (CheckReport, error) {
+	p := &Packager{httpClient: &http.Client{}, logger: log.Default()}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	u, err := url.Parse(providerURL)
+	if err != nil {
+		return CheckReport{}, &ConfigError{Field: "url", Reason: err.Error()}
+	}
+	namespace, providerType, ok := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || !ok || namespace == "" || providerType == "" || strings.Contains(providerType, "/") {
+		return CheckReport{}, &ConfigError{Field: "url", Reason: "must be https://<domain>/<namespace>/<type>"}
+	}
+
+	provider := namespace + "/" + providerType
+	v := newVerifier(httpSource{client: p.httpClient})
+
+	wellKnownURL := u.Scheme + "://" + u.Host + "/.well-known/terraform.json"
+	p.logger.Printf("Discovering services at %s", wellKnownURL)
+
+	providersV1, ok := v.discoverProviders(ctx, wellKnownURL, provider)
+	if ok {
+		p.logger.Printf("Checking %s", providersV1+provider)
+		v.verifyProvider(ctx, providersV1+provider+"/", provider)
+	}
+
+	report := CheckReport{Provider: u.Host + "/" + provider, Problems: v.problems, Platforms: v.platforms}
+	if report.Platforms == nil {
+		report.Platforms = []PlatformResult{}
+	}
+
+	return report, ctx.Err()
+}
+
+// discoverProviders returns the providers.v1 URL advertised by the well-known file at
+// wellKnownURL, with a trailing slash, reporting why it cannot be used.
+func (v *verifier) discoverProviders(ctx context.Context, wellKnownURL, provider string) (string, bool) {
+	problem := Problem{Provider: provider, Path: wellKnownURL}
+
+	var wellKnownData WellKnown
+	if !v.readJSON(ctx, wellKnownURL, problem, &wellKnownData) {
+		return "", false
+	}
+	if wellKnownData.ProvidersV1 == "" {
+		problem.Message = "does not advertise providers.v1"
+		v.report(problem)
+		return "", false
+	}
+
+	providersV1, err := resolveRef(wellKnownURL, wellKnownData.ProvidersV1)
+	if err != nil {
+		problem.Message = "invalid providers.v1: " + err.Error()
+		v.report(problem)
+		return "", false
+	}
+	if !strings.HasSuffix(providersV1, "/") {
+		providersV1 += "/"
+	}
+
+	return providersV1, true
+}
@@ -0,0 +1,135 @@
+package packager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// serveTestRelease packages a test release and serves it the way a static bucket would, with the
+// documents rewritten for the test server. It returns the URL of the provider and the client.
+func serveTestRelease(t *testing.T) (string, *http.Client) {
+	t.Helper()
+
+	cfg := writeTestRelease(t)
+	server := httptest.NewTLSServer(http.FileServer(http.Dir("release")))
+	t.Cleanup(server.Close)
+
+	domain := strings.TrimPrefix(server.URL, "https://")
+	for _, doc := range []string{"linux/amd64", "darwin/arm64"} {
+		path := "release/v1/providers/example-org/example/1.0.0/download/" + doc
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to setup release: %v", err)
+		}
+		writeTestTree(t, ".", map[string]string{path: strings.ReplaceAll(string(data), cfg.Domain, domain)})
+	}
+
+	return server.URL + "/example-org/example", server.Client()
+}
+
+// TestCheck tests the per-platform results of Check against a served release tree.
+func TestCheck(t *testing.T) {
+	versionDir := "release/v1/providers/example-org/example/1.0.0"
+
+	tests := []struct {
+		name          string
+		mutate        func(t *testing.T)
+		wantPlatforms []string
+		wantProblems  []string
+	}{
+		{
+			name:          "valid release",
+			mutate:        func(*testing.T) {},
+			wantPlatforms: []string{"linux_amd64 ok", "darwin_arm64 ok"},
+		},
+		{
+			name: "corrupted zip",
+			mutate: func(t *testing.T) {
+				writeTestTree(t, versionDir, map[string]string{"download/terraform-provider-example_1.0.0_darwin_arm64.zip": "corrupted"})
+			},
+			wantPlatforms: []string{"linux_amd64 ok", "darwin_arm64 failed"},
+			wantProblems:  []string{"terraform-provider-example_1.0.0_darwin_arm64.zip: SHA256"},
+		},
+		{
+			name: "missing signature",
+			mutate: func(t *testing.T) {
+				if err := os.Remove(versionDir + "/terraform-provider-example_1.0.0_SHA256SUMS.sig"); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantPlatforms: []string{"linux_amd64 failed", "darwin_arm64 failed"},
+			wantProblems:  []string{"SHA256SUMS.sig: not found", "SHA256SUMS.sig: not found"},
+		},
+		{
+			name: "missing well-known file",
+			mutate: func(t *testing.T) {
+				if err := os.Remove("release/.well-known/terraform.json"); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantProblems: []string{"/.well-known/terraform.json: not found"},
+		},
+		{
+			name: "unknown provider",
+			mutate: func(t *testing.T) {
+				if err := os.RemoveAll("release/v1/providers/example-org"); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantProblems: []string{"/v1/providers/example-org/example/versions: not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			providerURL, client := serveTestRelease(t)
+			tt.mutate(t)
+
+			report, err := Check(context.Background(), providerURL, WithHTTPClient(client))
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			var platforms []string
+			for _, platform := range report.Platforms {
+				status := "ok"
+				if !platform.OK() {
+					status = "failed"
+				}
+				platforms = append(platforms, platform.Platform+" "+status)
+			}
+			if strings.Join(platforms, ", ") != strings.Join(tt.wantPlatforms, ", ") {
+				t.Errorf("Check() platforms = %v, want %v", platforms, tt.wantPlatforms)
+			}
+
+			if len(report.Problems) != len(tt.wantProblems) {
+				t.Fatalf("Check() problems = %v, want %d problems", report.Problems, len(tt.wantProblems))
+			}
+			for i, want := range tt.wantProblems {
+				if !strings.Contains(report.Problems[i].String(), want) {
+					t.Errorf("Check() problems[%d] = %q, want %q", i, report.Problems[i], want)
+				}
+			}
+			if report.OK() != (len(tt.wantProblems) == 0) {
+				t.Errorf("Check() OK = %v, want %v", report.OK(), len(tt.wantProblems) == 0)
+			}
+		})
+	}
+}
+
+// TestCheckInvalidURL tests that Check rejects URLs that are not provider addresses.
+func TestCheckInvalidURL(t *testing.T) {
+	for _, providerURL := range []string{"registry.example.com/example-org/example", "https://registry.example.com/example-org", "https://registry.example.com/a/b/c", "ftp://registry.example.com/a/b"} {
+		_, err := Check(context.Background(), providerURL)
+		var configErr *ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("Check(%q) error = %v, want *ConfigError", providerURL, err)
+		}
+	}
+}
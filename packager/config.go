@@ -0,0 +1,231 @@
+package packager
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Config describes the provider release to package.
+type Config struct {
+	// Namespace is the registry namespace the provider is published under.
+	Namespace string
+	// Domain is the private registry domain, used to fetch published versions and build URLs.
+	Domain string
+	// Provider is the provider type, e.g. "example" for terraform-provider-example.
+	Provider string
+	// DistPath is the GoReleaser dist directory.
+	DistPath string
+	// OutputDir is the directory the registry tree is written to. It must not be or contain the
+	// working directory, nor be, contain or be inside DistPath.
+	OutputDir string
+	// Incremental merges the version into an existing tree in OutputDir instead of recreating it.
+	// The local well-known and versions files are used when present, other providers and
+	// versions are left untouched and only changed files are written.
+	Incremental bool
+	// RepoName is the repository name used in GoReleaser artifact names.
+	RepoName string
+	// Version is the semantic version of the build, without a leading "v".
+	Version string
+	// GPGFingerprint is the fingerprint or long key ID of the key that signed the SHA256SUMS
+	// file, published as key_id. When empty, the ID of the signing key is used.
+	GPGFingerprint string
+	// GPGPubKeyFile is the ASCII-armored public key the SHA256SUMS signature is verified with
+	// and that is embedded in platform documents.
+	GPGPubKeyFile string
+	// SigningKeys are the keys published in platform documents, e.g. the current and next key
+	// during a rotation. The SHA256SUMS signature must verify against one of them. When empty,
+	// the key in GPGPubKeyFile is published with GPGFingerprint as key ID.
+	SigningKeys []SigningKey
+	// GPGPrivateKeyFile is an ASCII-armored private key. When set, the SHA256SUMS file is signed
+	// with it instead of using the signature from the dist directory.
+	GPGPrivateKeyFile string
+	// GPGPassphrase decrypts GPGPrivateKeyFile when it is protected by a passphrase.
+	GPGPassphrase []byte
+	// Protocols overrides the plugin protocol versions read from the GoReleaser registry manifest.
+	Protocols []string
+	// Platforms and ExcludePlatforms filter the published platforms with <os>_<arch> patterns of
+	// path.Match, e.g. "linux_*". Every platform of the dist directory is published when
+	// Platforms is empty, and platforms matching ExcludePlatforms never are.
+	Platforms        []string
+	ExcludePlatforms []string
+	// RequiredPlatforms are <os>_<arch> platforms that must be published. Nothing is written
+	// when one of them is missing from the dist directory or filtered out.
+	RequiredPlatforms []string
+	// NetworkMirrorDir is the directory a Provider Network Mirror Protocol tree is written to.
+	NetworkMirrorDir string
+	// NetworkMirrorURL is the base URL of the published network mirror, used to merge the new
+	// version into its existing index.json. The local index in NetworkMirrorDir is merged too.
+	NetworkMirrorURL string
+	// FilesystemMirrorDir is the directory a filesystem_mirror or plugin_cache_dir tree is written to.
+	FilesystemMirrorDir string
+	// FilesystemMirrorLayout is the layout of the filesystem mirror, LayoutPacked by default.
+	FilesystemMirrorLayout FilesystemMirrorLayout
+	// LinkMode is how zips are placed into the registry and mirror trees, LinkCopy by default.
+	LinkMode LinkMode
+	// Jobs is the number of zips copied, hashed and published concurrently, GOMAXPROCS when zero.
+	Jobs int
+	// Login is published as the login.v1 service of the well-known file of the output tree, so
+	// that "terraform login" can obtain a token for a registry that requires one.
+	Login *LoginV1
+}
+
+// Validate reports the first missing required or invalid field as a *ConfigError.
+func (c Config) Validate() error {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"Namespace", c.Namespace},
+		{"Domain", c.Domain},
+		{"Provider", c.Provider},
+		{"RepoName", c.RepoName},
+		{"Version", c.Version},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return &ConfigError{Field: r.field, Reason: "is required"}
+		}
+	}
+
+	switch c.FilesystemMirrorLayout {
+	case "", LayoutPacked, LayoutUnpacked:
+	default:
+		return &ConfigError{Field: "FilesystemMirrorLayout", Reason: fmt.Sprintf("must be %q or %q", LayoutPacked, LayoutUnpacked)}
+	}
+
+	switch c.LinkMode {
+	case "", LinkCopy, LinkHardlink, LinkReflink, LinkSymlink:
+	default:
+		return &ConfigError{Field: "LinkMode", Reason: fmt.Sprintf("must be %q, %q, %q or %q", LinkCopy, LinkHardlink, LinkReflink, LinkSymlink)}
+	}
+
+	if c.Jobs < 0 {
+		return &ConfigError{Field: "Jobs", Reason: "must not be negative"}
+	}
+
+	err := validateOutputDir(c.OutputDir, outputDirInput{field: "DistPath", dir: c.DistPath})
+	if err != nil {
+		return err
+	}
+
+	if len(c.Protocols) > 0 {
+		err = validateProtocols(c.Protocols)
+		if err != nil {
+			return &ConfigError{Field: "Protocols", Reason: err.Error()}
+		}
+	}
+
+	for _, patterns := range []struct {
+		field    string
+		patterns []string
+	}{
+		{"Platforms", c.Platforms},
+		{"ExcludePlatforms", c.ExcludePlatforms},
+		{"RequiredPlatforms", c.RequiredPlatforms},
+	} {
+		for _, pattern := range patterns.patterns {
+			goos, arch, ok := strings.Cut(pattern, "_")
+			if _, err := path.Match(pattern, ""); err != nil || !ok || goos == "" || arch == "" || strings.Contains(arch, "_") {
+				return &ConfigError{Field: patterns.field, Reason: fmt.Sprintf("invalid platform %q, want <os>_<arch>", pattern)}
+			}
+			if patterns.field == "RequiredPlatforms" && strings.ContainsAny(pattern, "*?[") {
+				return &ConfigError{Field: patterns.field, Reason: fmt.Sprintf("platform %q must not be a pattern", pattern)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// outputDirInput is an input directory that must survive deleting the output directory.
+type outputDirInput struct {
+	field string
+	dir   string
+	// allowInside allows the output directory inside dir, e.g. in a module source directory
+	// whose archive leaves it out.
+	allowInside bool
+}
+
+// validateOutputDir returns a *ConfigError when deleting outputDir, as a non-incremental run
+// does, would delete the working directory or one of inputs, or when outputDir is inside an
+// input that doesn't allow it. Inputs with an empty dir are not checked.
+func validateOutputDir(outputDir string, inputs ...outputDirInput) error {
+	if outputDir == "" {
+		return &ConfigError{Field: "OutputDir", Reason: "is required"}
+	}
+
+	output, err := filepath.Abs(outputDir)
+	if err != nil {
+		return &ConfigError{Field: "OutputDir", Reason: err.Error()}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return &ConfigError{Field: "OutputDir", Reason: err.Error()}
+	}
+	if isWithin(wd, output) {
+		return &ConfigError{Field: "OutputDir", Reason: fmt.Sprintf("%q must not be or contain the working directory", outputDir)}
+	}
+
+	for _, input := range inputs {
+		if input.dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(input.dir)
+		if err != nil {
+			return &ConfigError{Field: input.field, Reason: err.Error()}
+		}
+		if isWithin(dir, output) {
+			return &ConfigError{Field: "OutputDir", Reason: fmt.Sprintf("%q must not be or contain the %s directory %q", outputDir, input.field, input.dir)}
+		}
+		if !input.allowInside && isWithin(output, dir) {
+			return &ConfigError{Field: "OutputDir", Reason: fmt.Sprintf("%q must not be inside the %s directory %q", outputDir, input.field, input.dir)}
+		}
+	}
+
+	return nil
+}
+
+// SigningKey is a GPG public key published in platform documents.
+type SigningKey struct {
+	// KeyID is the fingerprint or long key ID of the key, published as key_id. When empty, the ID
+	// of the key in PublicKeyFile is used.
+	KeyID string
+	// PublicKeyFile is the ASCII-armored public key, Config.GPGPubKeyFile when empty.
+	PublicKeyFile string
+	// TrustSignatureFile is an optional ASCII-armored signature of the key by a trusted key,
+	// published as trust_signature.
+	TrustSignatureFile string
+	// Source and SourceURL identify the owner of the key.
+	Source    string
+	SourceURL string
+}
+
+// Option customizes a Packager.
+type Option func(*Packager)
+
+// WithAllowNew accepts a 404 Not Found for the well-known or versions file as a provider that
+// has not been published yet. Any other fetch failure still aborts packaging.
+func WithAllowNew(allowNew bool) Option {
+	return func(p *Packager) {
+		p.allowNew = allowNew
+	}
+}
+
+// WithHTTPClient sets the client used to fetch the published versions from the registry.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Packager) {
+		p.httpClient = client
+	}
+}
+
+// WithLogger sets the logger progress messages are written to.
+func WithLogger(logger *log.Logger) Option {
+	return func(p *Packager) {
+		p.logger = logger
+	}
+}
@@ -0,0 +1,98 @@
+package packager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is matched by errors returned when the registry answers with 404 Not Found.
+var ErrNotFound = errors.New("not found")
+
+// ConfigError reports a missing or invalid Config field.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Reason)
+}
+
+// FetchError reports a failed request to the remote registry. StatusCode is zero when no
+// response was received.
+type FetchError struct {
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("fetching %s: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("fetching %s: unexpected status code %d", e.URL, e.StatusCode)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// SignatureError reports a public key or SHA256SUMS signature that Terraform would reject when
+// installing the provider.
+type SignatureError struct {
+	Path string
+	Err  error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("verifying %s: %s", e.Path, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// BinaryError reports a provider zip whose executable is missing, misnamed or built for another
+// platform than the one its file name claims.
+type BinaryError struct {
+	Path string
+	Err  error
+}
+
+func (e *BinaryError) Error() string {
+	return fmt.Sprintf("inspecting %s: %s", e.Path, e.Err)
+}
+
+func (e *BinaryError) Unwrap() error {
+	return e.Err
+}
+
+// ShaSumsError reports an invalid line of a SHA256SUMS file.
+type ShaSumsError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *ShaSumsError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("SHA256SUMS line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Err)
+}
+
+func (e *ShaSumsError) Unwrap() error {
+	return e.Err
+}
+
+// ChecksumError reports a file whose SHA256 differs from its SHA256SUMS entry.
+type ChecksumError struct {
+	Path string
+	// Want is the SHA256 listed in SHA256SUMS and Got the SHA256 of the file.
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s has SHA256 %s, SHA256SUMS lists %s", e.Path, e.Got, e.Want)
+}
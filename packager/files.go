@@ -0,0 +1,165 @@
+package packager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+func deleteDir(path string) error {
+	err := os.RemoveAll(path)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func createDir(path string) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	err := os.Mkdir(path, os.ModePerm)
+	return err
+}
+
+func createDirRecursive(path string) error {
+	err := os.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// copyFile copies src to dst. A dst with the same content is left untouched, so that unchanged
+// files keep their modification time when the tree is synced.
+func copyFile(src, dst string) error {
+	sourceFileStat, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if !sourceFileStat.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+
+	// A link left at dst by another LinkMode is replaced, writing through it would change the
+	// file it points to.
+	if dstInfo, err := os.Lstat(dst); err == nil && (dstInfo.Mode()&os.ModeSymlink != 0 || os.SameFile(sourceFileStat, dstInfo)) {
+		err = removeFile(dst)
+		if err != nil {
+			return err
+		}
+	}
+
+	same, err := sameContent(src, dst)
+	if err != nil || same {
+		return err
+	}
+
+	// A new file is written instead of truncating dst, which may be hardlinked to another file.
+	err = removeFile(dst)
+	if err != nil {
+		return err
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	if err != nil {
+		return err
+	}
+
+	return destination.Close()
+}
+
+// sameContent reports whether the file dst exists and has the same content as src.
+func sameContent(src, dst string) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	dstInfo, err := os.Stat(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !dstInfo.Mode().IsRegular() || srcInfo.Size() != dstInfo.Size() {
+		return false, nil
+	}
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Open(dst)
+	if err != nil {
+		return false, err
+	}
+	defer dstFile.Close()
+
+	srcBuf := make([]byte, 32*1024)
+	dstBuf := make([]byte, 32*1024)
+	for {
+		n, srcErr := io.ReadFull(srcFile, srcBuf)
+		_, dstErr := io.ReadFull(dstFile, dstBuf[:n])
+		if dstErr != nil && !errors.Is(dstErr, io.EOF) {
+			return false, dstErr
+		}
+		if !bytes.Equal(srcBuf[:n], dstBuf[:n]) {
+			return false, nil
+		}
+		if errors.Is(srcErr, io.EOF) || errors.Is(srcErr, io.ErrUnexpectedEOF) {
+			return true, nil
+		}
+		if srcErr != nil {
+			return false, srcErr
+		}
+	}
+}
+
+// writeFile writes fileContents to fileName unless it already has that content.
+func writeFile(fileName string, fileContents []byte) error {
+	existing, err := os.ReadFile(fileName)
+	if err == nil && bytes.Equal(existing, fileContents) {
+		return nil
+	}
+
+	return os.WriteFile(fileName, fileContents, 0644)
+}
+
+// readJSONFile decodes the JSON file at path into v. It returns false when the file does not exist.
+func readJSONFile(path string, v any) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return false, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return true, nil
+}
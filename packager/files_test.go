@@ -0,0 +1,362 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCreateDir tests the createDir function.
+func TestCreateDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		createNew bool
+		wantErr   bool
+	}{
+		{
+			name:      "create new directory",
+			createNew: true,
+			wantErr:   false,
+		},
+		{
+			name:      "create existing directory",
+			createNew: false,
+			wantErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testPath := filepath.Join(tmpDir, "test_dir")
+
+			// For existing directory test, create it first
+			if !tt.createNew {
+				err := os.Mkdir(testPath, os.ModePerm)
+				if err != nil {
+					t.Fatalf("Failed to setup test: %v", err)
+				}
+			}
+
+			err := createDir(testPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			// Verify directory exists
+			if _, err := os.Stat(testPath); os.IsNotExist(err) && !tt.wantErr {
+				t.Errorf("Directory was not created: %v", testPath)
+			}
+		})
+	}
+}
+
+// TestCreateDirRecursive tests the createDirRecursive function.
+func TestCreateDirRecursive(t *testing.T) {
+	tests := []struct {
+		name    string
+		subpath string
+		wantErr bool
+	}{
+		{
+			name:    "create nested directories",
+			subpath: "level1/level2/level3",
+			wantErr: false,
+		},
+		{
+			name:    "create single directory",
+			subpath: "single",
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testPath := filepath.Join(tmpDir, tt.subpath)
+
+			err := createDirRecursive(testPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createDirRecursive() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			// Verify directory exists
+			if _, err := os.Stat(testPath); os.IsNotExist(err) && !tt.wantErr {
+				t.Errorf("Directory was not created: %v", testPath)
+			}
+		})
+	}
+}
+
+// TestDeleteDir tests the deleteDir function.
+func TestDeleteDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		createDir bool
+		wantErr   bool
+	}{
+		{
+			name:      "delete existing directory",
+			createDir: true,
+			wantErr:   false,
+		},
+		{
+			name:      "delete non-existing directory",
+			createDir: false,
+			wantErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testPath := filepath.Join(tmpDir, "test_delete")
+
+			// Setup: create directory if needed
+			if tt.createDir {
+				if err := os.MkdirAll(testPath, os.ModePerm); err != nil {
+					t.Fatalf("Failed to setup test: %v", err)
+				}
+			}
+
+			err := deleteDir(testPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("deleteDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			// Verify directory doesn't exist
+			if _, err := os.Stat(testPath); !os.IsNotExist(err) && !tt.wantErr {
+				t.Errorf("Directory was not deleted: %v", testPath)
+			}
+		})
+	}
+}
+
+// TestCopyFile tests the copyFile function.
+func TestCopyFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		setupErr  bool
+		wantErr   bool
+		errString string
+	}{
+		{
+			name:    "copy regular file",
+			content: "test content\nline 2\nline 3",
+			wantErr: false,
+		},
+		{
+			name:      "copy non-existing file",
+			content:   "",
+			setupErr:  true,
+			wantErr:   true,
+			errString: "no such file or directory",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			srcPath := filepath.Join(tmpDir, "src.txt")
+			dstPath := filepath.Join(tmpDir, "dst.txt")
+
+			// Setup: create source file
+			if !tt.setupErr {
+				err := os.WriteFile(srcPath, []byte(tt.content), 0644)
+				if err != nil {
+					t.Fatalf("Failed to setup test: %v", err)
+				}
+			}
+
+			err := copyFile(srcPath, dstPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("copyFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr && err != nil && tt.errString != "" {
+				if !strings.Contains(err.Error(), tt.errString) {
+					t.Errorf("Expected error containing %q, got %q", tt.errString, err.Error())
+				}
+				return
+			}
+
+			if !tt.wantErr {
+				// Verify file was copied correctly
+				content, err := os.ReadFile(dstPath)
+				if err != nil {
+					t.Errorf("Failed to read destination file: %v", err)
+					return
+				}
+				if string(content) != tt.content {
+					t.Errorf("File content mismatch. Got %q, want %q", string(content), tt.content)
+				}
+			}
+		})
+	}
+}
+
+// TestWriteFile tests the writeFile function.
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{
+			name:    "write text content",
+			content: []byte("test content"),
+			wantErr: false,
+		},
+		{
+			name:    "write empty content",
+			content: []byte(""),
+			wantErr: false,
+		},
+		{
+			name:    "write JSON content",
+			content: []byte(`{"key": "value"}`),
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			filePath := filepath.Join(tmpDir, "test_file.txt")
+
+			err := writeFile(filePath, tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			// Verify file was written correctly
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Errorf("Failed to read written file: %v", err)
+				return
+			}
+			if string(content) != string(tt.content) {
+				t.Errorf("File content mismatch. Got %q, want %q", string(content), string(tt.content))
+			}
+		})
+	}
+}
+
+// TestWriteUnchangedFiles tests that writeFile and copyFile leave files with the same content untouched.
+func TestWriteUnchangedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "src")
+	dst := filepath.Join(tmpDir, "dst")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name        string
+		existing    string
+		write       func() error
+		wantContent string
+		wantTouched bool
+	}{
+		{
+			name:        "write same content",
+			existing:    "content",
+			write:       func() error { return writeFile(dst, []byte("content")) },
+			wantContent: "content",
+		},
+		{
+			name:        "write new content",
+			existing:    "content",
+			write:       func() error { return writeFile(dst, []byte("changed")) },
+			wantContent: "changed",
+			wantTouched: true,
+		},
+		{
+			name:        "copy same content",
+			existing:    "source",
+			write:       func() error { return copyFile(src, dst) },
+			wantContent: "source",
+		},
+		{
+			name:        "copy same size, different content",
+			existing:    "SOURCE",
+			write:       func() error { return copyFile(src, dst) },
+			wantContent: "source",
+			wantTouched: true,
+		},
+		{
+			name:        "copy different size",
+			existing:    "src",
+			write:       func() error { return copyFile(src, dst) },
+			wantContent: "source",
+			wantTouched: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(src, []byte("source"), 0644); err != nil {
+				t.Fatalf("Failed to setup source: %v", err)
+			}
+			if err := os.WriteFile(dst, []byte(tt.existing), 0644); err != nil {
+				t.Fatalf("Failed to setup destination: %v", err)
+			}
+			if err := os.Chtimes(dst, old, old); err != nil {
+				t.Fatalf("Failed to setup destination: %v", err)
+			}
+
+			if err := tt.write(); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+
+			content, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatalf("Failed to read destination: %v", err)
+			}
+			if string(content) != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatalf("Failed to stat destination: %v", err)
+			}
+			if touched := !info.ModTime().Equal(old); touched != tt.wantTouched {
+				t.Errorf("modified = %v, want %v", touched, tt.wantTouched)
+			}
+		})
+	}
+}
+
+// TestReadJSONFile tests the readJSONFile function.
+func TestReadJSONFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var v WellKnown
+	ok, err := readJSONFile(filepath.Join(tmpDir, "missing.json"), &v)
+	if ok || err != nil {
+		t.Errorf("readJSONFile(missing) = %v, %v, want false, nil", ok, err)
+	}
+
+	valid := filepath.Join(tmpDir, "valid.json")
+	if err := os.WriteFile(valid, []byte(`{"providers.v1": "/v1/providers/"}`), 0644); err != nil {
+		t.Fatalf("Failed to setup file: %v", err)
+	}
+	ok, err = readJSONFile(valid, &v)
+	if !ok || err != nil || v.ProvidersV1 != "/v1/providers/" {
+		t.Errorf("readJSONFile(valid) = %v, %v, %+v", ok, err, v)
+	}
+
+	invalid := filepath.Join(tmpDir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{`), 0644); err != nil {
+		t.Fatalf("Failed to setup file: %v", err)
+	}
+	if _, err := readJSONFile(invalid, &v); err == nil {
+		t.Error("readJSONFile(invalid) expected error, got nil")
+	}
+}
@@ -0,0 +1,183 @@
+package packager
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilesystemMirrorLayout is one of the directory layouts Terraform's filesystem_mirror and
+// plugin_cache_dir accept.
+type FilesystemMirrorLayout string
+
+const (
+	// LayoutPacked keeps the original zips as
+	// <domain>/<namespace>/<type>/terraform-provider-<type>_<version>_<os>_<arch>.zip.
+	LayoutPacked FilesystemMirrorLayout = "packed"
+	// LayoutUnpacked extracts the zips into <domain>/<namespace>/<type>/<version>/<os>_<arch>/.
+	LayoutUnpacked FilesystemMirrorLayout = "unpacked"
+)
+
+// PackageFilesystemMirror writes the configured provider version into Config.FilesystemMirrorDir
+// using Config.FilesystemMirrorLayout.
+func (p *Packager) PackageFilesystemMirror(ctx context.Context) error {
+	if p.cfg.FilesystemMirrorDir == "" {
+		return &ConfigError{Field: "FilesystemMirrorDir", Reason: "is required"}
+	}
+
+	files, err := p.loadRelease(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = p.inspectBinaries(ctx, files)
+	if err != nil {
+		return fmt.Errorf("inspecting provider binaries: %w", err)
+	}
+
+	return p.packageFilesystemMirror(ctx, files)
+}
+
+// packageFilesystemMirror writes the filesystem mirror tree of files, Config.Jobs zips at a time.
+func (p *Packager) packageFilesystemMirror(ctx context.Context, files []releaseFile) error {
+	p.logger.Printf("* Creating %s filesystem mirror in %s directory", p.cfg.FilesystemMirrorLayout, p.cfg.FilesystemMirrorDir)
+
+	providerPath := filepath.Join(p.cfg.FilesystemMirrorDir, p.cfg.Domain, p.cfg.Namespace, p.cfg.Provider)
+
+	return p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		fileName := file.name
+
+		if !strings.HasSuffix(fileName, ".zip") {
+			p.skip(fileName, "not a zip file")
+			return nil
+		}
+		if !file.platformZip {
+			p.skip(fileName, "not in the expected format")
+			return nil
+		}
+
+		zipSrcPath := filepath.Join(p.cfg.DistPath, fileName)
+
+		for _, platform := range file.platforms {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if p.cfg.FilesystemMirrorLayout == LayoutUnpacked {
+				platformPath := filepath.Join(providerPath, p.cfg.Version, platform.Os+"_"+platform.Arch)
+				p.logger.Printf("  - Unpacked: %s", platformPath)
+
+				err := p.unzip(zipSrcPath, platformPath)
+				if err != nil {
+					return fmt.Errorf("extracting %s: %w", zipSrcPath, err)
+				}
+				continue
+			}
+
+			// Terraform only recognizes packed archives named after the provider type, which
+			// differs from the GoReleaser name when the repository is not terraform-provider-<type>.
+			zipDestPath := filepath.Join(providerPath, fmt.Sprintf("terraform-provider-%s_%s_%s_%s.zip", p.cfg.Provider, p.cfg.Version, platform.Os, platform.Arch))
+			p.logger.Printf("  - Packed: %s", zipDestPath)
+
+			err := p.createDirRecursive(providerPath)
+			if err != nil {
+				return err
+			}
+			err = p.placeZip(zipSrcPath, zipDestPath, file.sum)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// unzip replaces destPath with the contents of the zip at zipPath. Entries escaping destPath are
+// rejected.
+func unzip(zipPath, destPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	err = deleteDir(destPath)
+	if err != nil {
+		return err
+	}
+	err = createDirRecursive(destPath)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range reader.File {
+		entryPath, err := zipEntryPath(f, destPath)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			err = createDirRecursive(entryPath)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = createDirRecursive(filepath.Dir(entryPath))
+		if err != nil {
+			return err
+		}
+		err = extractFile(f, entryPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// zipEntryPath returns the path of the zip entry f extracted into destPath. Entries escaping
+// destPath and entries other than files and directories are rejected.
+func zipEntryPath(f *zip.File, destPath string) (string, error) {
+	if !filepath.IsLocal(f.Name) {
+		return "", fmt.Errorf("zip entry %q is outside of the archive", f.Name)
+	}
+	if !f.FileInfo().IsDir() && !f.Mode().IsRegular() {
+		return "", fmt.Errorf("zip entry %q is not a regular file", f.Name)
+	}
+
+	return filepath.Join(destPath, f.Name), nil
+}
+
+// extractFile writes the zip entry f to path. The provider binary is made executable even when
+// the zip does not record permissions.
+func extractFile(f *zip.File, path string) error {
+	mode := f.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	if strings.HasPrefix(filepath.Base(f.Name), "terraform-provider-") {
+		mode |= 0755
+	}
+
+	source, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	return err
+}
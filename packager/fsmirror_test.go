@@ -0,0 +1,165 @@
+package packager
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPackageFilesystemMirror tests the packed and unpacked filesystem mirror layouts.
+func TestPackageFilesystemMirror(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    FilesystemMirrorLayout
+		repoName  string
+		wantFiles []string
+	}{
+		{
+			name:   "packed",
+			layout: LayoutPacked,
+			wantFiles: []string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip",
+				"terraform-provider-example_1.0.0_darwin_arm64.zip",
+			},
+		},
+		{
+			name:     "packed with custom repository name",
+			layout:   LayoutPacked,
+			repoName: "tf-example",
+			wantFiles: []string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip",
+				"terraform-provider-example_1.0.0_darwin_arm64.zip",
+			},
+		},
+		{
+			name:   "unpacked",
+			layout: LayoutUnpacked,
+			wantFiles: []string{
+				"1.0.0/linux_amd64/terraform-provider-example_v1.0.0",
+				"1.0.0/darwin_arm64/terraform-provider-example_v1.0.0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			cfg := testConfig(distPath)
+			if tt.repoName != "" {
+				cfg.RepoName = tt.repoName
+			}
+			cfg.FilesystemMirrorDir = filepath.Join(tmpDir, "mirror")
+			cfg.FilesystemMirrorLayout = tt.layout
+
+			if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup dist: %v", err)
+			}
+			shaSumContent := ""
+			for _, platform := range []string{"linux_amd64", "darwin_arm64"} {
+				zipName := cfg.RepoName + "_1.0.0_" + platform + ".zip"
+				shasum := writeTestZip(t, filepath.Join(distPath, zipName), map[string]string{
+					"terraform-provider-example_v1.0.0": testExecutable(t, platform),
+					"README.md":                         "readme",
+				})
+				shaSumContent += shasum + "  " + zipName + "\n"
+			}
+			shaSumPath := filepath.Join(distPath, cfg.RepoName+"_1.0.0_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			p := newTestPackager(t, cfg)
+			if err := p.PackageFilesystemMirror(context.Background()); err != nil {
+				t.Fatalf("PackageFilesystemMirror() error = %v", err)
+			}
+
+			providerPath := filepath.Join(cfg.FilesystemMirrorDir, cfg.Domain, cfg.Namespace, cfg.Provider)
+			for _, file := range tt.wantFiles {
+				info, err := os.Stat(filepath.Join(providerPath, file))
+				if err != nil {
+					t.Errorf("Expected mirror file %s: %v", file, err)
+					continue
+				}
+				if tt.layout == LayoutUnpacked && info.Mode().Perm()&0100 == 0 {
+					t.Errorf("Provider binary %s is not executable: %v", file, info.Mode())
+				}
+			}
+		})
+	}
+}
+
+// TestUnzip tests that unzip replaces the destination and rejects entries outside of it.
+func TestUnzip(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "nested files",
+			files: map[string]string{"terraform-provider-example_v1.0.0": "binary", "docs/README.md": "readme"},
+		},
+		{
+			name:    "parent directory entry",
+			files:   map[string]string{"../evil": "evil"},
+			wantErr: true,
+		},
+		{
+			name:    "absolute entry",
+			files:   map[string]string{"/tmp/evil": "evil"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			zipPath := filepath.Join(tmpDir, "provider.zip")
+			destPath := filepath.Join(tmpDir, "out", "linux_amd64")
+			writeTestZip(t, zipPath, tt.files)
+
+			// A stale file from a previous run must not survive.
+			if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup test: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(destPath, "stale"), []byte("stale"), 0644); err != nil {
+				t.Fatalf("Failed to setup test: %v", err)
+			}
+
+			err := unzip(zipPath, destPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unzip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "out", "evil")); !os.IsNotExist(err) {
+				t.Error("unzip() wrote outside of the destination")
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, err := os.Stat(filepath.Join(destPath, "stale")); !os.IsNotExist(err) {
+				t.Error("unzip() kept a stale file")
+			}
+			for name, content := range tt.files {
+				got, err := os.ReadFile(filepath.Join(destPath, name))
+				if err != nil || string(got) != content {
+					t.Errorf("unzip() %s = %q, %v, want %q", name, got, err, content)
+				}
+			}
+		})
+	}
+}
+
+// TestPackageFilesystemMirrorRequiresDir tests that PackageFilesystemMirror needs an output directory.
+func TestPackageFilesystemMirrorRequiresDir(t *testing.T) {
+	p := newTestPackager(t, testConfig("dist"))
+
+	err := p.PackageFilesystemMirror(context.Background())
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Field != "FilesystemMirrorDir" {
+		t.Errorf("PackageFilesystemMirror() error = %v, want *ConfigError for FilesystemMirrorDir", err)
+	}
+}
@@ -0,0 +1,137 @@
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// hashesFileName is the sidecar written next to the SHA256SUMS of a version.
+const hashesFileName = "hashes.json"
+
+// packageHashV1 returns the "h1:" hash Terraform records in lock files, a hash of the files
+// contained in the provider zip rather than of the zip itself.
+func packageHashV1(zipPath string) (string, error) {
+	return dirhash.HashZip(zipPath, dirhash.Hash1)
+}
+
+// zipHash returns the "zh:" lock file hash of a zip from its hex-encoded SHA256 sum.
+func zipHash(shasum string) string {
+	return "zh:" + shasum
+}
+
+// hashPlatform returns the lock file hashes of the platform zip at zipPath with the given SHA256 sum.
+func hashPlatform(zipPath, shasum string) (PlatformHashes, error) {
+	h1, err := packageHashV1(zipPath)
+	if err != nil {
+		return PlatformHashes{}, fmt.Errorf("hashing %s: %w", zipPath, err)
+	}
+
+	return PlatformHashes{
+		Filename: filepath.Base(zipPath),
+		H1:       h1,
+		ZH:       zipHash(shasum),
+	}, nil
+}
+
+func (p *Packager) writeHashesFile(versionPath string, hashes VersionHashes) error {
+	hashesFile, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return p.writeFile(filepath.Join(versionPath, hashesFileName), hashesFile)
+}
+
+// Hashes computes the lock file hashes of the platform zips in the dist directory, Config.Jobs
+// zips at a time.
+func (p *Packager) Hashes(ctx context.Context) (VersionHashes, error) {
+	files, err := p.loadRelease(ctx)
+	if err != nil {
+		return VersionHashes{Version: p.cfg.Version, Platforms: map[string]PlatformHashes{}}, err
+	}
+
+	return p.versionHashes(ctx, files)
+}
+
+// versionHashes computes the lock file hashes of the published platform zips of files, verified
+// by loadRelease, Config.Jobs zips at a time.
+func (p *Packager) versionHashes(ctx context.Context, files []releaseFile) (VersionHashes, error) {
+	hashes := VersionHashes{Version: p.cfg.Version, Platforms: map[string]PlatformHashes{}}
+
+	var mu sync.Mutex
+	err := p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		if !file.platformZip || len(file.platforms) == 0 {
+			return nil
+		}
+
+		platformHashes, err := hashPlatform(filepath.Join(p.cfg.DistPath, file.name), file.sum)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, platform := range file.platforms {
+			hashes.Platforms[platform.Os+"_"+platform.Arch] = platformHashes
+		}
+
+		return nil
+	})
+
+	return hashes, err
+}
+
+// FetchHashes downloads the hashes.json sidecar of the configured version from the registry.
+func (p *Packager) FetchHashes(ctx context.Context) (VersionHashes, error) {
+	var hashes VersionHashes
+
+	var wellKnownData WellKnown
+	wellKnownUrl := fmt.Sprintf("https://%s/.well-known/terraform.json", p.cfg.Domain)
+	err := p.fetchJSON(ctx, wellKnownUrl, &wellKnownData)
+	if err != nil {
+		return hashes, fmt.Errorf("downloading well-known file: %w", err)
+	}
+
+	hashesUrl := fmt.Sprintf("https://%s%s%s/%s/%s/%s", p.cfg.Domain, wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider, p.cfg.Version, hashesFileName)
+	err = p.fetchJSON(ctx, hashesUrl, &hashes)
+	if err != nil {
+		return hashes, fmt.Errorf("downloading hashes file: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// LockBlock returns the .terraform.lock.hcl provider block for address, e.g.
+// "registry.example.com/example-org/example", listing the hashes of every platform.
+func LockBlock(address string, hashes VersionHashes) string {
+	seen := map[string]bool{}
+	var lockHashes []string
+	for _, platform := range hashes.Platforms {
+		for _, hash := range []string{platform.H1, platform.ZH} {
+			if hash != "" && !seen[hash] {
+				seen[hash] = true
+				lockHashes = append(lockHashes, hash)
+			}
+		}
+	}
+	sort.Strings(lockHashes)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "provider %q {\n", address)
+	fmt.Fprintf(&b, "  version = %q\n", hashes.Version)
+	fmt.Fprintln(&b, "  hashes = [")
+	for _, hash := range lockHashes {
+		fmt.Fprintf(&b, "    %q,\n", hash)
+	}
+	fmt.Fprintln(&b, "  ]")
+	fmt.Fprintln(&b, "}")
+
+	return b.String()
+}
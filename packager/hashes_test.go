@@ -0,0 +1,179 @@
+package packager
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestZip writes a zip containing files to path and returns its hex-encoded SHA256 sum.
+func writeTestZip(t testing.TB, path string, files map[string]string) string {
+	t.Helper()
+
+	zipFile, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	defer zipFile.Close()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := zip.NewWriter(zipFile)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s to zip: %v", name, err)
+		}
+		if _, err := f.Write([]byte(files[name])); err != nil {
+			t.Fatalf("Failed to write %s to zip: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close zip: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// TestPackageHashV1 tests packageHashV1 against the documented h1 algorithm.
+func TestPackageHashV1(t *testing.T) {
+	files := map[string]string{
+		"terraform-provider-example_v1.0.0": "binary",
+		"LICENSE":                           "license",
+	}
+	zipPath := filepath.Join(t.TempDir(), "provider.zip")
+	writeTestZip(t, zipPath, files)
+
+	// h1 is the SHA256 of the sorted "<sha256 hex>  <name>\n" lines of the zip contents.
+	summary := sha256.New()
+	for _, name := range []string{"LICENSE", "terraform-provider-example_v1.0.0"} {
+		sum := sha256.Sum256([]byte(files[name]))
+		fmt.Fprintf(summary, "%x  %s\n", sum, name)
+	}
+	want := "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil))
+
+	got, err := packageHashV1(zipPath)
+	if err != nil {
+		t.Fatalf("packageHashV1() error = %v", err)
+	}
+	if got != want {
+		t.Errorf("packageHashV1() = %v, want %v", got, want)
+	}
+}
+
+// TestPackageHashV1Error tests packageHashV1 with a file that is not a zip.
+func TestPackageHashV1Error(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.zip")
+	if err := os.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+
+	if _, err := packageHashV1(path); err == nil {
+		t.Error("packageHashV1() expected error for invalid zip, got nil")
+	}
+}
+
+// TestZipHash tests the zipHash function.
+func TestZipHash(t *testing.T) {
+	if got := zipHash("abc123"); got != "zh:abc123" {
+		t.Errorf("zipHash() = %v, want zh:abc123", got)
+	}
+}
+
+// TestHashes tests that Hashes covers every platform zip of the dist directory.
+func TestHashes(t *testing.T) {
+	distPath := t.TempDir()
+	shasums := writeTestDist(t, distPath, "linux_amd64", "windows_amd64")
+	p := newTestPackager(t, testConfig(distPath))
+
+	hashes, err := p.Hashes(context.Background())
+	if err != nil {
+		t.Fatalf("Hashes() error = %v", err)
+	}
+
+	if hashes.Version != "1.0.0" || len(hashes.Platforms) != 2 {
+		t.Fatalf("Hashes() = %+v, want 2 platforms of 1.0.0", hashes)
+	}
+	for platform, shasum := range shasums {
+		zipName := "terraform-provider-example_1.0.0_" + platform + ".zip"
+		h1, err := packageHashV1(filepath.Join(distPath, zipName))
+		if err != nil {
+			t.Fatalf("packageHashV1() error = %v", err)
+		}
+		want := PlatformHashes{Filename: zipName, H1: h1, ZH: "zh:" + shasum}
+		if hashes.Platforms[platform] != want {
+			t.Errorf("Hashes() %s = %+v, want %+v", platform, hashes.Platforms[platform], want)
+		}
+	}
+}
+
+// TestFetchHashes tests downloading the hashes.json sidecar from the registry.
+func TestFetchHashes(t *testing.T) {
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json":                         {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+		"/v1/providers/example-org/example/1.0.0/hashes.json": {http.StatusOK, `{"version": "1.0.0", "platforms": {"linux_amd64": {"h1": "h1:abc", "zh": "zh:def"}}}`},
+	})
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+
+	hashes, err := p.FetchHashes(context.Background())
+	if err != nil {
+		t.Fatalf("FetchHashes() error = %v", err)
+	}
+	if hashes.Platforms["linux_amd64"].H1 != "h1:abc" {
+		t.Errorf("FetchHashes() = %+v", hashes)
+	}
+
+	cfg.Version = "2.0.0"
+	p = newTestPackager(t, cfg, WithHTTPClient(client))
+	if _, err := p.FetchHashes(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FetchHashes() error = %v, want ErrNotFound", err)
+	}
+}
+
+// TestLockBlock tests the generated .terraform.lock.hcl provider block.
+func TestLockBlock(t *testing.T) {
+	hashes := VersionHashes{
+		Version: "1.0.0",
+		Platforms: map[string]PlatformHashes{
+			"linux_amd64":  {H1: "h1:linux", ZH: "zh:bbb"},
+			"darwin_arm64": {H1: "h1:darwin", ZH: "zh:aaa"},
+			"windows_386":  {H1: "h1:darwin", ZH: "zh:ccc"},
+		},
+	}
+
+	want := `provider "registry.example.com/example-org/example" {
+  version = "1.0.0"
+  hashes = [
+    "h1:darwin",
+    "h1:linux",
+    "zh:aaa",
+    "zh:bbb",
+    "zh:ccc",
+  ]
+}
+`
+	if got := LockBlock("registry.example.com/example-org/example", hashes); got != want {
+		t.Errorf("LockBlock() =\n%s\nwant\n%s", got, want)
+	}
+}
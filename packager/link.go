@@ -0,0 +1,138 @@
+package packager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LinkMode is how the zips of the dist directory are placed into the registry and mirror trees.
+type LinkMode string
+
+const (
+	// LinkCopy copies the zips.
+	LinkCopy LinkMode = "copy"
+	// LinkHardlink hardlinks the zips, and copies them when the dist directory and the tree are
+	// on different filesystems.
+	LinkHardlink LinkMode = "hardlink"
+	// LinkReflink clones the zips on filesystems with copy-on-write support, such as Btrfs or
+	// XFS, and copies them otherwise.
+	LinkReflink LinkMode = "reflink"
+	// LinkSymlink symlinks the zips to their absolute path in the dist directory, which must be
+	// kept as long as the tree is served.
+	LinkSymlink LinkMode = "symlink"
+)
+
+// placeZip places the zip src, whose SHA256 loadRelease verified to be sum, at dst according to
+// Config.LinkMode. A dst already linked to src is left untouched.
+func (p *Packager) placeZip(src, dst, sum string) error {
+	if p.plan != nil {
+		return p.planZip(src, dst, sum)
+	}
+
+	switch p.cfg.LinkMode {
+	case LinkHardlink:
+		err := hardlinkFile(src, dst)
+		if errors.Is(err, syscall.EXDEV) {
+			p.warnf("Cannot hardlink %s across filesystems, copying...", src)
+			return copyFile(src, dst)
+		}
+		return err
+	case LinkReflink:
+		err := reflinkFile(src, dst)
+		if errors.Is(err, errors.ErrUnsupported) {
+			p.warnf("Cannot reflink %s, copying...", src)
+			return copyFile(src, dst)
+		}
+		return err
+	case LinkSymlink:
+		return symlinkFile(src, dst)
+	}
+
+	return copyFile(src, dst)
+}
+
+// hardlinkFile replaces dst with a hardlink to src, unless it already is one.
+func hardlinkFile(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	dstInfo, err := os.Lstat(dst)
+	if err == nil && os.SameFile(srcInfo, dstInfo) {
+		return nil
+	}
+
+	err = removeFile(dst)
+	if err != nil {
+		return err
+	}
+
+	return os.Link(src, dst)
+}
+
+// symlinkFile replaces dst with a symlink to the absolute path of src, unless it already is one.
+func symlinkFile(src, dst string) error {
+	target, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	if existing, err := os.Readlink(dst); err == nil && existing == target {
+		return nil
+	}
+
+	err = removeFile(dst)
+	if err != nil {
+		return err
+	}
+
+	return os.Symlink(target, dst)
+}
+
+// reflinkFile replaces dst with a copy-on-write clone of src. The error wraps
+// errors.ErrUnsupported when the platform or filesystems cannot clone src to dst.
+func reflinkFile(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+
+	// Writing into an existing dst could write through a link to another file.
+	err = removeFile(dst)
+	if err != nil {
+		return err
+	}
+
+	err = reflink(src, dst)
+	if err != nil {
+		removeFile(dst)
+		return err
+	}
+
+	return nil
+}
+
+// removeFile removes the file or link at path, if any.
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
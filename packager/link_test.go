@@ -0,0 +1,111 @@
+package packager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestPlaceZip tests that every link mode places the zip and can replace the file placed by
+// another mode without changing the dist directory.
+func TestPlaceZip(t *testing.T) {
+	tests := []struct {
+		mode     LinkMode
+		wantSame bool
+		wantLink bool
+	}{
+		{mode: LinkCopy},
+		{mode: LinkHardlink, wantSame: true},
+		{mode: LinkReflink},
+		{mode: LinkSymlink, wantSame: true, wantLink: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			src := filepath.Join(tmpDir, "dist", "terraform-provider-example_1.0.0_linux_amd64.zip")
+			dst := filepath.Join(tmpDir, "release", "terraform-provider-example_1.0.0_linux_amd64.zip")
+			writeTestTree(t, tmpDir, map[string]string{
+				"dist/terraform-provider-example_1.0.0_linux_amd64.zip":    "zip content",
+				"release/terraform-provider-example_1.0.0_linux_amd64.zip": "previous content",
+			})
+			cfg := testConfig(filepath.Join(tmpDir, "dist"))
+			cfg.LinkMode = tt.mode
+			p := newTestPackager(t, cfg)
+
+			// The second placement finds the zip already in place.
+			for range 2 {
+				if err := p.placeZip(src, dst, testShaSum); err != nil {
+					t.Fatalf("placeZip() error = %v", err)
+				}
+			}
+
+			content, err := os.ReadFile(dst)
+			if err != nil || string(content) != "zip content" {
+				t.Errorf("placed zip = %q, %v, want %q", content, err, "zip content")
+			}
+			srcInfo, _ := os.Stat(src)
+			dstInfo, _ := os.Stat(dst)
+			if same := os.SameFile(srcInfo, dstInfo); same != tt.wantSame {
+				t.Errorf("placed zip is the dist zip = %v, want %v", same, tt.wantSame)
+			}
+			linkInfo, _ := os.Lstat(dst)
+			if link := linkInfo.Mode()&os.ModeSymlink != 0; link != tt.wantLink {
+				t.Errorf("placed zip is a symlink = %v, want %v", link, tt.wantLink)
+			}
+
+			// Copying over a link must not write through it into the dist directory.
+			writeTestTree(t, tmpDir, map[string]string{"dist/other.zip": "other content"})
+			err = copyFile(filepath.Join(tmpDir, "dist", "other.zip"), dst)
+			if err != nil {
+				t.Fatalf("copyFile() error = %v", err)
+			}
+			content, err = os.ReadFile(src)
+			if err != nil || string(content) != "zip content" {
+				t.Errorf("dist zip = %q, %v after copying over the placed zip, want %q", content, err, "zip content")
+			}
+		})
+	}
+}
+
+// TestPlaceZipAcrossFilesystems tests that hardlinks and reflinks fall back to a copy, with a
+// warning, when the dist directory and the tree are on different filesystems.
+func TestPlaceZipAcrossFilesystems(t *testing.T) {
+	otherFS, err := os.MkdirTemp("/dev/shm", "tfpp-test-")
+	if err != nil {
+		t.Skipf("No /dev/shm filesystem: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(otherFS) })
+
+	distPath := t.TempDir()
+	src := filepath.Join(distPath, "terraform-provider-example_1.0.0_linux_amd64.zip")
+	writeTestTree(t, distPath, map[string]string{"terraform-provider-example_1.0.0_linux_amd64.zip": "zip content"})
+	if err := os.Link(src, filepath.Join(otherFS, "probe")); !errors.Is(err, syscall.EXDEV) {
+		t.Skipf("%s and %s are on the same filesystem", distPath, otherFS)
+	}
+
+	for _, mode := range []LinkMode{LinkHardlink, LinkReflink} {
+		t.Run(string(mode), func(t *testing.T) {
+			cfg := testConfig(distPath)
+			cfg.LinkMode = mode
+			p := newTestPackager(t, cfg)
+			p.report = newReporter(cfg)
+
+			dst := filepath.Join(otherFS, string(mode)+".zip")
+			err := p.placeZip(src, dst, testShaSum)
+			if err != nil {
+				t.Fatalf("placeZip() error = %v", err)
+			}
+			content, err := os.ReadFile(dst)
+			if err != nil || string(content) != "zip content" {
+				t.Errorf("placed zip = %q, %v, want %q", content, err, "zip content")
+			}
+			if warnings := p.report.result().Warnings; len(warnings) != 1 || !strings.Contains(warnings[0], "copying") {
+				t.Errorf("warnings = %v, want the copy fallback", warnings)
+			}
+		})
+	}
+}
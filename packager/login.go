@@ -0,0 +1,222 @@
+package packager
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The login.v1 service of a Server implements the OAuth 2.0 authorization code grant with PKCE
+// that "terraform login" uses. The authorization page asks for a token of the TokenACL, which is
+// handed to Terraform by the token endpoint, so that it ends up in the CLI credentials.
+const (
+	loginClient    = "terraform-cli"
+	loginAuthzPath = "/oauth/authorization"
+	loginTokenPath = "/oauth/token"
+	loginCodeTTL   = 5 * time.Minute
+)
+
+// loginService is the login.v1 service advertised by a Server with ServerConfig.Login.
+var loginService = LoginV1{
+	Client:     loginClient,
+	GrantTypes: []string{"authz_code"},
+	Authz:      loginAuthzPath,
+	Token:      loginTokenPath,
+	Ports:      []int{10000, 10010},
+}
+
+// authCode is an authorization code issued by the authorization page, redeemed once for token.
+type authCode struct {
+	token       string
+	challenge   string
+	redirectURI string
+	expires     time.Time
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Terraform login</title></head>
+<body>
+<h1>Terraform login</h1>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+<form method="post">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>API token <input type="password" name="token" autofocus></label>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizationParams are the request parameters of the authorization page, kept in its form.
+var authorizationParams = []string{"client_id", "response_type", "redirect_uri", "state", "code_challenge", "code_challenge_method"}
+
+// serveAuthorization shows the page asking for an API token and, once a known token is submitted,
+// redirects to the Terraform callback with an authorization code.
+func (s *Server) serveAuthorization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	params := map[string]string{}
+	for _, name := range authorizationParams {
+		params[name] = r.Form.Get(name)
+	}
+	if params["client_id"] != loginClient || params["response_type"] != "code" || params["code_challenge_method"] != "S256" || params["code_challenge"] == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(params["redirect_uri"])
+	if err != nil || redirectURI.Scheme != "http" || !isLoopback(redirectURI.Hostname()) {
+		http.Error(w, "invalid redirect_uri, Terraform listens on a loopback address", http.StatusBadRequest)
+		return
+	}
+
+	page := struct {
+		Params map[string]string
+		Error  string
+	}{Params: params}
+
+	if r.Method == http.MethodGet {
+		s.writeLoginPage(w, http.StatusOK, page)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if _, ok := s.cfg.Tokens.namespaces(token); !ok || token == "" {
+		page.Error = "Unknown API token."
+		s.writeLoginPage(w, http.StatusUnauthorized, page)
+		return
+	}
+
+	code, err := s.issueCode(authCode{
+		token:       token,
+		challenge:   params["code_challenge"],
+		redirectURI: params["redirect_uri"],
+		expires:     time.Now().Add(loginCodeTTL),
+	})
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+
+	query := redirectURI.Query()
+	query.Set("code", code)
+	query.Set("state", params["state"])
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *Server) writeLoginPage(w http.ResponseWriter, status int, page any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err := loginPage.Execute(w, page)
+	if err != nil {
+		s.logger.Printf("Serving login page: %v", err)
+	}
+}
+
+// serveToken redeems an authorization code for the API token it was issued for.
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != loginClient {
+		s.writeTokenError(w, "invalid_request")
+		return
+	}
+
+	code, ok := s.redeemCode(r.PostForm.Get("code"))
+	if !ok || code.redirectURI != r.PostForm.Get("redirect_uri") || !verifyChallenge(r.PostForm.Get("code_verifier"), code.challenge) {
+		s.writeTokenError(w, "invalid_grant")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, map[string]string{
+		"access_token": code.token,
+		"token_type":   "bearer",
+	})
+}
+
+func (s *Server) writeTokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write([]byte(`{"error": "` + code + `"}`))
+}
+
+// issueCode stores code under a new random authorization code, dropping expired ones.
+func (s *Server) issueCode(code authCode) (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for existing, c := range s.codes {
+		if now.After(c.expires) {
+			delete(s.codes, existing)
+		}
+	}
+	s.codes[id] = code
+
+	return id, nil
+}
+
+// redeemCode returns the unexpired authorization code id and removes it.
+func (s *Server) redeemCode(id string) (authCode, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[id]
+	delete(s.codes, id)
+	if !ok || time.Now().After(code.expires) {
+		return authCode{}, false
+	}
+
+	return code, true
+}
+
+// verifyChallenge checks a PKCE code verifier against its S256 challenge.
+func verifyChallenge(verifier, challenge string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	want := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(want), []byte(challenge)) == 1
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,147 @@
+package packager
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServerLogin tests the login.v1 flow of "terraform login" against a Server.
+func TestServerLogin(t *testing.T) {
+	server := newTestServer(t, ServerConfig{Root: t.TempDir(), Tokens: TokenACL{"team-token": {"example-org"}}, Login: true})
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	client := ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	var wellKnownData WellKnown
+	resp, err := client.Get(ts.URL + "/.well-known/terraform.json")
+	if err != nil {
+		t.Fatalf("GET well-known error = %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&wellKnownData)
+	resp.Body.Close()
+	if err != nil || wellKnownData.LoginV1 == nil || wellKnownData.LoginV1.Client != "terraform-cli" {
+		t.Fatalf("well-known login.v1 = %+v, %v", wellKnownData.LoginV1, err)
+	}
+
+	verifier := "a-very-long-code-verifier-of-terraform-login"
+	sum := sha256.Sum256([]byte(verifier))
+	redirectURI := "http://localhost:10000/login"
+	params := url.Values{
+		"client_id":             {"terraform-cli"},
+		"response_type":         {"code"},
+		"redirect_uri":          {redirectURI},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authzURL := ts.URL + wellKnownData.LoginV1.Authz
+
+	resp, err = client.Get(authzURL + "?" + params.Encode())
+	if err != nil {
+		t.Fatalf("GET authorization page error = %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), `name="token"`) {
+		t.Fatalf("authorization page = %d %s", resp.StatusCode, page)
+	}
+
+	remote := url.Values{}
+	for name, values := range params {
+		remote[name] = values
+	}
+	remote.Set("redirect_uri", "http://attacker.example.com/login")
+	resp, err = client.Get(authzURL + "?" + remote.Encode())
+	if err != nil {
+		t.Fatalf("GET authorization page error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("authorization page with remote redirect_uri status = %d, want 400", resp.StatusCode)
+	}
+
+	params.Set("token", "guess")
+	resp, err = client.PostForm(authzURL, params)
+	if err != nil {
+		t.Fatalf("POST authorization page error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("POST unknown token status = %d, want 401", resp.StatusCode)
+	}
+
+	params.Set("token", "team-token")
+	resp, err = client.PostForm(authzURL, params)
+	if err != nil {
+		t.Fatalf("POST authorization page error = %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if resp.StatusCode != http.StatusFound || err != nil || !strings.HasPrefix(location.String(), redirectURI) || location.Query().Get("state") != "xyz" {
+		t.Fatalf("POST token redirect = %d %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	code := location.Query().Get("code")
+
+	exchange := func(verifier string) (*http.Response, map[string]string) {
+		t.Helper()
+		resp, err := client.PostForm(ts.URL+wellKnownData.LoginV1.Token, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"terraform-cli"},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"code_verifier": {verifier},
+		})
+		if err != nil {
+			t.Fatalf("POST token error = %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, body := exchange(verifier)
+	if resp.StatusCode != http.StatusOK || body["access_token"] != "team-token" {
+		t.Errorf("token exchange = %d %v, want team-token", resp.StatusCode, body)
+	}
+
+	resp, body = exchange(verifier)
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("second token exchange = %d %v, want invalid_grant", resp.StatusCode, body)
+	}
+}
+
+// TestServerLoginWrongVerifier tests that an authorization code needs the PKCE verifier.
+func TestServerLoginWrongVerifier(t *testing.T) {
+	server := newTestServer(t, ServerConfig{Root: t.TempDir(), Tokens: TokenACL{"team-token": {"example-org"}}, Login: true})
+
+	code, err := server.issueCode(authCode{token: "team-token", challenge: "challenge", redirectURI: "http://localhost:10000/login", expires: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("issueCode() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, loginTokenPath, strings.NewReader(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"terraform-cli"},
+		"code":          {code},
+		"redirect_uri":  {"http://localhost:10000/login"},
+		"code_verifier": {"wrong"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), "team-token") {
+		t.Errorf("token exchange = %d %s, want 400 without token", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,161 @@
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PackageNetworkMirror writes the Provider Network Mirror Protocol tree for the configured
+// provider version into Config.NetworkMirrorDir:
+//
+//	<domain>/<namespace>/<type>/index.json
+//	<domain>/<namespace>/<type>/<version>.json
+//	<domain>/<namespace>/<type>/<zip files>
+//
+// The zips are placed next to <version>.json so the archive URLs are relative and the tree
+// can be served from any base URL.
+func (p *Packager) PackageNetworkMirror(ctx context.Context) error {
+	if p.cfg.NetworkMirrorDir == "" {
+		return &ConfigError{Field: "NetworkMirrorDir", Reason: "is required"}
+	}
+
+	files, err := p.loadRelease(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = p.inspectBinaries(ctx, files)
+	if err != nil {
+		return fmt.Errorf("inspecting provider binaries: %w", err)
+	}
+
+	hashes, err := p.versionHashes(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	return p.packageNetworkMirror(ctx, files, hashes)
+}
+
+// packageNetworkMirror writes the network mirror tree of files with their lock file hashes,
+// Config.Jobs zips at a time.
+func (p *Packager) packageNetworkMirror(ctx context.Context, files []releaseFile, hashes VersionHashes) error {
+	p.logger.Printf("* Creating network mirror tree in %s directory", p.cfg.NetworkMirrorDir)
+
+	providerPath := filepath.Join(p.cfg.NetworkMirrorDir, p.cfg.Domain, p.cfg.Namespace, p.cfg.Provider)
+
+	index, err := p.mirrorIndex(ctx, providerPath)
+	if err != nil {
+		return err
+	}
+
+	err = p.createDirRecursive(providerPath)
+	if err != nil {
+		return err
+	}
+
+	version := MirrorVersion{Archives: map[string]MirrorArchive{}}
+	var mu sync.Mutex
+	err = p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		fileName := file.name
+
+		if !strings.HasSuffix(fileName, ".zip") {
+			p.skip(fileName, "not a zip file")
+			return nil
+		}
+		if !file.platformZip {
+			p.skip(fileName, "not in the expected format")
+			return nil
+		}
+		if len(file.platforms) == 0 {
+			return nil
+		}
+
+		zipSrcPath := filepath.Join(p.cfg.DistPath, fileName)
+		zipDestPath := filepath.Join(providerPath, fileName)
+		p.logger.Printf("  - Mirror zip: %s", zipDestPath)
+
+		err := p.placeZip(zipSrcPath, zipDestPath, file.sum)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, platform := range file.platforms {
+			platformHashes := hashes.Platforms[platform.Os+"_"+platform.Arch]
+			version.Archives[platform.Os+"_"+platform.Arch] = MirrorArchive{
+				URL:    fileName,
+				Hashes: []string{platformHashes.H1, platformHashes.ZH},
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	versionFile, err := json.MarshalIndent(version, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = p.writeFile(filepath.Join(providerPath, p.cfg.Version+".json"), versionFile)
+	if err != nil {
+		return err
+	}
+
+	index.Versions[p.cfg.Version] = struct{}{}
+	indexFile, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return p.writeFile(filepath.Join(providerPath, "index.json"), indexFile)
+}
+
+// mirrorIndex returns the union of the versions in the local index.json of providerPath and,
+// when Config.NetworkMirrorURL is set, of the published index.json.
+func (p *Packager) mirrorIndex(ctx context.Context, providerPath string) (MirrorIndex, error) {
+	index := MirrorIndex{Versions: map[string]struct{}{}}
+
+	var local MirrorIndex
+	_, err := readJSONFile(filepath.Join(providerPath, "index.json"), &local)
+	if err != nil {
+		return index, err
+	}
+	for v := range local.Versions {
+		index.Versions[v] = struct{}{}
+	}
+
+	if p.cfg.NetworkMirrorURL == "" {
+		return index, nil
+	}
+
+	p.logger.Println("* Downloading network mirror index")
+
+	var remote MirrorIndex
+	indexUrl := fmt.Sprintf("%s/%s/%s/%s/index.json", strings.TrimSuffix(p.cfg.NetworkMirrorURL, "/"), p.cfg.Domain, p.cfg.Namespace, p.cfg.Provider)
+	err = p.fetchJSON(ctx, indexUrl, &remote)
+	if errors.Is(err, ErrNotFound) {
+		if !p.allowNew {
+			return index, fmt.Errorf("provider %s/%s is not in the network mirror yet: %w", p.cfg.Namespace, p.cfg.Provider, err)
+		}
+		p.warnf("Network mirror index not found at %s, publishing first version", indexUrl)
+		return index, nil
+	}
+	if err != nil {
+		return index, fmt.Errorf("downloading network mirror index: %w", err)
+	}
+
+	for v := range remote.Versions {
+		index.Versions[v] = struct{}{}
+	}
+
+	return index, nil
+}
@@ -0,0 +1,220 @@
+package packager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestDist writes a dist directory with a zip per platform and the matching SHA256SUMS.
+func writeTestDist(t *testing.T, distPath string, platforms ...string) map[string]string {
+	t.Helper()
+
+	if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+
+	shasums := map[string]string{}
+	shaSumContent := ""
+	for _, platform := range platforms {
+		zipName := "terraform-provider-example_1.0.0_" + platform + ".zip"
+		shasums[platform] = writeTestZip(t, filepath.Join(distPath, zipName), map[string]string{
+			"terraform-provider-example_v1.0.0": testExecutable(t, platform),
+		})
+		shaSumContent += shasums[platform] + "  " + zipName + "\n"
+	}
+	shaSumContent += testShaSum + "  terraform-provider-example_1.0.0_manifest.json\n"
+
+	shaSumPath := filepath.Join(distPath, "terraform-provider-example_1.0.0_SHA256SUMS")
+	if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
+		t.Fatalf("Failed to create SHA256SUMS: %v", err)
+	}
+
+	return shasums
+}
+
+// TestPackageNetworkMirror tests the network mirror tree and the merge of existing indexes.
+func TestPackageNetworkMirror(t *testing.T) {
+	tmpDir := t.TempDir()
+	distPath := filepath.Join(tmpDir, "dist")
+	mirrorDir := filepath.Join(tmpDir, "mirror")
+	shasums := writeTestDist(t, distPath, "linux_amd64", "darwin_arm64")
+
+	cfg := testConfig(distPath)
+	cfg.NetworkMirrorDir = mirrorDir
+	providerPath := filepath.Join(mirrorDir, cfg.Domain, cfg.Namespace, cfg.Provider)
+
+	// A previous local run published 0.9.0, the remote mirror has 0.8.0.
+	if err := os.MkdirAll(providerPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup mirror: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(providerPath, "index.json"), []byte(`{"versions": {"0.9.0": {}}}`), 0644); err != nil {
+		t.Fatalf("Failed to setup mirror index: %v", err)
+	}
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/mirror/registry.example.com/example-org/example/index.json": {http.StatusOK, `{"versions": {"0.8.0": {}}}`},
+	})
+	cfg.NetworkMirrorURL = "https://" + domain + "/mirror/"
+
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+	if err := p.PackageNetworkMirror(context.Background()); err != nil {
+		t.Fatalf("PackageNetworkMirror() error = %v", err)
+	}
+
+	var index MirrorIndex
+	readJSON(t, filepath.Join(providerPath, "index.json"), &index)
+	for _, v := range []string{"0.8.0", "0.9.0", "1.0.0"} {
+		if _, ok := index.Versions[v]; !ok {
+			t.Errorf("index.json versions = %v, missing %s", index.Versions, v)
+		}
+	}
+
+	var version MirrorVersion
+	readJSON(t, filepath.Join(providerPath, "1.0.0.json"), &version)
+	if len(version.Archives) != 2 {
+		t.Fatalf("1.0.0.json archives = %v, want 2", version.Archives)
+	}
+	for platform, shasum := range shasums {
+		archive, ok := version.Archives[platform]
+		if !ok {
+			t.Errorf("1.0.0.json is missing %s", platform)
+			continue
+		}
+		zipName := "terraform-provider-example_1.0.0_" + platform + ".zip"
+		if archive.URL != zipName {
+			t.Errorf("%s url = %v, want %v", platform, archive.URL, zipName)
+		}
+		h1, err := packageHashV1(filepath.Join(distPath, zipName))
+		if err != nil {
+			t.Fatalf("packageHashV1() error = %v", err)
+		}
+		if len(archive.Hashes) != 2 || archive.Hashes[0] != h1 || archive.Hashes[1] != "zh:"+shasum {
+			t.Errorf("%s hashes = %v, want [%s zh:%s]", platform, archive.Hashes, h1, shasum)
+		}
+		if _, err := os.Stat(filepath.Join(providerPath, zipName)); err != nil {
+			t.Errorf("Mirror zip %s was not copied: %v", zipName, err)
+		}
+	}
+}
+
+// TestPackageNetworkMirrorRemoteIndex tests how a missing or failing remote mirror index is handled.
+func TestPackageNetworkMirrorRemoteIndex(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    map[string]testResponse
+		allowNew     bool
+		wantNotFound bool
+		wantErr      bool
+	}{
+		{
+			name:         "not found",
+			responses:    map[string]testResponse{},
+			wantNotFound: true,
+			wantErr:      true,
+		},
+		{
+			name:      "not found with allow new",
+			responses: map[string]testResponse{},
+			allowNew:  true,
+		},
+		{
+			name: "server error",
+			responses: map[string]testResponse{
+				"/registry.example.com/example-org/example/index.json": {http.StatusInternalServerError, ""},
+			},
+			allowNew: true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			writeTestDist(t, distPath, "linux_amd64")
+			domain, client := newTestRegistry(t, tt.responses)
+
+			cfg := testConfig(distPath)
+			cfg.NetworkMirrorDir = filepath.Join(tmpDir, "mirror")
+			cfg.NetworkMirrorURL = "https://" + domain
+			p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(tt.allowNew))
+
+			err := p.PackageNetworkMirror(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PackageNetworkMirror() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("PackageNetworkMirror() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+		})
+	}
+}
+
+// TestPackageMirrorsInspectBinaries tests that the mirror commands fail without writing the mirror
+// when a zip holds an executable for another platform.
+func TestPackageMirrorsInspectBinaries(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(p *Packager) error
+	}{
+		{
+			name: "network mirror",
+			run:  func(p *Packager) error { return p.PackageNetworkMirror(context.Background()) },
+		},
+		{
+			name: "packed filesystem mirror",
+			run:  func(p *Packager) error { return p.PackageFilesystemMirror(context.Background()) },
+		},
+		{
+			name: "unpacked filesystem mirror",
+			run: func(p *Packager) error {
+				p.cfg.FilesystemMirrorLayout = LayoutUnpacked
+				return p.PackageFilesystemMirror(context.Background())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			writeTestDist(t, distPath, "linux_amd64")
+			zipPath := filepath.Join(distPath, "terraform-provider-example_1.0.0_linux_amd64.zip")
+			shasum := writeTestZip(t, zipPath, map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "linux_arm64")})
+			shaSumContent := shasum + "  terraform-provider-example_1.0.0_linux_amd64.zip\n"
+			if err := os.WriteFile(filepath.Join(distPath, "terraform-provider-example_1.0.0_SHA256SUMS"), []byte(shaSumContent), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			cfg := testConfig(distPath)
+			cfg.NetworkMirrorDir = filepath.Join(tmpDir, "network-mirror")
+			cfg.FilesystemMirrorDir = filepath.Join(tmpDir, "fs-mirror")
+			p := newTestPackager(t, cfg)
+
+			err := tt.run(p)
+			var binaryErr *BinaryError
+			if !errors.As(err, &binaryErr) || binaryErr.Path != zipPath {
+				t.Fatalf("error = %v, want *BinaryError for %s", err, zipPath)
+			}
+			for _, dir := range []string{cfg.NetworkMirrorDir, cfg.FilesystemMirrorDir} {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("%s was written before failing", dir)
+				}
+			}
+		})
+	}
+}
+
+// TestPackageNetworkMirrorRequiresDir tests that PackageNetworkMirror needs an output directory.
+func TestPackageNetworkMirrorRequiresDir(t *testing.T) {
+	p := newTestPackager(t, testConfig("dist"))
+
+	err := p.PackageNetworkMirror(context.Background())
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || configErr.Field != "NetworkMirrorDir" {
+		t.Errorf("PackageNetworkMirror() error = %v, want *ConfigError for NetworkMirrorDir", err)
+	}
+}
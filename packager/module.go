@@ -0,0 +1,408 @@
+package packager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// moduleNamePattern matches the namespace, name and target system of a module address.
+var moduleNamePattern = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z_-]{0,62}[0-9A-Za-z])?$`)
+
+// moduleSkipDirs are not included in module archives, at any depth: version control and
+// Terraform working directories.
+var moduleSkipDirs = map[string]bool{".git": true, ".terraform": true}
+
+// moduleBuildDir is the GoReleaser build output, not included in module archives when it is at
+// the top of the module directory. Nested dist directories, e.g. built assets the module
+// references, are archived.
+const moduleBuildDir = "dist"
+
+// ModuleConfig describes the module version to package.
+type ModuleConfig struct {
+	// Namespace is the registry namespace the module is published under.
+	Namespace string
+	// Domain is the registry host name, without scheme.
+	Domain string
+	// Name is the module name, e.g. "vpc" for exampleorg/vpc/aws.
+	Name string
+	// System is the target system of the module, e.g. "aws".
+	System string
+	// Version is the semantic version of the module, without a leading "v". It defaults to
+	// GitRef without its leading "v".
+	Version string
+	// SourceDir is the module directory, or the git repository GitRef is read from.
+	SourceDir string
+	// GitRef is a git tag or commit to archive instead of the working tree of SourceDir.
+	GitRef string
+	// OutputDir is the directory the registry tree is written to. It must not be or contain the
+	// working directory or SourceDir, it may be inside SourceDir.
+	OutputDir string
+	// Incremental merges the version into an existing tree in OutputDir instead of recreating it.
+	Incremental bool
+	// Login is published as the login.v1 service of the well-known file, like Config.Login.
+	Login *LoginV1
+}
+
+// Validate reports the first missing or invalid field as a *ConfigError.
+func (c ModuleConfig) Validate() error {
+	required := []struct {
+		field string
+		value string
+	}{
+		{"Namespace", c.Namespace},
+		{"Domain", c.Domain},
+		{"Name", c.Name},
+		{"System", c.System},
+		{"Version", c.Version},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return &ConfigError{Field: r.field, Reason: "is required"}
+		}
+	}
+
+	names := []struct {
+		field string
+		value string
+	}{
+		{"Namespace", c.Namespace},
+		{"Name", c.Name},
+		{"System", c.System},
+	}
+	for _, n := range names {
+		if !moduleNamePattern.MatchString(n.value) {
+			return &ConfigError{Field: n.field, Reason: "must only contain letters, digits, dashes and underscores"}
+		}
+	}
+
+	if !semver.IsValid("v" + c.Version) {
+		return &ConfigError{Field: "Version", Reason: "must be a semantic version"}
+	}
+
+	// The archive leaves out an output directory inside the source directory, the default.
+	return validateOutputDir(c.OutputDir, outputDirInput{field: "SourceDir", dir: c.SourceDir, allowInside: true})
+}
+
+// ModulePackager packages a single module version into a static module registry tree.
+type ModulePackager struct {
+	cfg ModuleConfig
+	// registry fetches and writes the service discovery document like Packager does.
+	registry *Packager
+}
+
+// NewModule returns a ModulePackager for cfg. SourceDir defaults to the current directory,
+// OutputDir to "release" and Version to GitRef. Options are shared with New.
+func NewModule(cfg ModuleConfig, opts ...Option) (*ModulePackager, error) {
+	if cfg.SourceDir == "" {
+		cfg.SourceDir = "."
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "release"
+	}
+	if cfg.Version == "" && cfg.GitRef != "" {
+		cfg.Version = strings.TrimPrefix(cfg.GitRef, "v")
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	registry := &Packager{
+		cfg: Config{
+			Domain:      cfg.Domain,
+			OutputDir:   cfg.OutputDir,
+			Incremental: cfg.Incremental,
+			Login:       cfg.Login,
+		},
+		httpClient: &http.Client{},
+		logger:     log.Default(),
+	}
+	for _, opt := range opts {
+		opt(registry)
+	}
+
+	return &ModulePackager{cfg: cfg, registry: registry}, nil
+}
+
+// Package recreates the output directory, or merges into it when ModuleConfig.Incremental is
+// set, and writes the module archive, its download document and the versions file merged with
+// the published versions.
+func (m *ModulePackager) Package(ctx context.Context) error {
+	archive, err := m.archive(ctx)
+	if err != nil {
+		return fmt.Errorf("archiving module: %w", err)
+	}
+
+	if !m.cfg.Incremental {
+		err = deleteDir(m.cfg.OutputDir)
+		if err != nil {
+			return fmt.Errorf("deleting '%s' dir: %w", m.cfg.OutputDir, err)
+		}
+	}
+
+	err = createDirRecursive(m.cfg.OutputDir)
+	if err != nil {
+		return fmt.Errorf("creating '%s' dir: %w", m.cfg.OutputDir, err)
+	}
+
+	wellKnownData, err := m.registry.wellKnown(ctx, "modules.v1")
+	if err != nil {
+		return err
+	}
+
+	modulePath := filepath.Join(m.cfg.OutputDir, wellKnownData.ModulesV1, m.cfg.Namespace, m.cfg.Name, m.cfg.System)
+	versionPath := filepath.Join(modulePath, m.cfg.Version)
+
+	err = m.createVersionsFile(ctx, wellKnownData, modulePath)
+	if err != nil {
+		return fmt.Errorf("creating versions file: %w", err)
+	}
+
+	err = createDirRecursive(versionPath)
+	if err != nil {
+		return err
+	}
+
+	archiveName := fmt.Sprintf("%s-%s-%s.tar.gz", m.cfg.Name, m.cfg.System, m.cfg.Version)
+	m.registry.logger.Printf("* Writing module archive %s", filepath.Join(versionPath, archiveName))
+
+	err = writeFile(filepath.Join(versionPath, archiveName), archive)
+	if err != nil {
+		return err
+	}
+
+	download := ModuleDownload{
+		Location: fmt.Sprintf("https://%s%s%s/%s/%s/%s/%s", m.cfg.Domain, wellKnownData.ModulesV1, m.cfg.Namespace, m.cfg.Name, m.cfg.System, m.cfg.Version, archiveName),
+	}
+	downloadFile, err := json.MarshalIndent(download, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(versionPath, "download"), downloadFile)
+}
+
+// createVersionsFile merges the version into the published versions of the module, read from the
+// output directory in incremental mode when present, and writes the versions file.
+func (m *ModulePackager) createVersionsFile(ctx context.Context, wellKnownData WellKnown, modulePath string) error {
+	versionsPath := filepath.Join(modulePath, "versions")
+
+	var published ModuleVersions
+	found := false
+	if m.cfg.Incremental {
+		var err error
+		found, err = readJSONFile(versionsPath, &published)
+		if err != nil {
+			return fmt.Errorf("reading local versions file: %w", err)
+		}
+		if found {
+			m.registry.logger.Printf("* Merging into local versions file %s", versionsPath)
+		}
+	}
+
+	if !found {
+		m.registry.logger.Println("* Downloading module versions file")
+
+		versionsUrl := fmt.Sprintf("https://%s%s%s/%s/%s/versions", m.cfg.Domain, wellKnownData.ModulesV1, m.cfg.Namespace, m.cfg.Name, m.cfg.System)
+		err := m.registry.fetchJSON(ctx, versionsUrl, &published)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			if !m.registry.allowNew {
+				return fmt.Errorf("module %s/%s/%s is not published yet: %w", m.cfg.Namespace, m.cfg.Name, m.cfg.System, err)
+			}
+			m.registry.warnf("Versions file not found at %s, publishing first version", versionsUrl)
+		case err != nil:
+			return fmt.Errorf("downloading versions file: %w", err)
+		}
+	}
+
+	// A version that is published again keeps its place, so that an unchanged versions file is
+	// not rewritten.
+	var versions ModuleVersionList
+	seen := map[string]bool{}
+	for _, list := range published.Modules {
+		for _, v := range list.Versions {
+			if !seen[v.Version] {
+				seen[v.Version] = true
+				versions.Versions = append(versions.Versions, v)
+			}
+		}
+	}
+	if !seen[m.cfg.Version] {
+		versions.Versions = append(versions.Versions, ModuleVersion{Version: m.cfg.Version})
+	}
+
+	versionsFile, err := json.MarshalIndent(ModuleVersions{Modules: []ModuleVersionList{versions}}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = createDirRecursive(modulePath)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(versionsPath, versionsFile)
+}
+
+// archive returns the module as a gzipped tarball, from git when GitRef is set and from the
+// SourceDir directory otherwise.
+func (m *ModulePackager) archive(ctx context.Context) ([]byte, error) {
+	var tarball bytes.Buffer
+	var err error
+	if m.cfg.GitRef != "" {
+		m.registry.logger.Printf("* Archiving %s at %s", m.cfg.SourceDir, m.cfg.GitRef)
+		err = gitArchive(ctx, m.cfg.SourceDir, m.cfg.GitRef, &tarball)
+	} else {
+		m.registry.logger.Printf("* Archiving %s", m.cfg.SourceDir)
+		// The output directory defaults to release/ in the module directory, archiving it would
+		// embed the archives of the previous versions in every new one.
+		err = tarDir(ctx, m.cfg.SourceDir, &tarball, m.cfg.OutputDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	_, err = io.Copy(gz, &tarball)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return archive.Bytes(), nil
+}
+
+// gitArchive writes the tree of ref in the git repository dir to w as a tarball.
+func gitArchive(ctx context.Context, dir, ref string, w io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "archive", "--format=tar", ref)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("git archive %s: %w: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// tarDir writes the files of dir to w as a tarball, without moduleSkipDirs, moduleBuildDir and
+// the skipPaths directories. Headers are normalized so that the same tree always gives the same archive.
+func tarDir(ctx context.Context, dir string, w io.Writer, skipPaths ...string) error {
+	skip := map[string]bool{}
+	for _, skipPath := range skipPaths {
+		absPath, err := filepath.Abs(skipPath)
+		if err != nil {
+			return err
+		}
+		skip[absPath] = true
+	}
+
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && (moduleSkipDirs[d.Name()] || rel == moduleBuildDir) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && len(skip) > 0 {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if skip[absPath] {
+				return filepath.SkipDir
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.ModTime = time.Unix(0, 0)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+		header.Format = tar.FormatPAX
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,503 @@
+package packager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testModuleConfig returns a valid ModuleConfig for the module in sourceDir.
+func testModuleConfig(sourceDir, outputDir string) ModuleConfig {
+	return ModuleConfig{
+		Namespace: "example-org",
+		Domain:    "registry.example.com",
+		Name:      "network",
+		System:    "aws",
+		Version:   "1.0.0",
+		SourceDir: sourceDir,
+		OutputDir: outputDir,
+	}
+}
+
+// writeTestModule writes a small module to dir, along with a .git directory that must not be archived.
+func writeTestModule(t *testing.T, dir string) {
+	t.Helper()
+
+	files := map[string]string{
+		"main.tf":              "resource \"null_resource\" \"this\" {}\n",
+		"modules/sub/main.tf":  "variable \"name\" {}\n",
+		".git/HEAD":            "ref: refs/heads/main\n",
+		".terraform/lock.json": "{}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to setup module dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to setup module file: %v", err)
+		}
+	}
+}
+
+// readTestArchive returns the entry names of the gzipped tarball at path.
+func readTestArchive(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		// git archive records the commit in a global header, which is not a file.
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		names = append(names, header.Name)
+	}
+
+	return names
+}
+
+// TestNewModule tests the defaults and validation of NewModule.
+func TestNewModule(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         func(ModuleConfig) ModuleConfig
+		wantVersion string
+		wantField   string
+	}{
+		{
+			name:        "valid config",
+			cfg:         func(c ModuleConfig) ModuleConfig { return c },
+			wantVersion: "1.0.0",
+		},
+		{
+			name: "version from git tag",
+			cfg: func(c ModuleConfig) ModuleConfig {
+				c.Version = ""
+				c.GitRef = "v2.1.0"
+				return c
+			},
+			wantVersion: "2.1.0",
+		},
+		{
+			name: "missing version",
+			cfg: func(c ModuleConfig) ModuleConfig {
+				c.Version = ""
+				return c
+			},
+			wantField: "Version",
+		},
+		{
+			name: "invalid version",
+			cfg: func(c ModuleConfig) ModuleConfig {
+				c.Version = "latest"
+				return c
+			},
+			wantField: "Version",
+		},
+		{
+			name: "missing domain",
+			cfg: func(c ModuleConfig) ModuleConfig {
+				c.Domain = ""
+				return c
+			},
+			wantField: "Domain",
+		},
+		{
+			name: "invalid name",
+			cfg: func(c ModuleConfig) ModuleConfig {
+				c.Name = "net/work"
+				return c
+			},
+			wantField: "Name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewModule(tt.cfg(testModuleConfig("", "")))
+
+			var cfgErr *ConfigError
+			if tt.wantField != "" {
+				if !errors.As(err, &cfgErr) || cfgErr.Field != tt.wantField {
+					t.Fatalf("NewModule() error = %v, want ConfigError for %s", err, tt.wantField)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewModule() error = %v", err)
+			}
+			if m.cfg.Version != tt.wantVersion {
+				t.Errorf("Version = %q, want %q", m.cfg.Version, tt.wantVersion)
+			}
+			if m.cfg.SourceDir != "." || m.cfg.OutputDir != "release" {
+				t.Errorf("SourceDir, OutputDir = %q, %q, want defaults", m.cfg.SourceDir, m.cfg.OutputDir)
+			}
+		})
+	}
+}
+
+// TestModuleValidateOutputDir tests that Validate rejects output directories whose deletion would
+// delete the working directory or the module, and accepts them inside the module.
+func TestModuleValidateOutputDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	tests := []struct {
+		name      string
+		sourceDir string
+		outputDir string
+		wantErr   string
+	}{
+		{name: "inside working directory", sourceDir: ".", outputDir: "release"},
+		{name: "inside source directory", sourceDir: "modules/network", outputDir: "modules/network/release"},
+		{name: "empty", sourceDir: ".", outputDir: "", wantErr: "is required"},
+		{name: "working directory", sourceDir: "modules/network", outputDir: ".", wantErr: "working directory"},
+		{name: "absolute working directory", sourceDir: "modules/network", outputDir: tmpDir, wantErr: "working directory"},
+		{name: "source directory", sourceDir: "modules/network", outputDir: "modules/network", wantErr: `must not be or contain the SourceDir directory "modules/network"`},
+		{name: "containing source directory", sourceDir: "modules/network", outputDir: "modules", wantErr: `must not be or contain the SourceDir directory "modules/network"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testModuleConfig(tt.sourceDir, tt.outputDir).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) || cfgErr.Field != "OutputDir" || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want OutputDir ConfigError containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestTarDir tests that module archives skip tool directories and do not depend on file metadata.
+func TestTarDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	writeTestModule(t, first)
+	writeTestModule(t, second)
+
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(second, "main.tf"), old, old); err != nil {
+		t.Fatalf("Failed to setup file times: %v", err)
+	}
+
+	var firstTar, secondTar bytes.Buffer
+	if err := tarDir(context.Background(), first, &firstTar); err != nil {
+		t.Fatalf("tarDir() error = %v", err)
+	}
+	if err := tarDir(context.Background(), second, &secondTar); err != nil {
+		t.Fatalf("tarDir() error = %v", err)
+	}
+	if !bytes.Equal(firstTar.Bytes(), secondTar.Bytes()) {
+		t.Error("tarDir() archives of the same tree differ")
+	}
+
+	var names []string
+	tr := tar.NewReader(&firstTar)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+
+	want := []string{"main.tf", "modules/", "modules/sub/", "modules/sub/main.tf"}
+	if !slices.Equal(names, want) {
+		t.Errorf("archive entries = %v, want %v", names, want)
+	}
+}
+
+// TestModulePackage tests that Package writes the archive, the download document and the versions
+// file merged with the published versions.
+func TestModulePackage(t *testing.T) {
+	wellKnown := testResponse{http.StatusOK, `{"providers.v1": "/v1/providers/", "modules.v1": "/modules/"}`}
+
+	tests := []struct {
+		name         string
+		responses    map[string]testResponse
+		allowNew     bool
+		wantVersions []string
+		wantNotFound bool
+		wantErr      bool
+	}{
+		{
+			name: "existing module",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json":               wellKnown,
+				"/modules/example-org/network/aws/versions": {http.StatusOK, `{"modules": [{"versions": [{"version": "0.9.0"}, {"version": "1.0.0"}]}]}`},
+			},
+			wantVersions: []string{"0.9.0", "1.0.0"},
+		},
+		{
+			name: "new module",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": wellKnown,
+			},
+			allowNew:     true,
+			wantVersions: []string{"1.0.0"},
+		},
+		{
+			name: "new module not allowed",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": wellKnown,
+			},
+			wantNotFound: true,
+			wantErr:      true,
+		},
+		{
+			name: "registry without modules",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+			},
+			allowNew: true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			sourceDir := filepath.Join(tmpDir, "module")
+			outputDir := filepath.Join(tmpDir, "release")
+			writeTestModule(t, sourceDir)
+			domain, client := newTestRegistry(t, tt.responses)
+
+			cfg := testModuleConfig(sourceDir, outputDir)
+			cfg.Domain = domain
+			m, err := NewModule(cfg, WithHTTPClient(client), WithAllowNew(tt.allowNew))
+			if err != nil {
+				t.Fatalf("NewModule() error = %v", err)
+			}
+
+			err = m.Package(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Package() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("Package() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+			if err != nil {
+				return
+			}
+
+			modulePath := filepath.Join(outputDir, "modules", "example-org", "network", "aws")
+
+			var versions ModuleVersions
+			if ok, err := readJSONFile(filepath.Join(modulePath, "versions"), &versions); !ok || err != nil {
+				t.Fatalf("Failed to read versions file: %v", err)
+			}
+			var got []string
+			for _, list := range versions.Modules {
+				for _, v := range list.Versions {
+					got = append(got, v.Version)
+				}
+			}
+			if !slices.Equal(got, tt.wantVersions) {
+				t.Errorf("versions = %v, want %v", got, tt.wantVersions)
+			}
+
+			var download ModuleDownload
+			if ok, err := readJSONFile(filepath.Join(modulePath, "1.0.0", "download"), &download); !ok || err != nil {
+				t.Fatalf("Failed to read download file: %v", err)
+			}
+			wantLocation := "https://" + domain + "/modules/example-org/network/aws/1.0.0/network-aws-1.0.0.tar.gz"
+			if download.Location != wantLocation {
+				t.Errorf("location = %q, want %q", download.Location, wantLocation)
+			}
+
+			names := readTestArchive(t, filepath.Join(modulePath, "1.0.0", "network-aws-1.0.0.tar.gz"))
+			if !slices.Contains(names, "main.tf") {
+				t.Errorf("archive entries = %v, want main.tf", names)
+			}
+		})
+	}
+}
+
+// TestModulePackageOutputInSource tests that the output directory and the top-level build output
+// inside the module directory are not archived, so that every run gives the same archive, while
+// nested dist directories are.
+func TestModulePackageOutputInSource(t *testing.T) {
+	sourceDir := t.TempDir()
+	writeTestModule(t, sourceDir)
+	writeTestTree(t, sourceDir, map[string]string{
+		"dist/provider.zip":          "zip content",
+		"modules/sub/dist/lambda.js": "exports.handler = () => {}\n",
+	})
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/", "modules.v1": "/modules/"}`},
+	})
+
+	cfg := testModuleConfig(sourceDir, filepath.Join(sourceDir, "release"))
+	cfg.Domain = domain
+	cfg.Incremental = true
+	m, err := NewModule(cfg, WithHTTPClient(client), WithAllowNew(true))
+	if err != nil {
+		t.Fatalf("NewModule() error = %v", err)
+	}
+
+	archivePath := filepath.Join(cfg.OutputDir, "modules", "example-org", "network", "aws", "1.0.0", "network-aws-1.0.0.tar.gz")
+	var archives [][]byte
+	for range 2 {
+		if err := m.Package(context.Background()); err != nil {
+			t.Fatalf("Package() error = %v", err)
+		}
+		archive, err := os.ReadFile(archivePath)
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		archives = append(archives, archive)
+	}
+
+	// Only the top-level dist directory is GoReleaser build output.
+	want := []string{"main.tf", "modules/", "modules/sub/", "modules/sub/dist/", "modules/sub/dist/lambda.js", "modules/sub/main.tf"}
+	if names := readTestArchive(t, archivePath); !slices.Equal(names, want) {
+		t.Errorf("archive entries = %v, want %v", names, want)
+	}
+	if !bytes.Equal(archives[0], archives[1]) {
+		t.Error("Package() archive changed on the second run")
+	}
+}
+
+// TestModulePackageIncremental tests that versions are merged into the local versions file
+// without reaching the registry.
+func TestModulePackageIncremental(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "module")
+	outputDir := filepath.Join(tmpDir, "release")
+	writeTestModule(t, sourceDir)
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+
+	for _, version := range []string{"1.0.0", "1.1.0", "1.0.0"} {
+		cfg := testModuleConfig(sourceDir, outputDir)
+		cfg.Domain = domain
+		cfg.Version = version
+		cfg.Incremental = true
+		m, err := NewModule(cfg, WithHTTPClient(client), WithAllowNew(true))
+		if err != nil {
+			t.Fatalf("NewModule() error = %v", err)
+		}
+		if err := m.Package(context.Background()); err != nil {
+			t.Fatalf("Package() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "v1", "modules", "example-org", "network", "aws", "versions"))
+	if err != nil {
+		t.Fatalf("Failed to read versions file: %v", err)
+	}
+	var versions ModuleVersions
+	if err := json.Unmarshal(data, &versions); err != nil {
+		t.Fatalf("Failed to parse versions file: %v", err)
+	}
+	if len(versions.Modules) != 1 || len(versions.Modules[0].Versions) != 2 {
+		t.Fatalf("versions = %s, want 1.0.0 and 1.1.0", data)
+	}
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if _, err := os.Stat(filepath.Join(outputDir, "v1", "modules", "example-org", "network", "aws", version, "download")); err != nil {
+			t.Errorf("download file of %s: %v", version, err)
+		}
+	}
+}
+
+// TestModulePackageGitRef tests that a git tag is archived instead of the working tree.
+func TestModulePackageGitRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "module")
+	outputDir := filepath.Join(tmpDir, "release")
+	if err := os.MkdirAll(sourceDir, 0o755); err != nil {
+		t.Fatalf("Failed to setup module dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "main.tf"), []byte("# v1.2.0\n"), 0o644); err != nil {
+		t.Fatalf("Failed to setup module file: %v", err)
+	}
+
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", sourceDir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Failed to setup git repository: %v: %s", err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "main.tf")
+	git("commit", "-q", "-m", "init")
+	git("tag", "v1.2.0")
+
+	// Uncommitted files are not part of the tag.
+	if err := os.WriteFile(filepath.Join(sourceDir, "wip.tf"), []byte("# wip\n"), 0o644); err != nil {
+		t.Fatalf("Failed to setup module file: %v", err)
+	}
+
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+	cfg := testModuleConfig(sourceDir, outputDir)
+	cfg.Domain = domain
+	cfg.Version = ""
+	cfg.GitRef = "v1.2.0"
+	m, err := NewModule(cfg, WithHTTPClient(client), WithAllowNew(true))
+	if err != nil {
+		t.Fatalf("NewModule() error = %v", err)
+	}
+	if err := m.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	names := readTestArchive(t, filepath.Join(outputDir, "v1", "modules", "example-org", "network", "aws", "1.2.0", "network-aws-1.2.0.tar.gz"))
+	if !slices.Equal(names, []string{"main.tf"}) {
+		t.Errorf("archive entries = %v, want [main.tf]", names)
+	}
+
+	cfg.GitRef = "v9.9.9"
+	cfg.Version = ""
+	m, err = NewModule(cfg, WithHTTPClient(client), WithAllowNew(true))
+	if err != nil {
+		t.Fatalf("NewModule() error = %v", err)
+	}
+	if err := m.Package(context.Background()); err == nil {
+		t.Error("Package() of unknown tag error = nil, want error")
+	}
+}
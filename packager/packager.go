@@ -0,0 +1,412 @@
+// Package packager lays out GoReleaser builds of a Terraform provider as a static provider
+// registry tree that can be synced to any static file host.
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Packager packages a single provider version into the output directory.
+type Packager struct {
+	cfg        Config
+	allowNew   bool
+	httpClient *http.Client
+	logger     *log.Logger
+	// plan records the writes instead of performing them during a dry run.
+	plan *planner
+	// report collects the outcome of the packaging run.
+	report *reporter
+}
+
+// New returns a Packager for cfg. DistPath defaults to "dist", OutputDir to "release",
+// RepoName to "terraform-provider-<Provider>", FilesystemMirrorLayout to LayoutPacked, LinkMode
+// to LinkCopy, GPGPubKeyFile to "pubkey.txt", SigningKeys to the key in GPGPubKeyFile and the
+// PublicKeyFile of signing keys to GPGPubKeyFile.
+func New(cfg Config, opts ...Option) (*Packager, error) {
+	if cfg.RepoName == "" && cfg.Provider != "" {
+		cfg.RepoName = "terraform-provider-" + cfg.Provider
+	}
+	if cfg.DistPath == "" {
+		cfg.DistPath = "dist"
+	}
+	if cfg.OutputDir == "" {
+		cfg.OutputDir = "release"
+	}
+	if cfg.FilesystemMirrorLayout == "" {
+		cfg.FilesystemMirrorLayout = LayoutPacked
+	}
+	if cfg.LinkMode == "" {
+		cfg.LinkMode = LinkCopy
+	}
+	if cfg.GPGPubKeyFile == "" {
+		cfg.GPGPubKeyFile = "pubkey.txt"
+	}
+	if len(cfg.SigningKeys) == 0 {
+		cfg.SigningKeys = []SigningKey{{KeyID: cfg.GPGFingerprint}}
+	}
+	cfg.SigningKeys = slices.Clone(cfg.SigningKeys)
+	for i := range cfg.SigningKeys {
+		if cfg.SigningKeys[i].PublicKeyFile == "" {
+			cfg.SigningKeys[i].PublicKeyFile = cfg.GPGPubKeyFile
+		}
+	}
+
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Packager{
+		cfg:        cfg,
+		httpClient: &http.Client{},
+		logger:     log.Default(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+// Package recreates the output directory, or merges into it when Config.Incremental is set, and
+// writes the versions file, SHA files, zips and
+// platform documents for the configured provider version. Every zip must contain the provider
+// executable built for the platform of its file name, and every required platform must be
+// published. The network and filesystem mirror
+// trees are written as well when their directories are configured. The SHA256SUMS file is
+// generated when missing and signed when GPGPrivateKeyFile is set, and nothing else is written
+// unless its signature verifies against one of the signing keys.
+func (p *Packager) Package(ctx context.Context) error {
+	_, err := p.PackageReport(ctx)
+	return err
+}
+
+// PackageReport runs Package and returns the report of the published version. The report is
+// partial when packaging fails.
+func (p *Packager) PackageReport(ctx context.Context) (Report, error) {
+	run := *p
+	run.report = newReporter(p.cfg)
+
+	err := run.packageRelease(ctx)
+
+	return run.report.result(), err
+}
+
+func (p *Packager) packageRelease(ctx context.Context) error {
+	files, err := p.loadRelease(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = p.inspectBinaries(ctx, files)
+	if err != nil {
+		return fmt.Errorf("inspecting provider binaries: %w", err)
+	}
+
+	if p.cfg.GPGPrivateKeyFile != "" {
+		err = p.signShaSums()
+		if err != nil {
+			return fmt.Errorf("signing SHA256SUMS: %w", err)
+		}
+	}
+
+	keys, err := p.verifySignature()
+	if err != nil {
+		return fmt.Errorf("verifying signature: %w", err)
+	}
+
+	protocols, err := p.resolveProtocols()
+	if err != nil {
+		return fmt.Errorf("resolving protocol versions: %w", err)
+	}
+	p.report.protocols(protocols)
+
+	if !p.cfg.Incremental {
+		err = p.deleteDir(p.cfg.OutputDir)
+		if err != nil {
+			return fmt.Errorf("deleting '%s' dir: %w", p.cfg.OutputDir, err)
+		}
+	}
+
+	err = p.createDirRecursive(p.cfg.OutputDir)
+	if err != nil {
+		return fmt.Errorf("creating '%s' dir: %w", p.cfg.OutputDir, err)
+	}
+
+	wellKnownData, err := p.createVersionsFile(ctx, files, protocols)
+	if err != nil {
+		return fmt.Errorf("creating versions file: %w", err)
+	}
+
+	versionPath, err := p.providerDirs(wellKnownData)
+	if err != nil {
+		return fmt.Errorf("creating provider dirs: %w", err)
+	}
+
+	err = p.copyShaFiles(versionPath)
+	if err != nil {
+		return fmt.Errorf("copying SHA files: %w", err)
+	}
+
+	downloadPath, err := p.createDownloadsDir(versionPath)
+	if err != nil {
+		return fmt.Errorf("creating download dir: %w", err)
+	}
+
+	err = p.copyBuildZips(ctx, files, downloadPath)
+	if err != nil {
+		return fmt.Errorf("copying build zips: %w", err)
+	}
+
+	hashes, err := p.versionHashes(ctx, files)
+	if err != nil {
+		return fmt.Errorf("hashing build zips: %w", err)
+	}
+
+	err = p.writeHashesFile(versionPath, hashes)
+	if err != nil {
+		return fmt.Errorf("writing hashes file: %w", err)
+	}
+
+	err = p.createArchitectureFiles(ctx, files, wellKnownData, protocols, keys)
+	if err != nil {
+		return fmt.Errorf("creating architecture files: %w", err)
+	}
+
+	if p.cfg.NetworkMirrorDir != "" {
+		err = p.packageNetworkMirror(ctx, files, hashes)
+		if err != nil {
+			return fmt.Errorf("creating network mirror: %w", err)
+		}
+	}
+
+	if p.cfg.FilesystemMirrorDir != "" {
+		err = p.packageFilesystemMirror(ctx, files)
+		if err != nil {
+			return fmt.Errorf("creating filesystem mirror: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Packager) providerDirs(wellKnownData WellKnown) (string, error) {
+	p.logger.Println("* Creating release/[well know providers]/[namespace]/[provider]/[version] directories")
+
+	versionPath := filepath.Join(p.cfg.OutputDir, wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider, p.cfg.Version)
+
+	err := p.createDirRecursive(versionPath)
+	if err != nil {
+		return "", err
+	}
+
+	return versionPath, nil
+}
+
+func (p *Packager) createVersionsFile(ctx context.Context, files []releaseFile, protocols []string) (WellKnown, error) {
+	registryVersionFile, wellKnownData, err := p.downloadVersionsFile(ctx)
+	if err != nil {
+		return wellKnownData, err
+	}
+
+	versionPath := filepath.Join(p.cfg.OutputDir, wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider, "versions")
+
+	var ver Version
+	ver.Version = p.cfg.Version
+	ver.Protocols = protocols
+	ver.Platforms = []Platform{}
+
+	var vers Versions
+	vers.Versions = []Version{}
+
+	for _, file := range files {
+		if !file.platformZip {
+			p.skip(file.name, "not in the expected format")
+			continue
+		}
+
+		ver.Platforms = append(ver.Platforms, file.platforms...)
+	}
+
+	// A version that is published again replaces its previous entry in place, so that an
+	// unchanged versions file is not rewritten.
+	replaced := false
+	for _, v := range registryVersionFile.Versions {
+		exists := false
+		for _, existingVersion := range vers.Versions {
+			if existingVersion.Version == v.Version {
+				exists = true
+				break
+			}
+		}
+		if exists {
+			continue
+		}
+		if v.Version == ver.Version {
+			v = ver
+			replaced = true
+		}
+		vers.Versions = append(vers.Versions, v)
+	}
+
+	if !replaced {
+		vers.Versions = append(vers.Versions, ver)
+	}
+
+	versionsFile, err := json.MarshalIndent(vers, "", "  ")
+	if err != nil {
+		return wellKnownData, err
+	}
+
+	err = p.createDirRecursive(filepath.Dir(versionPath))
+	if err != nil {
+		return wellKnownData, err
+	}
+
+	err = p.writeFile(versionPath, versionsFile)
+	if err != nil {
+		return wellKnownData, err
+	}
+
+	return wellKnownData, nil
+}
+
+func (p *Packager) copyShaFiles(destPath string) error {
+	p.logger.Printf("* Copying SHA files in %s directory", p.cfg.DistPath)
+
+	shaSum := p.cfg.RepoName + "_" + p.cfg.Version + "_SHA256SUMS"
+	shaSumPath := filepath.Join(p.cfg.DistPath, shaSum)
+
+	err := p.copyFile(shaSumPath, filepath.Join(destPath, shaSum))
+	if err != nil {
+		return err
+	}
+
+	return p.copyFile(shaSumPath+".sig", filepath.Join(destPath, shaSum+".sig"))
+}
+
+func (p *Packager) createDownloadsDir(destPath string) (string, error) {
+	p.logger.Printf("* Creating download/ in %s directory", destPath)
+
+	downloadPath := filepath.Join(destPath, "download")
+
+	err := p.createDir(downloadPath)
+	if err != nil {
+		return "", err
+	}
+
+	return downloadPath, nil
+}
+
+// copyBuildZips places the zips of files in destPath, Config.Jobs at a time. The zips are not
+// hashed again, loadRelease already verified them against SHA256SUMS.
+func (p *Packager) copyBuildZips(ctx context.Context, files []releaseFile, destPath string) error {
+	p.logger.Println("* Copying build zips")
+
+	return p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		if !strings.HasSuffix(file.name, ".zip") {
+			p.skip(file.name, "not a zip file")
+			return nil
+		}
+		if file.platformZip && len(file.platforms) == 0 {
+			p.skip(file.name, "filtered out by the platform filters")
+			return nil
+		}
+
+		zipSrcPath := filepath.Join(p.cfg.DistPath, file.name)
+		zipDestPath := filepath.Join(destPath, file.name)
+
+		p.logger.Printf("  - Zip: %s -> %s", zipSrcPath, zipDestPath)
+
+		err := p.placeZip(zipSrcPath, zipDestPath, file.sum)
+		if err != nil {
+			return err
+		}
+
+		for _, platform := range file.platforms {
+			p.logger.Printf("   - %s_%s: SHA256 %s verified", platform.Os, platform.Arch, file.sum)
+		}
+
+		return nil
+	})
+}
+
+// createArchitectureFiles writes the platform document of every published platform of files,
+// Config.Jobs files at a time.
+func (p *Packager) createArchitectureFiles(ctx context.Context, files []releaseFile, wellKnownData WellKnown, protocols []string, keys []GpgPublicKey) error {
+	p.logger.Println("* Creating architecture files in target directories")
+
+	prefix := fmt.Sprintf("%s%s/%s/%s/", wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider, p.cfg.Version)
+	urlPrefix := fmt.Sprintf("https://%s%s", p.cfg.Domain, prefix)
+
+	downloadUrlPrefix := urlPrefix + "download/"
+	downloadPathPrefix := filepath.Join(p.cfg.OutputDir, prefix, "download")
+
+	shasumsUrl := urlPrefix + fmt.Sprintf("%s_%s_SHA256SUMS", p.cfg.RepoName, p.cfg.Version)
+	shasumsSigUrl := shasumsUrl + ".sig"
+
+	keyIDs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyIDs = append(keyIDs, key.KeyId)
+	}
+
+	return p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		fileName := file.name
+		downloadUrl := downloadUrlPrefix + fileName
+
+		if !file.platformZip {
+			p.skip(fileName, "not in the expected format")
+			return nil
+		}
+
+		for _, platform := range file.platforms {
+			archFileName := filepath.Join(downloadPathPrefix, platform.Os, platform.Arch)
+
+			var architecture Architecture
+			architecture.Protocols = protocols
+			architecture.Os = platform.Os
+			architecture.Arch = platform.Arch
+			architecture.Filename = fileName
+			architecture.DownloadUrl = downloadUrl
+			architecture.ShasumsUrl = shasumsUrl
+			architecture.ShasumsSignatureUrl = shasumsSigUrl
+			architecture.Shasum = file.sum
+			architecture.SigningKeys.GpgPublicKeys = keys
+			architectureTemplate, err := json.MarshalIndent(architecture, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			p.logger.Printf("  - Arch file: %s", archFileName)
+
+			err = p.createDirRecursive(filepath.Dir(archFileName))
+			if err != nil {
+				return err
+			}
+			err = p.writeFile(archFileName, architectureTemplate)
+			if err != nil {
+				return err
+			}
+
+			p.report.platform(PlatformReport{
+				Os:                  platform.Os,
+				Arch:                platform.Arch,
+				Filename:            fileName,
+				Shasum:              file.sum,
+				DownloadUrl:         downloadUrl,
+				ShasumsUrl:          shasumsUrl,
+				ShasumsSignatureUrl: shasumsSigUrl,
+				SigningKeyIDs:       keyIDs,
+			})
+		}
+
+		return nil
+	})
+}
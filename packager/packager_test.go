@@ -0,0 +1,857 @@
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testShaSum is a well-formed SHA256 for the SHA256SUMS fixtures whose zips are not hashed.
+const testShaSum = "abc1230000000000000000000000000000000000000000000000000000000000"
+
+// testConfig returns a valid Config for the example provider built into distPath.
+func testConfig(distPath string) Config {
+	return Config{
+		Namespace:      "example-org",
+		Domain:         "registry.example.com",
+		Provider:       "example",
+		DistPath:       distPath,
+		RepoName:       "terraform-provider-example",
+		Version:        "1.0.0",
+		GPGFingerprint: "1234567890ABCDEF",
+	}
+}
+
+// newTestPackager returns a Packager for cfg and fails the test on configuration errors.
+func newTestPackager(t testing.TB, cfg Config, opts ...Option) *Packager {
+	t.Helper()
+
+	p, err := New(cfg, opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	return p
+}
+
+// testReleaseFiles returns the files listed in the SHA256SUMS of the dist directory of p.
+func testReleaseFiles(t *testing.T, p *Packager) []releaseFile {
+	t.Helper()
+
+	files, err := p.releaseFiles()
+	if err != nil {
+		t.Fatalf("Failed to read SHA256SUMS: %v", err)
+	}
+
+	return files
+}
+
+// TestNew tests the New function.
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       func(Config) Config
+		wantField string
+	}{
+		{
+			name: "valid config",
+			cfg:  func(c Config) Config { c.RepoName = ""; return c },
+		},
+		{
+			name:      "missing namespace",
+			cfg:       func(c Config) Config { c.Namespace = ""; return c },
+			wantField: "Namespace",
+		},
+		{
+			name:      "missing domain",
+			cfg:       func(c Config) Config { c.Domain = ""; return c },
+			wantField: "Domain",
+		},
+		{
+			name:      "missing provider",
+			cfg:       func(c Config) Config { c.Provider = ""; c.RepoName = ""; return c },
+			wantField: "Provider",
+		},
+		{
+			name:      "missing version",
+			cfg:       func(c Config) Config { c.Version = ""; return c },
+			wantField: "Version",
+		},
+		{
+			name:      "invalid filesystem mirror layout",
+			cfg:       func(c Config) Config { c.FilesystemMirrorLayout = "flat"; return c },
+			wantField: "FilesystemMirrorLayout",
+		},
+		{
+			name:      "invalid protocols",
+			cfg:       func(c Config) Config { c.Protocols = []string{"6"}; return c },
+			wantField: "Protocols",
+		},
+		{
+			name:      "invalid platform pattern",
+			cfg:       func(c Config) Config { c.Platforms = []string{"linux"}; return c },
+			wantField: "Platforms",
+		},
+		{
+			name:      "invalid link mode",
+			cfg:       func(c Config) Config { c.LinkMode = "move"; return c },
+			wantField: "LinkMode",
+		},
+		{
+			name:      "negative jobs",
+			cfg:       func(c Config) Config { c.Jobs = -1; return c },
+			wantField: "Jobs",
+		},
+		{
+			name:      "required platform pattern",
+			cfg:       func(c Config) Config { c.RequiredPlatforms = []string{"linux_*"}; return c },
+			wantField: "RequiredPlatforms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.cfg(testConfig("")))
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+				if p.cfg.RepoName != "terraform-provider-example" || p.cfg.DistPath != "dist" || p.cfg.OutputDir != "release" || p.cfg.GPGPubKeyFile != "pubkey.txt" {
+					t.Errorf("New() defaults = %q, %q, %q, %q, want terraform-provider-example, dist, release, pubkey.txt", p.cfg.RepoName, p.cfg.DistPath, p.cfg.OutputDir, p.cfg.GPGPubKeyFile)
+				}
+				if want := []SigningKey{{KeyID: "1234567890ABCDEF", PublicKeyFile: "pubkey.txt"}}; !slices.Equal(p.cfg.SigningKeys, want) {
+					t.Errorf("New() SigningKeys = %+v, want %+v", p.cfg.SigningKeys, want)
+				}
+				return
+			}
+
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("New() error = %v, want *ConfigError", err)
+			}
+			if configErr.Field != tt.wantField {
+				t.Errorf("New() error field = %v, want %v", configErr.Field, tt.wantField)
+			}
+		})
+	}
+}
+
+// TestValidateOutputDir tests that Validate rejects output directories whose deletion would
+// delete the working directory or the dist directory.
+func TestValidateOutputDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	tests := []struct {
+		name      string
+		outputDir string
+		distPath  string
+		wantErr   string
+	}{
+		{name: "output directory", outputDir: "release", distPath: "dist"},
+		{name: "absolute output directory", outputDir: filepath.Join(tmpDir, "release"), distPath: "dist"},
+		{name: "empty", outputDir: "", distPath: "dist", wantErr: "is required"},
+		{name: "working directory", outputDir: ".", distPath: "dist", wantErr: "working directory"},
+		{name: "absolute working directory", outputDir: tmpDir, distPath: "dist", wantErr: "working directory"},
+		{name: "parent directory", outputDir: "..", distPath: "dist", wantErr: "working directory"},
+		{name: "dist directory", outputDir: "dist", distPath: "dist", wantErr: `must not be or contain the DistPath directory "dist"`},
+		{name: "containing dist directory", outputDir: "build", distPath: "build/dist", wantErr: `must not be or contain the DistPath directory "build/dist"`},
+		{name: "inside dist directory", outputDir: "dist/release", distPath: "dist", wantErr: `must not be inside the DistPath directory "dist"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(tt.distPath)
+			cfg.OutputDir = tt.outputDir
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) || configErr.Field != "OutputDir" || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want OutputDir ConfigError containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestNewSigningKeys tests that signing keys default to the GPGPubKeyFile public key.
+func TestNewSigningKeys(t *testing.T) {
+	cfg := testConfig("")
+	cfg.GPGPubKeyFile = "current.asc"
+	cfg.SigningKeys = []SigningKey{
+		{Source: "Example Org"},
+		{PublicKeyFile: "next.asc"},
+	}
+	p := newTestPackager(t, cfg)
+
+	want := []SigningKey{
+		{PublicKeyFile: "current.asc", Source: "Example Org"},
+		{PublicKeyFile: "next.asc"},
+	}
+	if !slices.Equal(p.cfg.SigningKeys, want) {
+		t.Errorf("New() SigningKeys = %+v, want %+v", p.cfg.SigningKeys, want)
+	}
+	if cfg.SigningKeys[0].PublicKeyFile != "" {
+		t.Error("New() modified the caller's SigningKeys")
+	}
+}
+
+// TestCreateDownloadsDir tests the createDownloadsDir method.
+func TestCreateDownloadsDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{
+			name:    "create downloads directory",
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			basePath := filepath.Join(tmpDir, "base")
+			p := newTestPackager(t, testConfig(tmpDir))
+
+			// Create base directory first
+			if err := os.MkdirAll(basePath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup test: %v", err)
+			}
+
+			downloadPath, err := p.createDownloadsDir(basePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createDownloadsDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				// Verify download directory was created
+				expectedPath := filepath.Join(basePath, "download")
+				if downloadPath != expectedPath {
+					t.Errorf("createDownloadsDir() path = %v, want %v", downloadPath, expectedPath)
+				}
+				if _, err := os.Stat(downloadPath); os.IsNotExist(err) {
+					t.Errorf("Download directory was not created: %v", downloadPath)
+				}
+			}
+		})
+	}
+}
+
+// TestCopyShaFiles tests the copyShaFiles method.
+func TestCopyShaFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		createSig bool
+		wantErr   bool
+	}{
+		{
+			name:      "copy SHA files with signature",
+			createSig: true,
+			wantErr:   false,
+		},
+		{
+			name:      "missing signature",
+			createSig: false,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			srcPath := filepath.Join(tmpDir, "src")
+			destPath := filepath.Join(tmpDir, "dest")
+			cfg := testConfig(srcPath)
+			p := newTestPackager(t, cfg)
+
+			// Setup source and destination directories
+			if err := os.MkdirAll(srcPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup src: %v", err)
+			}
+			if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup dest: %v", err)
+			}
+
+			// Create SHA256SUMS file
+			shaSum := cfg.RepoName + "_" + cfg.Version + "_SHA256SUMS"
+			shaSumPath := filepath.Join(srcPath, shaSum)
+			if err := os.WriteFile(shaSumPath, []byte("test content"), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			// Create signature file
+			if tt.createSig {
+				sigPath := shaSumPath + ".sig"
+				if err := os.WriteFile(sigPath, []byte("signature"), 0644); err != nil {
+					t.Fatalf("Failed to create signature: %v", err)
+				}
+			}
+
+			err := p.copyShaFiles(destPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("copyShaFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				// Verify files were copied
+				destShaPath := filepath.Join(destPath, shaSum)
+				if _, err := os.Stat(destShaPath); os.IsNotExist(err) {
+					t.Error("SHA256SUMS file was not copied")
+				}
+
+				destSigPath := destShaPath + ".sig"
+				if _, err := os.Stat(destSigPath); os.IsNotExist(err) {
+					t.Error("Signature file was not copied")
+				}
+			}
+		})
+	}
+}
+
+// TestCopyBuildZips tests the copyBuildZips method.
+func TestCopyBuildZips(t *testing.T) {
+	tests := []struct {
+		name     string
+		zipFiles []string
+		wantErr  bool
+	}{
+		{
+			name: "copy valid zip files",
+			zipFiles: []string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip",
+				"terraform-provider-example_1.0.0_darwin_amd64.zip",
+			},
+			wantErr: false,
+		},
+		{
+			name: "skip non-zip files",
+			zipFiles: []string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip",
+				"terraform-provider-example_1.0.0_linux_amd64.txt",
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			destPath := filepath.Join(tmpDir, "dest")
+			cfg := testConfig(distPath)
+			p := newTestPackager(t, cfg)
+
+			// Setup directories
+			if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup dist: %v", err)
+			}
+			if err := os.MkdirAll(destPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup dest: %v", err)
+			}
+
+			// Create SHA256SUMS file
+			shaSumContent := ""
+			for _, zipFile := range tt.zipFiles {
+				shasum := testShaSum
+				// Create zip files
+				zipPath := filepath.Join(distPath, zipFile)
+				if filepath.Ext(zipFile) == ".zip" {
+					shasum = writeTestZip(t, zipPath, map[string]string{"terraform-provider-example_v1.0.0": zipFile})
+				} else if err := os.WriteFile(zipPath, []byte("zip content"), 0644); err != nil {
+					t.Fatalf("Failed to create zip file: %v", err)
+				}
+				shaSumContent += shasum + "  " + zipFile + "\n"
+			}
+			shaSumPath := filepath.Join(distPath, cfg.RepoName+"_"+cfg.Version+"_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			err := p.copyBuildZips(context.Background(), testReleaseFiles(t, p), destPath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("copyBuildZips() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				// Verify zip files were copied
+				for _, zipFile := range tt.zipFiles {
+					if filepath.Ext(zipFile) == ".zip" {
+						destZipPath := filepath.Join(destPath, zipFile)
+						if _, err := os.Stat(destZipPath); os.IsNotExist(err) {
+							t.Errorf("Zip file %s was not copied", zipFile)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCopyBuildZipsCanceled tests that copyBuildZips stops when the context is canceled.
+func TestCopyBuildZipsCanceled(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := testConfig(tmpDir)
+	p := newTestPackager(t, cfg)
+
+	shaSumContent := testShaSum + "  terraform-provider-example_1.0.0_linux_amd64.zip\n"
+	shaSumPath := filepath.Join(tmpDir, cfg.RepoName+"_"+cfg.Version+"_SHA256SUMS")
+	if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
+		t.Fatalf("Failed to create SHA256SUMS: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := p.copyBuildZips(ctx, testReleaseFiles(t, p), tmpDir)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("copyBuildZips() error = %v, want context.Canceled", err)
+	}
+}
+
+// TestProviderDirs tests the providerDirs method.
+func TestProviderDirs(t *testing.T) {
+	tests := []struct {
+		name          string
+		wellKnownData WellKnown
+	}{
+		{
+			name: "create provider directory structure",
+			wellKnownData: WellKnown{
+				ProvidersV1: "providers",
+				ModulesV1:   "modules",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Change to temp directory for test
+			tmpDir := t.TempDir()
+			t.Chdir(tmpDir)
+			cfg := testConfig("dist")
+			p := newTestPackager(t, cfg)
+
+			resultPath, err := p.providerDirs(tt.wellKnownData)
+			if err != nil {
+				t.Fatalf("providerDirs() error = %v", err)
+			}
+
+			// Verify the returned path
+			expectedPath := filepath.Join("release", tt.wellKnownData.ProvidersV1, cfg.Namespace, cfg.Provider, cfg.Version)
+			if resultPath != expectedPath {
+				t.Errorf("providerDirs() path = %v, want %v", resultPath, expectedPath)
+			}
+
+			// Verify directory structure was created
+			if _, err := os.Stat(resultPath); os.IsNotExist(err) {
+				t.Errorf("Provider directory structure was not created: %v", resultPath)
+			}
+		})
+	}
+}
+
+// TestCreateArchitectureFiles tests the createArchitectureFiles method.
+func TestCreateArchitectureFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{
+			name:    "create architecture files",
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			cfg := testConfig(distPath)
+			wellKnownData := WellKnown{
+				ProvidersV1: "/providers/",
+				ModulesV1:   "/modules/",
+			}
+			p := newTestPackager(t, cfg)
+
+			// Setup directories
+			if err := os.MkdirAll(distPath, os.ModePerm); err != nil {
+				t.Fatalf("Failed to setup dist: %v", err)
+			}
+
+			// Create SHA256SUMS file
+			shaSumContent := testShaSum + "  terraform-provider-example_1.0.0_linux_amd64.zip\n"
+			shaSumPath := filepath.Join(distPath, cfg.RepoName+"_"+cfg.Version+"_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(shaSumContent), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			// Change to temp directory for test
+			t.Chdir(tmpDir)
+
+			// Create the directory structure - match what createArchitectureFiles expects
+			downloadPath := filepath.Join("release", wellKnownData.ProvidersV1, cfg.Namespace, cfg.Provider, cfg.Version, "download")
+			if err := os.MkdirAll(filepath.Join(downloadPath, "linux"), os.ModePerm); err != nil {
+				t.Fatalf("Failed to create directory structure: %v", err)
+			}
+
+			keys := []GpgPublicKey{
+				{KeyId: "1234567890ABCDEF", AsciiArmor: "current key\n"},
+				{KeyId: "FEDCBA0987654321", AsciiArmor: "next key\n", Source: "Example Org", SourceUrl: "https://example.com/security"},
+			}
+			err := p.createArchitectureFiles(context.Background(), testReleaseFiles(t, p), wellKnownData, []string{"6.0"}, keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("createArchitectureFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				// Verify architecture file was created
+				archFilePath := filepath.Join(downloadPath, "linux", "amd64")
+				if _, err := os.Stat(archFilePath); os.IsNotExist(err) {
+					t.Errorf("Architecture file was not created: %v", archFilePath)
+				} else {
+					// Verify the content is valid JSON
+					content, err := os.ReadFile(archFilePath)
+					if err != nil {
+						t.Errorf("Failed to read architecture file: %v", err)
+					} else {
+						var arch Architecture
+						if err := json.Unmarshal(content, &arch); err != nil {
+							t.Errorf("Architecture file is not valid JSON: %v", err)
+						}
+						if arch.Os != "linux" || arch.Arch != "amd64" {
+							t.Errorf("Architecture file has incorrect data: os=%s, arch=%s", arch.Os, arch.Arch)
+						}
+						if !slices.Equal(arch.SigningKeys.GpgPublicKeys, keys) {
+							t.Errorf("Architecture file signing keys = %+v, want %+v", arch.SigningKeys.GpgPublicKeys, keys)
+						}
+						if len(arch.Protocols) != 1 || arch.Protocols[0] != "6.0" {
+							t.Errorf("Architecture file protocols = %v, want [6.0]", arch.Protocols)
+						}
+						wantUrl := "https://registry.example.com/providers/example-org/example/1.0.0/download/terraform-provider-example_1.0.0_linux_amd64.zip"
+						if arch.DownloadUrl != wantUrl {
+							t.Errorf("Architecture file download_url = %s, want %s", arch.DownloadUrl, wantUrl)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCreateVersionsFileMerge tests that createVersionsFile keeps previously published versions.
+func TestCreateVersionsFileMerge(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json":                {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+		"/v1/providers/example-org/example/versions": {http.StatusOK, `{"versions": [{"version": "0.9.0"}, {"version": "0.9.0"}]}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+
+	if err := os.MkdirAll(cfg.DistPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+	shaSumContent := testShaSum + "  terraform-provider-example_1.0.0_linux_amd64.zip\n"
+	if err := os.WriteFile(filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), []byte(shaSumContent), 0644); err != nil {
+		t.Fatalf("Failed to create SHA256SUMS: %v", err)
+	}
+
+	_, err := p.createVersionsFile(context.Background(), testReleaseFiles(t, p), []string{"6.0"})
+	if err != nil {
+		t.Fatalf("createVersionsFile() error = %v", err)
+	}
+
+	content, err := os.ReadFile("release/v1/providers/example-org/example/versions")
+	if err != nil {
+		t.Fatalf("Failed to read versions file: %v", err)
+	}
+	var vers Versions
+	if err := json.Unmarshal(content, &vers); err != nil {
+		t.Fatalf("Versions file is not valid JSON: %v", err)
+	}
+	if len(vers.Versions) != 2 || vers.Versions[0].Version != "0.9.0" || vers.Versions[1].Version != "1.0.0" {
+		t.Errorf("Versions file = %+v, want 0.9.0 and 1.0.0", vers.Versions)
+	}
+}
+
+// TestCreateVersionsFileRepublish tests that publishing a version again replaces its entry in place.
+func TestCreateVersionsFileRepublish(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json":                {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+		"/v1/providers/example-org/example/versions": {http.StatusOK, `{"versions": [{"version": "1.0.0", "protocols": ["5.0"]}, {"version": "0.9.0"}]}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+	writeTestDist(t, cfg.DistPath, "linux_amd64")
+
+	_, err := p.createVersionsFile(context.Background(), testReleaseFiles(t, p), []string{"6.0"})
+	if err != nil {
+		t.Fatalf("createVersionsFile() error = %v", err)
+	}
+
+	var vers Versions
+	readJSON(t, "release/v1/providers/example-org/example/versions", &vers)
+	if len(vers.Versions) != 2 || vers.Versions[0].Version != "1.0.0" || vers.Versions[1].Version != "0.9.0" {
+		t.Fatalf("Versions file = %+v, want 1.0.0 and 0.9.0", vers.Versions)
+	}
+	if !slices.Equal(vers.Versions[0].Protocols, []string{"6.0"}) || len(vers.Versions[0].Platforms) != 1 {
+		t.Errorf("Republished version = %+v, want the new protocols and platforms", vers.Versions[0])
+	}
+}
+
+// TestCreateVersionsFileFetchError tests that createVersionsFile writes nothing when the index cannot be fetched.
+func TestCreateVersionsFileFetchError(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json":                {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+		"/v1/providers/example-org/example/versions": {http.StatusServiceUnavailable, ""},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+
+	_, err := p.createVersionsFile(context.Background(), nil, []string{"6.0"})
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("createVersionsFile() error = %v, want *FetchError with status 503", err)
+	}
+
+	if _, err := os.Stat("release/v1/providers/example-org/example/versions"); !os.IsNotExist(err) {
+		t.Error("Versions file was written despite the fetch error")
+	}
+}
+
+// TestPackage tests a full packaging run against a test registry.
+func TestPackage(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+	key := newTestKey(t)
+
+	if err := os.MkdirAll(cfg.DistPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+	zipName := "terraform-provider-example_1.0.0_linux_amd64.zip"
+	shasum := writeTestZip(t, filepath.Join(cfg.DistPath, zipName), map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "linux_amd64")})
+	files := map[string]string{
+		"terraform-provider-example_1.0.0_SHA256SUMS":    shasum + "  " + zipName + "\n",
+		"terraform-provider-example_1.0.0_manifest.json": `{"version": 1, "metadata": {"protocol_versions": ["6.0"]}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(cfg.DistPath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	writeTestSignature(t, key, filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+	writeTestPublicKey(t, key, "pubkey.txt")
+
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	versionPath := "release/v1/providers/example-org/example/"
+	wantFiles := []string{
+		versionPath + "versions",
+		versionPath + "1.0.0/terraform-provider-example_1.0.0_SHA256SUMS",
+		versionPath + "1.0.0/terraform-provider-example_1.0.0_SHA256SUMS.sig",
+		versionPath + "1.0.0/download/" + zipName,
+		versionPath + "1.0.0/download/linux/amd64",
+		versionPath + "1.0.0/hashes.json",
+	}
+	for _, file := range wantFiles {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("Expected file %s: %v", file, err)
+		}
+	}
+
+	var vers Versions
+	readJSON(t, versionPath+"versions", &vers)
+	var arch Architecture
+	readJSON(t, versionPath+"1.0.0/download/linux/amd64", &arch)
+	if len(vers.Versions) != 1 || !slices.Equal(vers.Versions[0].Protocols, []string{"6.0"}) || !slices.Equal(arch.Protocols, []string{"6.0"}) {
+		t.Errorf("Protocols = %v in versions and %v in platform document, want [6.0] in both", vers.Versions, arch.Protocols)
+	}
+	if keys := arch.SigningKeys.GpgPublicKeys; len(keys) != 1 || keys[0].KeyId != key.PrimaryKey.KeyIdString() {
+		t.Errorf("Signing keys = %+v, want key ID %s derived from the public key", keys, key.PrimaryKey.KeyIdString())
+	}
+
+	var hashes VersionHashes
+	readJSON(t, versionPath+"1.0.0/hashes.json", &hashes)
+	if hashes.Version != "1.0.0" || hashes.Platforms["linux_amd64"].ZH != "zh:"+shasum || hashes.Platforms["linux_amd64"].Filename != zipName {
+		t.Errorf("hashes.json = %+v", hashes)
+	}
+}
+
+// TestPackageIncremental tests merging a version into an existing release tree without the registry.
+func TestPackageIncremental(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	// Every registry request fails, the local tree must be used instead.
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	cfg.Incremental = true
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestDist(t, cfg.DistPath, "linux_amd64")
+	writeTestSignature(t, key, filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+	existing := map[string]string{
+		"release/.well-known/terraform.json":                         `{"providers.v1": "/v1/providers/"}`,
+		"release/v1/providers/example-org/example/versions":          `{"versions": [{"version": "0.9.0", "protocols": ["5.0"], "platforms": []}]}`,
+		"release/v1/providers/example-org/example/0.9.0/hashes.json": `{}`,
+		"release/v1/providers/example-org/other/versions":            `{"versions": []}`,
+	}
+	for name, content := range existing {
+		if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+			t.Fatalf("Failed to setup release: %v", err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to setup release: %v", err)
+		}
+	}
+
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	for _, name := range []string{"release/v1/providers/example-org/example/0.9.0/hashes.json", "release/v1/providers/example-org/other/versions"} {
+		content, err := os.ReadFile(name)
+		if err != nil || string(content) != existing[name] {
+			t.Errorf("%s = %q, %v, want it untouched", name, content, err)
+		}
+	}
+
+	versionsPath := "release/v1/providers/example-org/example/versions"
+	var vers Versions
+	readJSON(t, versionsPath, &vers)
+	if len(vers.Versions) != 2 || vers.Versions[0].Version != "0.9.0" || vers.Versions[1].Version != "1.0.0" {
+		t.Fatalf("Versions file = %+v, want 0.9.0 and 1.0.0", vers.Versions)
+	}
+
+	// A second run with the same inputs doesn't rewrite any file.
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err := filepath.WalkDir("release", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatalf("Failed to setup modification times: %v", err)
+	}
+
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() second run error = %v", err)
+	}
+
+	err = filepath.WalkDir("release", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("%s was rewritten by an unchanged run", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk release: %v", err)
+	}
+}
+
+// TestPackageIncrementalChecksumMismatch tests that a zip not matching SHA256SUMS fails an
+// incremental run before any file of the release tree is written.
+func TestPackageIncrementalChecksumMismatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	cfg.Incremental = true
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestDist(t, cfg.DistPath, "linux_amd64", "darwin_arm64")
+	writeTestSignature(t, key, filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+	before := testTreeFiles(t, "release")
+
+	// Rebuilding a zip without updating SHA256SUMS, e.g. a partial rebuild of the dist directory.
+	zipPath := filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_darwin_arm64.zip")
+	writeTestZip(t, zipPath, map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "darwin_arm64") + "rebuilt"})
+
+	err := p.Package(context.Background())
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Path != zipPath {
+		t.Fatalf("Package() error = %v, want *ChecksumError for %s", err, zipPath)
+	}
+	if after := testTreeFiles(t, "release"); !maps.Equal(after, before) {
+		t.Errorf("Package() changed the release tree before failing")
+	}
+}
+
+// readJSON decodes the JSON file at path into v and fails the test on errors.
+func readJSON(t *testing.T, path string, v any) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		t.Fatalf("%s is not valid JSON: %v", path, err)
+	}
+}
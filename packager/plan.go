@@ -0,0 +1,415 @@
+package packager
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PlanBase is what a dry run compares the planned files with.
+type PlanBase string
+
+const (
+	// PlanLocal compares the planned files with the files on disk.
+	PlanLocal PlanBase = "local"
+	// PlanRemote compares the files of the registry tree with the files published at
+	// https://<Domain>/, and the files of the network mirror tree with the files published at
+	// Config.NetworkMirrorURL when it is set. The other files are compared with the files on disk.
+	PlanRemote PlanBase = "remote"
+)
+
+// ChangeAction is what packaging does to a file.
+type ChangeAction string
+
+const (
+	// ChangeCreate writes a file that does not exist yet.
+	ChangeCreate ChangeAction = "create"
+	// ChangeUpdate replaces a file with different content.
+	ChangeUpdate ChangeAction = "update"
+	// ChangeDelete deletes a file along with the output directory, which is recreated unless
+	// Config.Incremental is set, or an unpacked platform directory.
+	ChangeDelete ChangeAction = "delete"
+	// ChangeUnchanged writes a file with the content it already has.
+	ChangeUnchanged ChangeAction = "unchanged"
+)
+
+// FileChange is a file written or deleted by packaging.
+type FileChange struct {
+	Action ChangeAction `json:"action"`
+	Path   string       `json:"path"`
+	// URL is the published file the planned file was compared with, for PlanRemote.
+	URL string `json:"url,omitempty"`
+	// SHA256 and Size describe the planned content, they are empty for deleted files.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	// CurrentSHA256 is the SHA256 of the file replaced by an update.
+	CurrentSHA256 string `json:"current_sha256,omitempty"`
+}
+
+// PlanSummary counts the files of a plan by action.
+type PlanSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Plan lists the files Package would write or delete, sorted by path.
+type Plan struct {
+	Provider string       `json:"provider"`
+	Version  string       `json:"version"`
+	Base     PlanBase     `json:"base"`
+	Summary  PlanSummary  `json:"summary"`
+	Changes  []FileChange `json:"changes"`
+}
+
+// HasChanges reports whether packaging would create, update or delete any file.
+func (p Plan) HasChanges() bool {
+	return p.Summary.Create+p.Summary.Update+p.Summary.Delete > 0
+}
+
+// plannedFile is a file written during a dry run. The content of documents is kept so that later
+// steps can read it back, zips and extracted files are read from src or not at all.
+type plannedFile struct {
+	data []byte
+	src  string
+	sum  string
+	size int64
+}
+
+// planner records the files written and the directories deleted during a dry run.
+type planner struct {
+	mu      sync.Mutex
+	files   map[string]plannedFile
+	removed []string
+}
+
+func (pl *planner) add(path string, file plannedFile) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.files[filepath.Clean(path)] = file
+}
+
+// remove records the deletion of the directory at path and of the files planned in it.
+func (pl *planner) remove(path string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	for name := range pl.files {
+		if isWithin(name, path) {
+			delete(pl.files, name)
+		}
+	}
+	pl.removed = append(pl.removed, filepath.Clean(path))
+}
+
+// readFile returns the planned content of path, or the content on disk when path was neither
+// written nor deleted.
+func (pl *planner) readFile(path string) ([]byte, error) {
+	pl.mu.Lock()
+	file, ok := pl.files[filepath.Clean(path)]
+	removed := slices.ContainsFunc(pl.removed, func(dir string) bool { return isWithin(path, dir) })
+	pl.mu.Unlock()
+
+	switch {
+	case ok && file.src != "":
+		return os.ReadFile(file.src)
+	case ok:
+		return file.data, nil
+	case removed:
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	return os.ReadFile(path)
+}
+
+// unzip plans the extraction of the zip at zipPath into destPath, as unzip does.
+func (pl *planner) unzip(zipPath, destPath string) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	pl.remove(destPath)
+
+	for _, f := range reader.File {
+		entryPath, err := zipEntryPath(f, destPath)
+		if err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		source, err := f.Open()
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, source)
+		source.Close()
+		if err != nil {
+			return err
+		}
+		pl.add(entryPath, plannedFile{sum: hex.EncodeToString(h.Sum(nil)), size: size})
+	}
+
+	return nil
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && filepath.IsLocal(rel)
+}
+
+// DryRun runs Package without writing to disk and returns the files it would write or delete,
+// compared with base. The inputs are read and checked, and the registry is queried, exactly as
+// Package does, so a dry run fails when packaging would.
+func (p *Packager) DryRun(ctx context.Context, base PlanBase) (Plan, error) {
+	dry := *p
+	dry.plan = &planner{files: map[string]plannedFile{}}
+
+	err := dry.Package(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p.logger.Printf("* Comparing planned files with the %s files", base)
+
+	return dry.diffPlan(ctx, base)
+}
+
+// diffPlan compares the files recorded by the planner with base.
+func (p *Packager) diffPlan(ctx context.Context, base PlanBase) (Plan, error) {
+	plan := Plan{
+		Provider: p.cfg.Domain + "/" + p.cfg.Namespace + "/" + p.cfg.Provider,
+		Version:  p.cfg.Version,
+		Base:     base,
+		Changes:  []FileChange{},
+	}
+
+	for path, file := range p.plan.files {
+		change := FileChange{Path: path, SHA256: file.sum, Size: file.size}
+
+		var current string
+		var exists bool
+		var err error
+		if url, ok := p.publishedURL(path); ok && base == PlanRemote {
+			change.URL = url
+			current, exists, err = p.fetchSHA256(ctx, url)
+		} else {
+			current, exists, err = localSHA256(path)
+		}
+		if err != nil {
+			return plan, err
+		}
+
+		switch {
+		case !exists:
+			change.Action = ChangeCreate
+		case current != file.sum:
+			change.Action = ChangeUpdate
+			change.CurrentSHA256 = current
+		default:
+			change.Action = ChangeUnchanged
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	deleted := map[string]bool{}
+	for _, dir := range p.plan.removed {
+		// The deletion of a directory of the registry tree only matters locally, syncing the
+		// tree to a registry leaves the files of other versions in place.
+		if _, ok := p.publishedURL(dir); ok && base == PlanRemote {
+			continue
+		}
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if _, ok := p.plan.files[path]; ok || deleted[path] {
+				return nil
+			}
+			deleted[path] = true
+			plan.Changes = append(plan.Changes, FileChange{Action: ChangeDelete, Path: path})
+			return nil
+		})
+		if err != nil {
+			return plan, err
+		}
+	}
+
+	slices.SortFunc(plan.Changes, func(a, b FileChange) int { return strings.Compare(a.Path, b.Path) })
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case ChangeCreate:
+			plan.Summary.Create++
+		case ChangeUpdate:
+			plan.Summary.Update++
+		case ChangeDelete:
+			plan.Summary.Delete++
+		case ChangeUnchanged:
+			plan.Summary.Unchanged++
+		}
+	}
+
+	return plan, nil
+}
+
+// publishedURL returns the URL a file of the registry tree, or of the network mirror tree when
+// Config.NetworkMirrorURL is set, is published at.
+func (p *Packager) publishedURL(path string) (string, bool) {
+	if rel, err := filepath.Rel(p.cfg.OutputDir, path); err == nil && filepath.IsLocal(rel) {
+		return "https://" + p.cfg.Domain + "/" + filepath.ToSlash(rel), true
+	}
+	if p.cfg.NetworkMirrorDir == "" || p.cfg.NetworkMirrorURL == "" {
+		return "", false
+	}
+	if rel, err := filepath.Rel(p.cfg.NetworkMirrorDir, path); err == nil && filepath.IsLocal(rel) {
+		return strings.TrimSuffix(p.cfg.NetworkMirrorURL, "/") + "/" + filepath.ToSlash(rel), true
+	}
+
+	return "", false
+}
+
+// localSHA256 returns the hex encoded SHA256 of the file at path and whether it exists.
+func localSHA256(path string) (string, bool, error) {
+	sum, err := fileSHA256(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return sum, true, nil
+}
+
+// fetchSHA256 returns the hex encoded SHA256 of the file published at url and whether it exists.
+// Failures are returned as *FetchError.
+func (p *Packager) fetchSHA256(ctx context.Context, url string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", false, &FetchError{URL: url, Err: err}
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", false, &FetchError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, &FetchError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(h, resp.Body)
+	if err != nil {
+		return "", false, &FetchError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("reading response body: %w", err)}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// The methods below write to disk, or record the write in the planner during a dry run.
+
+// readFile reads path, as written so far by a dry run.
+func (p *Packager) readFile(path string) ([]byte, error) {
+	if p.plan != nil {
+		return p.plan.readFile(path)
+	}
+
+	return os.ReadFile(path)
+}
+
+// writeFile writes fileContents to fileName unless it already has that content.
+func (p *Packager) writeFile(fileName string, fileContents []byte) error {
+	if p.plan != nil {
+		sum := sha256.Sum256(fileContents)
+		p.plan.add(fileName, plannedFile{data: fileContents, sum: hex.EncodeToString(sum[:]), size: int64(len(fileContents))})
+		return nil
+	}
+
+	return writeFile(fileName, fileContents)
+}
+
+// copyFile copies src to dst like copyFile.
+func (p *Packager) copyFile(src, dst string) error {
+	if p.plan != nil {
+		data, err := p.plan.readFile(src)
+		if err != nil {
+			return err
+		}
+		return p.writeFile(dst, data)
+	}
+
+	return copyFile(src, dst)
+}
+
+// planZip records the placement of the zip src with the SHA256 sum at dst.
+func (p *Packager) planZip(src, dst, sum string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	p.plan.add(dst, plannedFile{src: src, sum: sum, size: info.Size()})
+
+	return nil
+}
+
+// unzip replaces destPath with the contents of the zip at zipPath.
+func (p *Packager) unzip(zipPath, destPath string) error {
+	if p.plan != nil {
+		return p.plan.unzip(zipPath, destPath)
+	}
+
+	return unzip(zipPath, destPath)
+}
+
+func (p *Packager) createDir(path string) error {
+	if p.plan != nil {
+		return nil
+	}
+
+	return createDir(path)
+}
+
+func (p *Packager) createDirRecursive(path string) error {
+	if p.plan != nil {
+		return nil
+	}
+
+	return createDirRecursive(path)
+}
+
+func (p *Packager) deleteDir(path string) error {
+	if p.plan != nil {
+		p.plan.remove(path)
+		return nil
+	}
+
+	return deleteDir(path)
+}
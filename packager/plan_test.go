@@ -0,0 +1,175 @@
+package packager
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testTreeFiles returns the files under root with their content.
+func testTreeFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		files[path] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk %s: %v", root, err)
+	}
+
+	return files
+}
+
+// planActions returns the action of every file of plan by path.
+func planActions(plan Plan) map[string]ChangeAction {
+	actions := map[string]ChangeAction{}
+	for _, change := range plan.Changes {
+		actions[change.Path] = change.Action
+	}
+
+	return actions
+}
+
+// TestDryRun tests that a dry run plans every file Package writes without writing to the working
+// directory or the temporary directory, and compares them with the output directory and with the
+// registry.
+func TestDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+	// Creating a temporary file fails the dry run.
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	cfg.GPGPrivateKeyFile = "private.asc"
+	cfg.NetworkMirrorDir = "mirror"
+	cfg.FilesystemMirrorDir = "plugins"
+	cfg.FilesystemMirrorLayout = LayoutUnpacked
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestPrivateKey(t, cfg.GPGPrivateKeyFile, "", key)
+	if err := os.MkdirAll(cfg.DistPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+	zipName := "terraform-provider-example_1.0.0_linux_amd64.zip"
+	shasum := writeTestZip(t, filepath.Join(cfg.DistPath, zipName), map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "linux_amd64")})
+
+	before := testTreeFiles(t, ".")
+	plan, err := p.DryRun(context.Background(), PlanLocal)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	if after := testTreeFiles(t, "."); len(after) != len(before) {
+		t.Errorf("DryRun() wrote %d files", len(after)-len(before))
+	}
+
+	versionPath := "release/v1/providers/example-org/example/1.0.0/"
+	wantFiles := []string{
+		"dist/terraform-provider-example_1.0.0_SHA256SUMS",
+		"dist/terraform-provider-example_1.0.0_SHA256SUMS.sig",
+		"release/v1/providers/example-org/example/versions",
+		versionPath + "terraform-provider-example_1.0.0_SHA256SUMS",
+		versionPath + "terraform-provider-example_1.0.0_SHA256SUMS.sig",
+		versionPath + "download/" + zipName,
+		versionPath + "download/linux/amd64",
+		versionPath + "hashes.json",
+		"mirror/" + domain + "/example-org/example/index.json",
+		"mirror/" + domain + "/example-org/example/1.0.0.json",
+		"mirror/" + domain + "/example-org/example/" + zipName,
+		"plugins/" + domain + "/example-org/example/1.0.0/linux_amd64/terraform-provider-example_v1.0.0",
+	}
+	actions := planActions(plan)
+	for _, file := range wantFiles {
+		if actions[filepath.FromSlash(file)] != ChangeCreate {
+			t.Errorf("DryRun() action of %s = %q, want %q", file, actions[filepath.FromSlash(file)], ChangeCreate)
+		}
+	}
+	if plan.Summary.Create != len(wantFiles) || plan.Summary.Create != len(plan.Changes) {
+		t.Errorf("DryRun() summary = %+v with %d changes, want %d files to create", plan.Summary, len(plan.Changes), len(wantFiles))
+	}
+	for _, change := range plan.Changes {
+		if change.Path == filepath.FromSlash(versionPath+"download/"+zipName) && change.SHA256 != shasum {
+			t.Errorf("DryRun() SHA256 of the zip = %s, want %s", change.SHA256, shasum)
+		}
+	}
+
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	// Without the private key, packaging the same inputs again changes nothing.
+	cfg.GPGPrivateKeyFile = ""
+	p = newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+	plan, err = p.DryRun(context.Background(), PlanLocal)
+	if err != nil {
+		t.Fatalf("DryRun() after Package() error = %v", err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("DryRun() after Package() = %+v, want no changes", plan.Changes)
+	}
+
+	writeTestTree(t, ".", map[string]string{
+		"release/stale.txt":         "stale",
+		versionPath + "hashes.json": "{}",
+	})
+	plan, err = p.DryRun(context.Background(), PlanLocal)
+	if err != nil {
+		t.Fatalf("DryRun() error = %v", err)
+	}
+	actions = planActions(plan)
+	if actions[filepath.FromSlash("release/stale.txt")] != ChangeDelete || actions[filepath.FromSlash(versionPath+"hashes.json")] != ChangeUpdate {
+		t.Errorf("DryRun() actions = %v, want stale.txt deleted and hashes.json updated", actions)
+	}
+	if plan.Summary.Delete != 1 || plan.Summary.Update != 1 {
+		t.Errorf("DryRun() summary = %+v, want 1 update and 1 delete", plan.Summary)
+	}
+
+	// The registry already has the versions file, but not the zip.
+	versions, err := os.ReadFile("release/v1/providers/example-org/example/versions")
+	if err != nil {
+		t.Fatalf("Failed to read versions file: %v", err)
+	}
+	remoteDomain, remoteClient := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json":                {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+		"/v1/providers/example-org/example/versions": {http.StatusOK, string(versions)},
+	})
+	cfg.Domain = remoteDomain
+	cfg.NetworkMirrorDir = ""
+	cfg.FilesystemMirrorDir = ""
+	p = newTestPackager(t, cfg, WithHTTPClient(remoteClient))
+	plan, err = p.DryRun(context.Background(), PlanRemote)
+	if err != nil {
+		t.Fatalf("DryRun() against the registry error = %v", err)
+	}
+	for _, change := range plan.Changes {
+		switch change.Path {
+		case filepath.FromSlash("release/v1/providers/example-org/example/versions"):
+			if change.Action != ChangeUnchanged || change.URL != "https://"+remoteDomain+"/v1/providers/example-org/example/versions" {
+				t.Errorf("DryRun() versions file = %+v, want unchanged on the registry", change)
+			}
+		case filepath.FromSlash(versionPath + "download/" + zipName):
+			if change.Action != ChangeCreate {
+				t.Errorf("DryRun() zip = %+v, want created on the registry", change)
+			}
+		}
+		if change.Action == ChangeDelete {
+			t.Errorf("DryRun() against the registry deletes %s", change.Path)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package packager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// defaultProtocols is advertised when neither Config.Protocols nor a registry manifest is given.
+// It is the list previous releases published in the versions file, so that versions packaged
+// without a manifest keep advertising the same protocols.
+var defaultProtocols = []string{"5.0", "5.1"}
+
+// protocolPattern matches a "<major>.<minor>" plugin protocol version of a major version Terraform supports.
+var protocolPattern = regexp.MustCompile(`^[456]\.[0-9]+$`)
+
+// registryManifest is the terraform-registry-manifest.json GoReleaser ships as <repo>_<version>_manifest.json.
+type registryManifest struct {
+	Version  int `json:"version"`
+	Metadata struct {
+		ProtocolVersions []string `json:"protocol_versions"`
+	} `json:"metadata"`
+}
+
+// validateProtocols checks that protocols is a non-empty list of distinct protocol versions.
+func validateProtocols(protocols []string) error {
+	if len(protocols) == 0 {
+		return errors.New("no protocol versions")
+	}
+
+	seen := map[string]bool{}
+	for _, protocol := range protocols {
+		if !protocolPattern.MatchString(protocol) {
+			return fmt.Errorf("invalid protocol version %q, want <major>.<minor> with major 4, 5 or 6", protocol)
+		}
+		if seen[protocol] {
+			return fmt.Errorf("duplicate protocol version %q", protocol)
+		}
+		seen[protocol] = true
+	}
+
+	return nil
+}
+
+// resolveProtocols returns Config.Protocols when set, otherwise the protocol versions of the
+// registry manifest in the dist directory, otherwise defaultProtocols.
+func (p *Packager) resolveProtocols() ([]string, error) {
+	if len(p.cfg.Protocols) > 0 {
+		p.logger.Printf("* Using protocol versions %v from configuration", p.cfg.Protocols)
+		return p.cfg.Protocols, nil
+	}
+
+	manifestPath := filepath.Join(p.cfg.DistPath, p.cfg.RepoName+"_"+p.cfg.Version+"_manifest.json")
+	content, err := os.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		p.warnf("No registry manifest at %s, using protocol versions %v", manifestPath, defaultProtocols)
+		return defaultProtocols, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest registryManifest
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing registry manifest %s: %w", manifestPath, err)
+	}
+	if manifest.Version != 1 {
+		return nil, fmt.Errorf("registry manifest %s: unsupported version %d", manifestPath, manifest.Version)
+	}
+
+	err = validateProtocols(manifest.Metadata.ProtocolVersions)
+	if err != nil {
+		return nil, fmt.Errorf("registry manifest %s: %w", manifestPath, err)
+	}
+
+	p.logger.Printf("* Using protocol versions %v from %s", manifest.Metadata.ProtocolVersions, manifestPath)
+
+	return manifest.Metadata.ProtocolVersions, nil
+}
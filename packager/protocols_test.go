@@ -0,0 +1,106 @@
+package packager
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestValidateProtocols tests the validateProtocols function.
+func TestValidateProtocols(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocols []string
+		wantErr   bool
+	}{
+		{name: "plugin framework", protocols: []string{"6.0"}},
+		{name: "plugin sdk", protocols: []string{"5.0", "5.1"}},
+		{name: "legacy", protocols: []string{"4.0"}},
+		{name: "empty", protocols: nil, wantErr: true},
+		{name: "major only", protocols: []string{"6"}, wantErr: true},
+		{name: "unsupported major", protocols: []string{"7.0"}, wantErr: true},
+		{name: "not a version", protocols: []string{"v6.0"}, wantErr: true},
+		{name: "duplicate", protocols: []string{"5.0", "5.0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProtocols(tt.protocols)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateProtocols(%v) error = %v, wantErr %v", tt.protocols, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestResolveProtocols tests the resolveProtocols method.
+func TestResolveProtocols(t *testing.T) {
+	tests := []struct {
+		name     string
+		override []string
+		manifest string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "manifest",
+			manifest: `{"version": 1, "metadata": {"protocol_versions": ["6.0"]}}`,
+			want:     []string{"6.0"},
+		},
+		{
+			name:     "override wins over manifest",
+			override: []string{"5.0", "5.1"},
+			manifest: `{"version": 1, "metadata": {"protocol_versions": ["6.0"]}}`,
+			want:     []string{"5.0", "5.1"},
+		},
+		{
+			name: "no manifest keeps the previous default",
+			want: []string{"5.0", "5.1"},
+		},
+		{
+			name:     "malformed manifest",
+			manifest: `{"version": 1, "metadata": `,
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported manifest version",
+			manifest: `{"version": 2, "metadata": {"protocol_versions": ["6.0"]}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "manifest without protocols",
+			manifest: `{"version": 1, "metadata": {}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "manifest with invalid protocol",
+			manifest: `{"version": 1, "metadata": {"protocol_versions": ["six"]}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := testConfig(tmpDir)
+			cfg.Protocols = tt.override
+			p := newTestPackager(t, cfg)
+
+			if tt.manifest != "" {
+				manifestPath := filepath.Join(tmpDir, "terraform-provider-example_1.0.0_manifest.json")
+				if err := os.WriteFile(manifestPath, []byte(tt.manifest), 0644); err != nil {
+					t.Fatalf("Failed to create manifest: %v", err)
+				}
+			}
+
+			got, err := p.resolveProtocols()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveProtocols() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolveProtocols() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package packager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which shares the extents of a file with another one.
+const ficlone = 0x40049409
+
+// reflink clones src into the new file dst with the FICLONE ioctl.
+func reflink(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd())
+	switch {
+	case errno == 0:
+		return dstFile.Close()
+	case errno == syscall.EXDEV, errno == syscall.EOPNOTSUPP, errno == syscall.EINVAL, errno == syscall.ENOTTY:
+		// The files are on different filesystems, or the filesystem cannot clone files.
+		return fmt.Errorf("cloning %s: %w: %w", src, errors.ErrUnsupported, errno)
+	}
+
+	return fmt.Errorf("cloning %s: %w", src, errno)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package packager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// reflink is only supported on Linux, the zips are copied on other platforms.
+func reflink(src, dst string) error {
+	return fmt.Errorf("cloning %s: %w", src, errors.ErrUnsupported)
+}
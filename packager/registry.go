@@ -0,0 +1,152 @@
+package packager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+)
+
+// downloadVersionsFile returns the published versions of the provider and the service discovery
+// document of the registry. In incremental mode, the files of the tree in the output directory
+// are used when present.
+func (p *Packager) downloadVersionsFile(ctx context.Context) (Versions, WellKnown, error) {
+	wellKnownData, err := p.wellKnown(ctx, "providers.v1")
+	if err != nil {
+		return Versions{}, wellKnownData, err
+	}
+
+	var versionsData Versions
+	if p.cfg.Incremental {
+		versionsPath := filepath.Join(p.cfg.OutputDir, wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider, "versions")
+		ok, err := readJSONFile(versionsPath, &versionsData)
+		if err != nil {
+			return Versions{}, wellKnownData, fmt.Errorf("reading local versions file: %w", err)
+		}
+		if ok {
+			p.logger.Printf("* Merging into local versions file %s", versionsPath)
+			return versionsData, wellKnownData, nil
+		}
+	}
+
+	p.logger.Println("* Downloading versions file")
+
+	versionsUrl := fmt.Sprintf("https://%s%s%s/%s/versions", p.cfg.Domain, wellKnownData.ProvidersV1, p.cfg.Namespace, p.cfg.Provider)
+	err = p.fetchJSON(ctx, versionsUrl, &versionsData)
+	if errors.Is(err, ErrNotFound) {
+		if !p.allowNew {
+			return Versions{}, wellKnownData, fmt.Errorf("provider %s/%s is not published yet: %w", p.cfg.Namespace, p.cfg.Provider, err)
+		}
+		p.warnf("Versions file not found at %s, publishing first version", versionsUrl)
+		return Versions{}, wellKnownData, nil
+	}
+	if err != nil {
+		return Versions{}, wellKnownData, fmt.Errorf("downloading versions file: %w", err)
+	}
+
+	return versionsData, wellKnownData, nil
+}
+
+// wellKnown returns the service discovery document of the registry domain, which must advertise
+// service. A new registry gets DefaultWellKnown, written to the output directory, when new
+// providers and modules are allowed. Config.Login is added to the document, which is then
+// written to the output directory as well.
+func (p *Packager) wellKnown(ctx context.Context, service string) (WellKnown, error) {
+	wellKnownPath := filepath.Join(p.cfg.OutputDir, ".well-known", "terraform.json")
+
+	wellKnownData, write, err := p.resolveWellKnown(ctx, service, wellKnownPath)
+	if err != nil {
+		return DefaultWellKnown, err
+	}
+
+	if p.cfg.Login != nil {
+		wellKnownData.LoginV1 = p.cfg.Login
+		write = true
+	}
+	if !write {
+		return wellKnownData, nil
+	}
+
+	wellKnownFile, err := json.MarshalIndent(wellKnownData, "", "  ")
+	if err != nil {
+		return DefaultWellKnown, err
+	}
+	err = p.createDirRecursive(filepath.Dir(wellKnownPath))
+	if err != nil {
+		return DefaultWellKnown, err
+	}
+	err = p.writeFile(wellKnownPath, wellKnownFile)
+	if err != nil {
+		return DefaultWellKnown, err
+	}
+
+	return wellKnownData, nil
+}
+
+// resolveWellKnown reads the service discovery document from the output directory in incremental
+// mode, or from the registry. It reports whether the document must be written to the output
+// directory, which is the case for DefaultWellKnown.
+func (p *Packager) resolveWellKnown(ctx context.Context, service, wellKnownPath string) (WellKnown, bool, error) {
+	var wellKnownData WellKnown
+
+	if p.cfg.Incremental {
+		ok, err := readJSONFile(wellKnownPath, &wellKnownData)
+		if err != nil {
+			return DefaultWellKnown, false, fmt.Errorf("reading local well-known file: %w", err)
+		}
+		if ok && wellKnownData.service(service) != "" {
+			return wellKnownData, false, nil
+		}
+	}
+
+	wellKnownUrl := fmt.Sprintf("https://%s/.well-known/terraform.json", p.cfg.Domain)
+	err := p.fetchJSON(ctx, wellKnownUrl, &wellKnownData)
+	if errors.Is(err, ErrNotFound) && p.allowNew {
+		p.warnf("Well-known file not found at %s, using defaults for a new registry", wellKnownUrl)
+		return DefaultWellKnown, true, nil
+	}
+	if err != nil {
+		return DefaultWellKnown, false, fmt.Errorf("downloading well-known file: %w", err)
+	}
+	if wellKnownData.service(service) == "" {
+		return DefaultWellKnown, false, fmt.Errorf("well-known file %s does not advertise %s", wellKnownUrl, service)
+	}
+
+	return wellKnownData, false, nil
+}
+
+// fetchJSON decodes the JSON document at url into v. Failures are returned as *FetchError.
+func (p *Packager) fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &FetchError{URL: url, Err: err}
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return &FetchError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &FetchError{URL: url, StatusCode: resp.StatusCode, Err: ErrNotFound}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &FetchError{URL: url, StatusCode: resp.StatusCode}
+	}
+
+	bodyResp, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &FetchError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("reading response body: %w", err)}
+	}
+
+	err = json.Unmarshal(bodyResp, v)
+	if err != nil {
+		return &FetchError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("unmarshalling JSON: %w", err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package packager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testResponse is a canned response served by newTestRegistry.
+type testResponse struct {
+	status int
+	body   string
+}
+
+// newTestRegistry starts a TLS registry serving responses by URL path and returns its domain and a
+// client that trusts it. Paths without a response return 404 Not Found.
+func newTestRegistry(t *testing.T, responses map[string]testResponse) (string, *http.Client) {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(server.Close)
+
+	return strings.TrimPrefix(server.URL, "https://"), server.Client()
+}
+
+// TestDownloadVersionsFile tests the downloadVersionsFile method against a test registry.
+func TestDownloadVersionsFile(t *testing.T) {
+	wellKnown := testResponse{http.StatusOK, `{"providers.v1": "/v1/providers/", "modules.v1": "/v1/modules/"}`}
+	versions := testResponse{http.StatusOK, `{"versions": [{"version": "0.9.0", "protocols": ["5.0"], "platforms": [{"os": "linux", "arch": "amd64"}]}]}`}
+
+	tests := []struct {
+		name          string
+		responses     map[string]testResponse
+		allowNew      bool
+		wantVersions  int
+		wantWellKnown bool
+		wantNotFound  bool
+		wantFetchErr  bool
+		wantErr       bool
+	}{
+		{
+			name: "existing provider",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json":                wellKnown,
+				"/v1/providers/example-org/example/versions": versions,
+			},
+			wantVersions: 1,
+		},
+		{
+			name: "well-known server error",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": {http.StatusInternalServerError, "oops"},
+			},
+			allowNew:     true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name: "malformed well-known",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": {http.StatusOK, "<html>"},
+			},
+			allowNew:     true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name: "well-known without providers.v1",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": {http.StatusOK, `{"modules.v1": "/v1/modules/"}`},
+			},
+			allowNew: true,
+			wantErr:  true,
+		},
+		{
+			name: "versions server error",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json":                wellKnown,
+				"/v1/providers/example-org/example/versions": {http.StatusBadGateway, ""},
+			},
+			allowNew:     true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name: "malformed versions",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json":                wellKnown,
+				"/v1/providers/example-org/example/versions": {http.StatusOK, `{"versions": {}}`},
+			},
+			allowNew:     true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name: "versions not found",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": wellKnown,
+			},
+			wantNotFound: true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name: "versions not found with allow new",
+			responses: map[string]testResponse{
+				"/.well-known/terraform.json": wellKnown,
+			},
+			allowNew: true,
+		},
+		{
+			name:         "well-known not found",
+			responses:    map[string]testResponse{},
+			wantNotFound: true,
+			wantFetchErr: true,
+			wantErr:      true,
+		},
+		{
+			name:          "well-known not found with allow new",
+			responses:     map[string]testResponse{},
+			allowNew:      true,
+			wantWellKnown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			domain, client := newTestRegistry(t, tt.responses)
+
+			cfg := testConfig("dist")
+			cfg.Domain = domain
+			p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(tt.allowNew))
+
+			got, wellKnownData, err := p.downloadVersionsFile(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadVersionsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != tt.wantNotFound {
+				t.Errorf("downloadVersionsFile() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+			if tt.wantErr {
+				var fetchErr *FetchError
+				if errors.As(err, &fetchErr) != tt.wantFetchErr {
+					t.Errorf("downloadVersionsFile() error = %v, wantFetchErr %v", err, tt.wantFetchErr)
+				}
+				return
+			}
+
+			if len(got.Versions) != tt.wantVersions {
+				t.Errorf("downloadVersionsFile() returned %d versions, want %d", len(got.Versions), tt.wantVersions)
+			}
+			if wellKnownData.ProvidersV1 != "/v1/providers/" {
+				t.Errorf("downloadVersionsFile() ProvidersV1 = %v, want /v1/providers/", wellKnownData.ProvidersV1)
+			}
+
+			_, err = os.Stat("release/.well-known/terraform.json")
+			if (err == nil) != tt.wantWellKnown {
+				t.Errorf("release/.well-known/terraform.json exists = %v, want %v", err == nil, tt.wantWellKnown)
+			}
+		})
+	}
+}
+
+// TestDownloadVersionsFileUnreachable tests that an unreachable registry is never treated as a new provider.
+func TestDownloadVersionsFileUnreachable(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// Reserve a free port and release it so every request fails at the connection level.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to setup test: %v", err)
+	}
+	cfg := testConfig("dist")
+	cfg.Domain = listener.Addr().String()
+	listener.Close()
+
+	p := newTestPackager(t, cfg, WithAllowNew(true))
+
+	_, _, err = p.downloadVersionsFile(context.Background())
+	if err == nil {
+		t.Fatal("downloadVersionsFile() expected error for unreachable registry, got nil")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("downloadVersionsFile() error = %v, must not be ErrNotFound", err)
+	}
+}
+
+// TestWellKnownLogin tests that Config.Login is added to the well-known file of the output tree.
+func TestWellKnownLogin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/registry/providers/"}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.Login = &LoginV1{Client: "terraform-cli", GrantTypes: []string{"authz_code"}, Authz: "https://sso.example.com/authorize", Token: "https://sso.example.com/token", Ports: []int{10000, 10010}}
+	p := newTestPackager(t, cfg, WithHTTPClient(client))
+
+	if _, err := p.wellKnown(context.Background(), "providers.v1"); err != nil {
+		t.Fatalf("wellKnown() error = %v", err)
+	}
+
+	var written WellKnown
+	if ok, err := readJSONFile("release/.well-known/terraform.json", &written); !ok || err != nil {
+		t.Fatalf("Failed to read well-known file: %v", err)
+	}
+	if written.ProvidersV1 != "/registry/providers/" {
+		t.Errorf("providers.v1 = %q, want the published one", written.ProvidersV1)
+	}
+	if written.LoginV1 == nil || written.LoginV1.Token != cfg.Login.Token {
+		t.Errorf("login.v1 = %+v, want %+v", written.LoginV1, cfg.Login)
+	}
+}
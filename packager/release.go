@@ -0,0 +1,114 @@
+package packager
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// releaseFile is a file of the dist directory listed in SHA256SUMS.
+type releaseFile struct {
+	shaSumEntry
+	// platformZip reports whether the file is named like a platform zip of the version.
+	platformZip bool
+	// platforms are the published platforms of a platform zip, empty when Config.Platforms and
+	// Config.ExcludePlatforms filter them all out.
+	platforms []Platform
+}
+
+// releaseFiles parses SHA256SUMS and resolves the platforms of every file it lists, so that
+// every packaging step works from a single read of the release inputs.
+func (p *Packager) releaseFiles() ([]releaseFile, error) {
+	shaSums, err := p.shaSums()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]releaseFile, 0, len(shaSums))
+	for _, entry := range shaSums {
+		platforms, ok := p.archivePlatforms(entry.name)
+		files = append(files, releaseFile{shaSumEntry: entry, platformZip: ok, platforms: platforms})
+	}
+
+	return files, nil
+}
+
+// loadRelease generates SHA256SUMS when missing, parses it once and checks that it lists the zips
+// of the dist directory and every required platform, and that the zips match it. Nothing is
+// written to the release or mirror trees before these checks pass.
+func (p *Packager) loadRelease(ctx context.Context) ([]releaseFile, error) {
+	err := p.writeShaSums()
+	if err != nil {
+		return nil, fmt.Errorf("generating SHA256SUMS: %w", err)
+	}
+
+	files, err := p.releaseFiles()
+	if err != nil {
+		return nil, fmt.Errorf("reading SHA256SUMS: %w", err)
+	}
+
+	err = p.checkShaSums(files)
+	if err != nil {
+		return nil, fmt.Errorf("checking SHA256SUMS: %w", err)
+	}
+
+	err = p.checkPlatforms(files)
+	if err != nil {
+		return nil, fmt.Errorf("checking platforms: %w", err)
+	}
+
+	err = p.verifyZips(ctx, files)
+	if err != nil {
+		return nil, fmt.Errorf("verifying zips: %w", err)
+	}
+
+	return files, nil
+}
+
+// jobs returns the number of files processed concurrently, Config.Jobs or GOMAXPROCS.
+func (p *Packager) jobs() int {
+	if p.cfg.Jobs > 0 {
+		return p.cfg.Jobs
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+// forEach calls fn for every file on up to jobs goroutines. The context passed to fn is canceled
+// on the first error, which is returned once the running calls are done, and the remaining files
+// are skipped.
+func (p *Packager) forEach(ctx context.Context, files []releaseFile, fn func(ctx context.Context, file releaseFile) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	work := make(chan releaseFile)
+	var wg sync.WaitGroup
+	for range min(p.jobs(), len(files)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range work {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, file); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case work <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
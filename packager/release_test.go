@@ -0,0 +1,162 @@
+package packager
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// TestForEach tests that forEach processes every file with at most Config.Jobs concurrent calls.
+func TestForEach(t *testing.T) {
+	files := make([]releaseFile, 20)
+	for i := range files {
+		files[i].name = fmt.Sprintf("file-%d", i)
+	}
+
+	for _, jobs := range []int{1, 3, 0} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			cfg := testConfig(t.TempDir())
+			cfg.Jobs = jobs
+			p := newTestPackager(t, cfg)
+
+			var mu sync.Mutex
+			seen := map[string]int{}
+			var running, maxRunning atomic.Int32
+			err := p.forEach(context.Background(), files, func(ctx context.Context, file releaseFile) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				seen[file.name]++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("forEach() error = %v", err)
+			}
+
+			if len(seen) != len(files) {
+				t.Errorf("forEach() processed %d files, want %d", len(seen), len(files))
+			}
+			for name, n := range seen {
+				if n != 1 {
+					t.Errorf("forEach() processed %s %d times, want once", name, n)
+				}
+			}
+			if int(maxRunning.Load()) > p.jobs() {
+				t.Errorf("forEach() ran %d calls concurrently, want at most %d", maxRunning.Load(), p.jobs())
+			}
+		})
+	}
+}
+
+// TestForEachError tests that forEach cancels the running calls and skips the remaining files on
+// the first error.
+func TestForEachError(t *testing.T) {
+	files := make([]releaseFile, 20)
+	for i := range files {
+		files[i].name = fmt.Sprintf("file-%d", i)
+	}
+	cfg := testConfig(t.TempDir())
+	cfg.Jobs = 2
+	p := newTestPackager(t, cfg)
+
+	wantErr := errors.New("copy failed")
+	var calls atomic.Int32
+	err := p.forEach(context.Background(), files, func(ctx context.Context, file releaseFile) error {
+		if calls.Add(1) == 1 {
+			return wantErr
+		}
+		// The other job waits for the cancellation of the first error.
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("forEach() error = %v, want %v", err, wantErr)
+	}
+	if n := calls.Load(); n > 3 {
+		t.Errorf("forEach() made %d calls after the first error, want the remaining files skipped", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		t.Errorf("forEach() called fn for %s with a canceled context", file.name)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("forEach() error = %v, want context.Canceled", err)
+	}
+}
+
+// BenchmarkCopyBuildZips measures copying and hashing a release of 14 platform zips of 4 MB with
+// an increasing number of jobs.
+func BenchmarkCopyBuildZips(b *testing.B) {
+	platforms := []string{
+		"darwin_amd64", "darwin_arm64", "freebsd_386", "freebsd_amd64", "freebsd_arm", "freebsd_arm64", "linux_386",
+		"linux_amd64", "linux_arm", "linux_arm64", "windows_386", "windows_amd64", "windows_arm", "windows_arm64",
+	}
+
+	distPath := b.TempDir()
+	padding := make([]byte, 4<<20)
+	shaSumContent := ""
+	for _, platform := range platforms {
+		if _, err := io.ReadFull(rand.Reader, padding); err != nil {
+			b.Fatalf("Failed to setup zip: %v", err)
+		}
+		zipName := "terraform-provider-example_1.0.0_" + platform + ".zip"
+		sum := writeTestZip(b, filepath.Join(distPath, zipName), map[string]string{"terraform-provider-example_v1.0.0": string(padding)})
+		shaSumContent += sum + "  " + zipName + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(distPath, "terraform-provider-example_1.0.0_SHA256SUMS"), []byte(shaSumContent), 0644); err != nil {
+		b.Fatalf("Failed to create SHA256SUMS: %v", err)
+	}
+
+	for _, jobs := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			cfg := testConfig(distPath)
+			cfg.Jobs = jobs
+			p := newTestPackager(b, cfg, WithLogger(log.New(io.Discard, "", 0)))
+			files, err := p.releaseFiles()
+			if err != nil {
+				b.Fatalf("Failed to read SHA256SUMS: %v", err)
+			}
+			destPath := filepath.Join(b.TempDir(), "download")
+
+			b.SetBytes(int64(len(platforms) * len(padding)))
+			for b.Loop() {
+				b.StopTimer()
+				if err := deleteDir(destPath); err != nil {
+					b.Fatalf("Failed to clean up: %v", err)
+				}
+				if err := createDirRecursive(destPath); err != nil {
+					b.Fatalf("Failed to setup destination: %v", err)
+				}
+				b.StartTimer()
+
+				err := p.copyBuildZips(context.Background(), files, destPath)
+				if err != nil {
+					b.Fatalf("copyBuildZips() error = %v", err)
+				}
+				_, err = p.versionHashes(context.Background(), files)
+				if err != nil {
+					b.Fatalf("versionHashes() error = %v", err)
+				}
+			}
+		})
+	}
+}
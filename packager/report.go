@@ -0,0 +1,131 @@
+package packager
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Report describes what a packaging run published.
+type Report struct {
+	// Provider is the <domain>/<namespace>/<type> address of the provider.
+	Provider  string           `json:"provider"`
+	Version   string           `json:"version"`
+	Protocols []string         `json:"protocols"`
+	Platforms []PlatformReport `json:"platforms"`
+	// Warnings are the fallbacks taken during the run, e.g. the default protocol versions
+	// used without a registry manifest.
+	Warnings []string      `json:"warnings"`
+	Skipped  []SkippedFile `json:"skipped"`
+}
+
+// PlatformReport is a published platform, as described by its platform document.
+type PlatformReport struct {
+	Os                  string   `json:"os"`
+	Arch                string   `json:"arch"`
+	Filename            string   `json:"filename"`
+	Shasum              string   `json:"shasum"`
+	DownloadUrl         string   `json:"download_url"`
+	ShasumsUrl          string   `json:"shasums_url"`
+	ShasumsSignatureUrl string   `json:"shasums_signature_url"`
+	SigningKeyIDs       []string `json:"signing_key_ids"`
+}
+
+// SkippedFile is a file of SHA256SUMS that was not published.
+type SkippedFile struct {
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// reporter collects the report of a packaging run. Its methods do nothing on a nil reporter, so
+// the packaging steps can record their outcome whether or not a report is wanted.
+type reporter struct {
+	mu      sync.Mutex
+	report  Report
+	skipped map[string]bool
+}
+
+func newReporter(cfg Config) *reporter {
+	return &reporter{
+		report: Report{
+			Provider:  cfg.Domain + "/" + cfg.Namespace + "/" + cfg.Provider,
+			Version:   cfg.Version,
+			Protocols: []string{},
+			Platforms: []PlatformReport{},
+			Warnings:  []string{},
+			Skipped:   []SkippedFile{},
+		},
+		skipped: map[string]bool{},
+	}
+}
+
+func (r *reporter) protocols(protocols []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Protocols = slices.Clone(protocols)
+}
+
+func (r *reporter) platform(platform PlatformReport) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Platforms = append(r.report.Platforms, platform)
+}
+
+func (r *reporter) warn(warning string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Warnings = append(r.report.Warnings, warning)
+}
+
+// skip records the first reason a file was skipped for, as every packaging step skips it again.
+func (r *reporter) skip(fileName, reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.skipped[fileName] {
+		return
+	}
+	r.skipped[fileName] = true
+	r.report.Skipped = append(r.report.Skipped, SkippedFile{Filename: fileName, Reason: reason})
+}
+
+// result returns the report, with the platforms and skipped files sorted as the steps that
+// record them run concurrently.
+func (r *reporter) result() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	slices.SortFunc(report.Platforms, func(a, b PlatformReport) int {
+		return cmp.Or(cmp.Compare(a.Os, b.Os), cmp.Compare(a.Arch, b.Arch))
+	})
+	slices.SortFunc(report.Skipped, func(a, b SkippedFile) int { return cmp.Compare(a.Filename, b.Filename) })
+
+	return report
+}
+
+// warnf logs a warning and adds it to the report of the run.
+func (p *Packager) warnf(format string, args ...any) {
+	warning := fmt.Sprintf(format, args...)
+	p.logger.Println(warning)
+	p.report.warn(warning)
+}
+
+// skip logs that fileName is not published, e.g. because it "is not a zip file", and adds it to
+// the skipped files of the report.
+func (p *Packager) skip(fileName, reason string) {
+	p.logger.Printf("Filename '%s' is %s, skipping...", fileName, reason)
+	p.report.skip(fileName, reason)
+}
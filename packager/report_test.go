@@ -0,0 +1,71 @@
+package packager
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestPackageReport tests that the report lists the published platforms, the fallbacks taken
+// and the files that were not published.
+func TestPackageReport(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	cfg.ExcludePlatforms = []string{"darwin_*"}
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	shasums := writeTestDist(t, cfg.DistPath, "linux_amd64", "darwin_arm64")
+	writeTestSignature(t, key, filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+	report, err := p.PackageReport(context.Background())
+	if err != nil {
+		t.Fatalf("PackageReport() error = %v", err)
+	}
+
+	if report.Provider != domain+"/example-org/example" || report.Version != "1.0.0" || !slices.Equal(report.Protocols, defaultProtocols) {
+		t.Errorf("PackageReport() = %s %s %v, want %s/example-org/example 1.0.0 %v", report.Provider, report.Version, report.Protocols, domain, defaultProtocols)
+	}
+
+	urlPrefix := "https://" + domain + "/v1/providers/example-org/example/1.0.0/"
+	want := PlatformReport{
+		Os:                  "linux",
+		Arch:                "amd64",
+		Filename:            "terraform-provider-example_1.0.0_linux_amd64.zip",
+		Shasum:              shasums["linux_amd64"],
+		DownloadUrl:         urlPrefix + "download/terraform-provider-example_1.0.0_linux_amd64.zip",
+		ShasumsUrl:          urlPrefix + "terraform-provider-example_1.0.0_SHA256SUMS",
+		ShasumsSignatureUrl: urlPrefix + "terraform-provider-example_1.0.0_SHA256SUMS.sig",
+		SigningKeyIDs:       []string{key.PrimaryKey.KeyIdString()},
+	}
+	if !reflect.DeepEqual(report.Platforms, []PlatformReport{want}) {
+		t.Errorf("PackageReport() platforms = %+v, want %+v", report.Platforms, want)
+	}
+
+	wantSkipped := []SkippedFile{
+		{Filename: "terraform-provider-example_1.0.0_darwin_arm64.zip", Reason: "filtered out by the platform filters"},
+		{Filename: "terraform-provider-example_1.0.0_manifest.json", Reason: "not in the expected format"},
+	}
+	if !slices.Equal(report.Skipped, wantSkipped) {
+		t.Errorf("PackageReport() skipped = %+v, want %+v", report.Skipped, wantSkipped)
+	}
+
+	for _, want := range []string{"Versions file not found", "No registry manifest"} {
+		if !slices.ContainsFunc(report.Warnings, func(warning string) bool { return strings.HasPrefix(warning, want) }) {
+			t.Errorf("PackageReport() warnings = %q, want %q", report.Warnings, want)
+		}
+	}
+}
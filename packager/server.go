@@ -0,0 +1,440 @@
+package packager
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerConfig describes the release tree served by Server.
+type ServerConfig struct {
+	// Root is the release tree written by Package and ModulePackager.Package.
+	Root string
+	// Domain is the registry domain the tree was packaged for. URLs of that domain in the served
+	// documents are rewritten to the host the request was made to, so that a tree packaged for
+	// the production domain can be tested locally. No URL is rewritten when empty.
+	Domain string
+	// Tokens restricts the registry to the bearer tokens of the ACL, each to its namespaces. The
+	// well-known file stays public. The download URLs of the documents served to an authorized
+	// client are signed, as Terraform does not send credentials with downloads. Everything is
+	// public when nil.
+	Tokens TokenACL
+	// Login advertises and implements a login.v1 service, so that "terraform login" can store a
+	// token of Tokens in the CLI credentials. It requires Tokens.
+	Login bool
+}
+
+// Server serves a release tree over the provider and module registry protocols. Unlike a static
+// file host, it answers module downloads with the X-Terraform-Get header, and it serves
+// DefaultWellKnown when the tree has no service discovery document.
+type Server struct {
+	cfg    ServerConfig
+	files  http.Handler
+	logger *log.Logger
+
+	// secret signs download URLs.
+	secret []byte
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+// filesOnly is an http.FileSystem that hides directories without an index.html, so that the file
+// server answers 404 instead of listing the namespaces and versions of the tree.
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() && !f.hasIndex(name) {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return file, nil
+}
+
+func (f filesOnly) hasIndex(dir string) bool {
+	index, err := f.fs.Open(path.Join(dir, "index.html"))
+	if err != nil {
+		return false
+	}
+	defer index.Close()
+
+	info, err := index.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// NewServer returns a Server for cfg. Root defaults to "release". Of the options, only WithLogger
+// applies.
+func NewServer(cfg ServerConfig, opts ...Option) (*Server, error) {
+	if cfg.Root == "" {
+		cfg.Root = "release"
+	}
+	if cfg.Login && cfg.Tokens == nil {
+		return nil, &ConfigError{Field: "Login", Reason: "requires Tokens"}
+	}
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Packager{logger: log.Default()}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return &Server{
+		cfg:    cfg,
+		files:  http.FileServer(filesOnly{http.Dir(cfg.Root)}),
+		logger: p.logger,
+		secret: secret,
+		codes:  map[string]authCode{},
+	}, nil
+}
+
+// ServeHTTP serves the registry documents of the tree, decoded and re-encoded so that only valid
+// documents are served, and every other file as is.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlPath := path.Clean("/" + r.URL.Path)
+
+	if s.cfg.Login {
+		switch urlPath {
+		case loginAuthzPath:
+			s.serveAuthorization(w, r)
+			return
+		case loginTokenPath:
+			s.serveToken(w, r)
+			return
+		}
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	wellKnownData := DefaultWellKnown
+	_, err := readJSONFile(s.filePath("/.well-known/terraform.json"), &wellKnownData)
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+	if s.cfg.Login {
+		wellKnownData.LoginV1 = &loginService
+	}
+
+	providerParts, isProvider := servicePath(urlPath, wellKnownData.ProvidersV1)
+	moduleParts, isModule := servicePath(urlPath, wellKnownData.ModulesV1)
+
+	switch {
+	case urlPath == "/.well-known/terraform.json":
+		s.writeJSON(w, wellKnownData)
+	case (isProvider && providerParts[0] == "") || (isModule && moduleParts[0] == ""):
+		// Every path of a service is in a namespace, the ACL cannot allow a path without one.
+		http.NotFound(w, r)
+	case isProvider:
+		if s.authorize(w, r, urlPath, providerParts[0]) {
+			s.serveProvider(w, r, urlPath, providerParts)
+		}
+	case isModule:
+		if s.authorize(w, r, urlPath, moduleParts[0]) {
+			s.serveModule(w, r, urlPath, moduleParts)
+		}
+	default:
+		if s.authorize(w, r, urlPath, "") {
+			s.files.ServeHTTP(w, r)
+		}
+	}
+}
+
+// servicePath returns the path segments of urlPath below the service path root, and whether
+// urlPath is root or below it. The first segment is empty for root itself.
+func servicePath(urlPath, root string) ([]string, bool) {
+	if root == "" {
+		return nil, false
+	}
+	if urlPath == strings.TrimSuffix(root, "/") {
+		return []string{""}, true
+	}
+	if !strings.HasPrefix(urlPath, root) {
+		return nil, false
+	}
+
+	return strings.Split(strings.TrimPrefix(urlPath, root), "/"), true
+}
+
+// authorize reports whether the request may read urlPath, in namespace when not empty, and
+// answers it otherwise. Requests need a bearer token of the ACL that gives access to namespace,
+// or a download URL signature for urlPath.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, urlPath, namespace string) bool {
+	if s.cfg.Tokens == nil || r.Context().Value(trustedRequest{}) != nil {
+		return true
+	}
+
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token != "" && s.cfg.Tokens.allows(token, namespace) {
+		return true
+	}
+
+	sig := r.URL.Query().Get(downloadSignatureParam)
+	if sig != "" && verifyPathSignature(s.secret, urlPath, sig, time.Now()) {
+		return true
+	}
+
+	if _, known := s.cfg.Tokens.namespaces(token); token != "" && known {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer realm="tfpp"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
+
+// serveProvider serves the versions file and platform documents of a provider, parts being the
+// path below the providers.v1 service.
+func (s *Server) serveProvider(w http.ResponseWriter, r *http.Request, urlPath string, parts []string) {
+	switch {
+	case len(parts) == 3 && parts[2] == "versions":
+		var versions Versions
+		if s.readDocument(w, r, urlPath, &versions) {
+			s.writeJSON(w, versions)
+		}
+	case len(parts) == 6 && parts[3] == "download":
+		var architecture Architecture
+		if s.readDocument(w, r, urlPath, &architecture) {
+			architecture.DownloadUrl = s.downloadURL(r, architecture.DownloadUrl)
+			architecture.ShasumsUrl = s.downloadURL(r, architecture.ShasumsUrl)
+			architecture.ShasumsSignatureUrl = s.downloadURL(r, architecture.ShasumsSignatureUrl)
+			s.writeJSON(w, architecture)
+		}
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+// serveModule serves the versions file of a module and answers its download requests with the
+// X-Terraform-Get header, parts being the path below the modules.v1 service.
+func (s *Server) serveModule(w http.ResponseWriter, r *http.Request, urlPath string, parts []string) {
+	switch {
+	case len(parts) == 4 && parts[3] == "versions":
+		var versions ModuleVersions
+		if s.readDocument(w, r, urlPath, &versions) {
+			s.writeJSON(w, versions)
+		}
+	case len(parts) == 5 && parts[4] == "download":
+		var download ModuleDownload
+		if s.readDocument(w, r, urlPath, &download) {
+			w.Header().Set("X-Terraform-Get", s.downloadURL(r, download.Location))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		s.files.ServeHTTP(w, r)
+	}
+}
+
+// readDocument decodes the file of urlPath into v. It answers the request and returns false when
+// the file is missing or invalid.
+func (s *Server) readDocument(w http.ResponseWriter, r *http.Request, urlPath string, v any) bool {
+	ok, err := readJSONFile(s.filePath(urlPath), v)
+	if err != nil {
+		s.serverError(w, err)
+		return false
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return false
+	}
+
+	return true
+}
+
+// filePath returns the file of the tree for a cleaned URL path.
+func (s *Server) filePath(urlPath string) string {
+	return filepath.Join(s.cfg.Root, filepath.FromSlash(urlPath))
+}
+
+// downloadURL replaces the https://<Domain> prefix of u with the scheme and host of r and, when
+// tokens are required, signs the URLs the Server serves.
+func (s *Server) downloadURL(r *http.Request, u string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host + "/"
+
+	if s.cfg.Domain != "" {
+		if rest, ok := strings.CutPrefix(u, "https://"+s.cfg.Domain+"/"); ok {
+			u = base + rest
+		}
+	}
+
+	if s.cfg.Tokens == nil || !strings.HasPrefix(u, base) {
+		return u
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	query := parsed.Query()
+	query.Set(downloadSignatureParam, signPath(s.secret, path.Clean("/"+parsed.Path), time.Now().Add(downloadSignatureTTL)))
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		s.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (s *Server) serverError(w http.ResponseWriter, err error) {
+	s.logger.Printf("Serving release tree: %v", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// Transport returns a RoundTripper that answers every request from the served tree, whatever its
+// host, without a network round trip. With WithHTTPClient, it lets a Packager merge a new version
+// into the tree the Server is serving.
+func (s *Server) Transport() http.RoundTripper {
+	return serverTransport{s}
+}
+
+type serverTransport struct {
+	server *Server
+}
+
+// trustedRequest marks the requests of serverTransport in their context, which are not subject
+// to ServerConfig.Tokens.
+type trustedRequest struct{}
+
+func (t serverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.WithContext(context.WithValue(req.Context(), trustedRequest{}, true))
+	rec := &responseRecorder{header: http.Header{}}
+	t.server.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.status, http.StatusText(rec.status)),
+		StatusCode:    rec.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        rec.header,
+		Body:          io.NopCloser(&rec.body),
+		ContentLength: int64(rec.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// responseRecorder buffers the response of a Server for serverTransport.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(data)
+}
+
+// SelfSignedCertificate returns a certificate for hosts, host names or IP addresses, valid for a
+// year, along with its PEM encoding for clients to trust, e.g. with SSL_CERT_FILE.
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"tfpp"}, CommonName: "tfpp serve"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.IPAddresses) == 0 && len(template.DNSNames) == 0 {
+		return tls.Certificate{}, nil, errors.New("no host for the certificate")
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return cert, certPEM, nil
+}
@@ -0,0 +1,336 @@
+package packager
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestTree writes files, keyed by path relative to root.
+func writeTestTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatalf("Failed to setup release: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to setup release: %v", err)
+		}
+	}
+}
+
+// newTestServer returns a Server for cfg and fails the test on configuration errors.
+func newTestServer(t *testing.T, cfg ServerConfig) *Server {
+	t.Helper()
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	return server
+}
+
+// TestServer tests the responses of Server for a release tree.
+func TestServer(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"v1/providers/example-org/example/versions":                   `{"versions": [{"version": "1.0.0", "protocols": ["5.0"], "platforms": [{"os": "linux", "arch": "amd64"}]}]}`,
+		"v1/providers/example-org/example/1.0.0/download/linux/amd64": `{"os": "linux", "arch": "amd64", "download_url": "https://registry.example.com/v1/providers/example-org/example/1.0.0/download/example.zip", "shasums_url": "https://other.example.com/SHA256SUMS"}`,
+		"v1/providers/example-org/example/1.0.0/download/example.zip": "zip",
+		"v1/providers/example-org/broken/versions":                    "{",
+		"v1/modules/example-org/network/aws/versions":                 `{"modules": [{"versions": [{"version": "1.0.0"}]}]}`,
+		"v1/modules/example-org/network/aws/1.0.0/download":           `{"location": "https://registry.example.com/v1/modules/example-org/network/aws/1.0.0/network-aws-1.0.0.tar.gz"}`,
+	})
+
+	server := newTestServer(t, ServerConfig{Root: root, Domain: "registry.example.com"})
+	ts := httptest.NewTLSServer(server)
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantHeader string
+	}{
+		{
+			name:       "default well-known",
+			path:       "/.well-known/terraform.json",
+			wantStatus: http.StatusOK,
+			wantBody:   `"modules.v1": "/v1/modules/"`,
+		},
+		{
+			name:       "provider versions",
+			path:       "/v1/providers/example-org/example/versions",
+			wantStatus: http.StatusOK,
+			wantBody:   `"version": "1.0.0"`,
+		},
+		{
+			name:       "platform document with rewritten download URL",
+			path:       "/v1/providers/example-org/example/1.0.0/download/linux/amd64",
+			wantStatus: http.StatusOK,
+			wantBody:   `"download_url": "` + ts.URL + `/v1/providers/example-org/example/1.0.0/download/example.zip"`,
+		},
+		{
+			name:       "platform document keeps other hosts",
+			path:       "/v1/providers/example-org/example/1.0.0/download/linux/amd64",
+			wantStatus: http.StatusOK,
+			wantBody:   `"shasums_url": "https://other.example.com/SHA256SUMS"`,
+		},
+		{
+			name:       "provider zip",
+			path:       "/v1/providers/example-org/example/1.0.0/download/example.zip",
+			wantStatus: http.StatusOK,
+			wantBody:   "zip",
+		},
+		{
+			name:       "unknown provider",
+			path:       "/v1/providers/example-org/missing/versions",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "invalid versions file",
+			path:       "/v1/providers/example-org/broken/versions",
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "module versions",
+			path:       "/v1/modules/example-org/network/aws/versions",
+			wantStatus: http.StatusOK,
+			wantBody:   `"version": "1.0.0"`,
+		},
+		{
+			name:       "module download",
+			path:       "/v1/modules/example-org/network/aws/1.0.0/download",
+			wantStatus: http.StatusNoContent,
+			wantHeader: ts.URL + "/v1/modules/example-org/network/aws/1.0.0/network-aws-1.0.0.tar.gz",
+		},
+		{
+			name:       "path outside the tree",
+			path:       "/../../etc/passwd",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			path:       "/v1/providers/example-org/example/versions",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatalf("%s %s error = %v", method, tt.path, err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("Failed to read response: %v", err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+			if got := resp.Header.Get("X-Terraform-Get"); got != tt.wantHeader {
+				t.Errorf("X-Terraform-Get = %q, want %q", got, tt.wantHeader)
+			}
+		})
+	}
+}
+
+// TestServerTransport tests packaging a provider into the tree a Server requiring tokens is
+// serving, and installing it from the Server the way Terraform does: with the token for the
+// documents and without it for the signed downloads.
+func TestServerTransport(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestDist(t, "dist", "linux_amd64")
+	writeTestSignature(t, key, filepath.Join("dist", "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+	cfg := testConfig("dist")
+	cfg.GPGFingerprint = ""
+	cfg.Incremental = true
+
+	server := newTestServer(t, ServerConfig{Root: "release", Domain: cfg.Domain, Tokens: TokenACL{"secret": {"example-org"}}})
+	p := newTestPackager(t, cfg, WithHTTPClient(&http.Client{Transport: server.Transport()}), WithAllowNew(true))
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	ts := httptest.NewTLSServer(server)
+	t.Cleanup(ts.Close)
+
+	var architecture Architecture
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/providers/example-org/example/1.0.0/download/linux/amd64", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get platform document: %v", err)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&architecture)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode platform document: %v", err)
+	}
+
+	for _, url := range []string{architecture.DownloadUrl, architecture.ShasumsUrl, architecture.ShasumsSignatureUrl} {
+		if !strings.HasPrefix(url, ts.URL+"/") {
+			t.Errorf("URL %s is not served by %s", url, ts.URL)
+			continue
+		}
+		resp, err := ts.Client().Get(url)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want 200", url, resp.StatusCode)
+		}
+	}
+}
+
+// TestSelfSignedCertificate tests that a client trusting the returned PEM accepts the certificate.
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, certPEM, err := SelfSignedCertificate("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("SelfSignedCertificate() error = %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(newTestServer(t, ServerConfig{Root: t.TempDir()}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(certPEM) {
+		t.Fatal("SelfSignedCertificate() returned an invalid PEM")
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	resp, err := client.Get(strings.Replace(ts.URL, "127.0.0.1", "localhost", 1) + "/.well-known/terraform.json")
+	if err != nil {
+		t.Fatalf("GET well-known error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if _, _, err := SelfSignedCertificate(); err == nil {
+		t.Error("SelfSignedCertificate() without hosts error = nil, want error")
+	}
+}
+
+// TestServerTokens tests the access control of a Server with a TokenACL.
+func TestServerTokens(t *testing.T) {
+	root := t.TempDir()
+	writeTestTree(t, root, map[string]string{
+		"v1/providers/example-org/example/versions":                   `{"versions": []}`,
+		"v1/providers/example-org/example/1.0.0/download/example.zip": "zip",
+		"v1/providers/partner-org/partner/versions":                   `{"versions": []}`,
+		"index.html": "index",
+	})
+
+	server := newTestServer(t, ServerConfig{Root: root, Tokens: TokenACL{
+		"team-token":  {"example-org"},
+		"admin-token": {AllNamespaces},
+	}})
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	zipPath := "/v1/providers/example-org/example/1.0.0/download/example.zip"
+	validSig := signPath(server.secret, zipPath, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{"public well-known", "/.well-known/terraform.json", "", http.StatusOK},
+		{"missing token", "/v1/providers/example-org/example/versions", "", http.StatusUnauthorized},
+		{"unknown token", "/v1/providers/example-org/example/versions", "guess", http.StatusUnauthorized},
+		{"allowed namespace", "/v1/providers/example-org/example/versions", "team-token", http.StatusOK},
+		{"other namespace", "/v1/providers/partner-org/partner/versions", "team-token", http.StatusForbidden},
+		{"all namespaces", "/v1/providers/partner-org/partner/versions", "admin-token", http.StatusOK},
+		{"file outside namespaces", "/index.html", "team-token", http.StatusOK},
+		{"file outside namespaces without token", "/index.html", "", http.StatusUnauthorized},
+		{"providers root", "/v1/providers/", "team-token", http.StatusNotFound},
+		{"providers root without slash", "/v1/providers", "team-token", http.StatusNotFound},
+		{"modules root", "/v1/modules/", "team-token", http.StatusNotFound},
+		{"directory in namespace", "/v1/providers/example-org/example/", "team-token", http.StatusNotFound},
+		{"directory outside namespaces", "/v1/", "team-token", http.StatusNotFound},
+		{"directory with an index", "/", "team-token", http.StatusOK},
+		{"signed download", zipPath + "?" + downloadSignatureParam + "=" + validSig, "", http.StatusOK},
+		{"signature of another path", "/v1/providers/partner-org/partner/versions?" + downloadSignatureParam + "=" + validSig, "", http.StatusUnauthorized},
+		{"tampered signature", zipPath + "?" + downloadSignatureParam + "=" + validSig[:len(validSig)-2] + "00", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+tt.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("GET %s error = %v", tt.path, err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 response without WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+// TestNewServerLoginRequiresTokens tests that the login service cannot be enabled without tokens.
+func TestNewServerLoginRequiresTokens(t *testing.T) {
+	_, err := NewServer(ServerConfig{Login: true})
+
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || cfgErr.Field != "Login" {
+		t.Errorf("NewServer() error = %v, want ConfigError for Login", err)
+	}
+}
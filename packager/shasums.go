@@ -0,0 +1,245 @@
+package packager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// shaSumEntry is a line of a SHA256SUMS file.
+type shaSumEntry struct {
+	// sum is the lowercase hex encoded SHA256 of the file.
+	sum  string
+	name string
+	line int
+}
+
+// parseShaSums strictly parses a SHA256SUMS file: every line that is not blank must be
+// "<sha256> <name>", with the " " or "*" mode marker of sha256sum before the name, and every
+// name must be a bare file name starting with prefix. CRLF line endings are accepted. Errors are
+// *ShaSumsError with the line number of the first invalid line.
+func parseShaSums(data []byte, prefix string) ([]shaSumEntry, error) {
+	var entries []shaSumEntry
+	names := map[string]int{}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		lineNumber := i + 1
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lineError := func(format string, args ...any) error {
+			return &ShaSumsError{Line: lineNumber, Err: fmt.Errorf(format, args...)}
+		}
+
+		sum, rest, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, lineError("want \"<sha256>  <file name>\"")
+		}
+		decoded, err := hex.DecodeString(sum)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, lineError("invalid SHA256 %q", sum)
+		}
+		name := rest
+		if strings.HasPrefix(name, " ") || strings.HasPrefix(name, "*") {
+			name = name[1:]
+		}
+
+		err = validateShaSumName(name, prefix)
+		if err != nil {
+			return nil, lineError("%w", err)
+		}
+		if previous, ok := names[name]; ok {
+			return nil, lineError("%s is already listed on line %d", name, previous)
+		}
+		names[name] = lineNumber
+
+		entries = append(entries, shaSumEntry{sum: strings.ToLower(sum), name: name, line: lineNumber})
+	}
+
+	return entries, nil
+}
+
+// validateShaSumName checks that name is a bare file name of the dist directory starting with
+// prefix, so that it cannot point outside of the directories it is joined to.
+func validateShaSumName(name, prefix string) error {
+	switch {
+	case name == "":
+		return errors.New("missing file name")
+	case strings.ContainsAny(name, "/\\") || name == "." || name == ".." || !filepath.IsLocal(name):
+		return fmt.Errorf("file name %q is not a bare file name", name)
+	case strings.TrimSpace(name) != name || strings.ContainsFunc(name, unicode.IsControl):
+		return fmt.Errorf("file name %q contains whitespace or control characters", name)
+	case !strings.HasPrefix(name, prefix):
+		return fmt.Errorf("file name %q does not start with %s", name, prefix)
+	}
+
+	return nil
+}
+
+// shaSums returns the entries of the <repo>_<version>_SHA256SUMS file in the dist directory.
+func (p *Packager) shaSums() ([]shaSumEntry, error) {
+	data, err := p.readFile(p.shaSumPath())
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseShaSums(data, p.cfg.RepoName+"_"+p.cfg.Version+"_")
+	var shaSumsErr *ShaSumsError
+	if errors.As(err, &shaSumsErr) {
+		shaSumsErr.Path = p.shaSumPath()
+	}
+
+	return entries, err
+}
+
+// checkShaSums fails when a <repo>_<version>_*.zip of the dist directory is not one of files, the
+// entries of SHA256SUMS, or a zip listed in SHA256SUMS is missing from the dist directory, so that the
+// published checksums cover exactly the published zips.
+func (p *Packager) checkShaSums(files []releaseFile) error {
+	dirEntries, err := os.ReadDir(p.cfg.DistPath)
+	if err != nil {
+		return err
+	}
+
+	prefix := p.cfg.RepoName + "_" + p.cfg.Version + "_"
+	listed := map[string]bool{}
+	for _, file := range files {
+		listed[file.name] = true
+	}
+
+	var unlisted []string
+	present := map[string]bool{}
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if !dirEntry.Type().IsRegular() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".zip") {
+			continue
+		}
+		present[name] = true
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+
+	var missing []string
+	for _, file := range files {
+		if strings.HasSuffix(file.name, ".zip") && !present[file.name] {
+			missing = append(missing, file.name)
+		}
+	}
+
+	switch {
+	case len(unlisted) > 0:
+		return fmt.Errorf("%s not listed in %s", strings.Join(unlisted, ", "), p.shaSumPath())
+	case len(missing) > 0:
+		return fmt.Errorf("%s listed in %s missing from '%s' dir", strings.Join(missing, ", "), p.shaSumPath(), p.cfg.DistPath)
+	}
+
+	return nil
+}
+
+// verifyShaSum returns a *ChecksumError unless sum, the SHA256 computed for the file at path, is
+// the one of its SHA256SUMS entry.
+func verifyShaSum(entry shaSumEntry, path, sum string) error {
+	if sum != entry.sum {
+		return &ChecksumError{Path: path, Want: entry.sum, Got: sum}
+	}
+
+	return nil
+}
+
+// verifyZips hashes the zips of files that are published, Config.Jobs at a time, and returns a
+// *ChecksumError for the first one that doesn't match its SHA256SUMS entry.
+func (p *Packager) verifyZips(ctx context.Context, files []releaseFile) error {
+	return p.forEach(ctx, files, func(ctx context.Context, file releaseFile) error {
+		if !strings.HasSuffix(file.name, ".zip") || file.platformZip && len(file.platforms) == 0 {
+			return nil
+		}
+
+		zipPath := filepath.Join(p.cfg.DistPath, file.name)
+		sum, err := fileSHA256(zipPath)
+		if err != nil {
+			return err
+		}
+
+		return verifyShaSum(file.shaSumEntry, zipPath, sum)
+	})
+}
+
+// shaSumPath returns the path of the <repo>_<version>_SHA256SUMS file in the dist directory.
+func (p *Packager) shaSumPath() string {
+	return filepath.Join(p.cfg.DistPath, p.cfg.RepoName+"_"+p.cfg.Version+"_SHA256SUMS")
+}
+
+// writeShaSums generates the SHA256SUMS file in the dist directory when it only contains the
+// zips, in the format GoReleaser uses: the zips and registry manifest of the version, sorted by
+// name. An existing file is left untouched.
+func (p *Packager) writeShaSums() error {
+	shaSumPath := p.shaSumPath()
+
+	_, err := os.Stat(shaSumPath)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	p.logger.Printf("* Generating %s", shaSumPath)
+
+	entries, err := os.ReadDir(p.cfg.DistPath)
+	if err != nil {
+		return err
+	}
+
+	prefix := p.cfg.RepoName + "_" + p.cfg.Version + "_"
+
+	var contents bytes.Buffer
+	zips := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ".zip") {
+			zips++
+		} else if name != prefix+"manifest.json" {
+			continue
+		}
+
+		sum, err := fileSHA256(filepath.Join(p.cfg.DistPath, name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&contents, "%s  %s\n", sum, name)
+	}
+
+	if zips == 0 {
+		return fmt.Errorf("no SHA256SUMS and no %s*.zip files in '%s' dir", prefix, p.cfg.DistPath)
+	}
+
+	return p.writeFile(shaSumPath, contents.Bytes())
+}
+
+// fileSHA256 returns the hex encoded SHA256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
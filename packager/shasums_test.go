@@ -0,0 +1,366 @@
+package packager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestParseShaSums tests the parseShaSums function.
+func TestParseShaSums(t *testing.T) {
+	prefix := "terraform-provider-example_1.0.0_"
+	sumA := strings.Repeat("a", 64)
+	sumB := strings.Repeat("0b", 32)
+
+	tests := []struct {
+		name     string
+		content  string
+		want     []shaSumEntry
+		wantLine int
+		wantErr  string
+	}{
+		{
+			name: "parse valid SHA256SUMS",
+			content: sumA + "  terraform-provider-example_1.0.0_linux_amd64.zip\n" +
+				sumB + "  terraform-provider-example_1.0.0_darwin_amd64.zip\n",
+			want: []shaSumEntry{
+				{sum: sumA, name: "terraform-provider-example_1.0.0_linux_amd64.zip", line: 1},
+				{sum: sumB, name: "terraform-provider-example_1.0.0_darwin_amd64.zip", line: 2},
+			},
+		},
+		{
+			name:    "binary mode, uppercase, CRLF and blank lines",
+			content: "\r\n" + strings.ToUpper(sumA) + " *terraform-provider-example_1.0.0_linux_amd64.zip\r\n\n",
+			want: []shaSumEntry{
+				{sum: sumA, name: "terraform-provider-example_1.0.0_linux_amd64.zip", line: 2},
+			},
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+		{
+			name:     "missing file name",
+			content:  sumA + "\n",
+			wantLine: 1,
+			wantErr:  "want \"<sha256>  <file name>\"",
+		},
+		{
+			name:     "short sum",
+			content:  sumA + "  terraform-provider-example_1.0.0_linux_amd64.zip\nabc123  terraform-provider-example_1.0.0_darwin_amd64.zip\n",
+			wantLine: 2,
+			wantErr:  "invalid SHA256 \"abc123\"",
+		},
+		{
+			name:     "non hex sum",
+			content:  strings.Repeat("z", 64) + "  terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			wantLine: 1,
+			wantErr:  "invalid SHA256",
+		},
+		{
+			name:     "path traversal",
+			content:  sumA + "  ../terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			wantLine: 1,
+			wantErr:  "is not a bare file name",
+		},
+		{
+			name:     "absolute path",
+			content:  sumA + "  /etc/terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			wantLine: 1,
+			wantErr:  "is not a bare file name",
+		},
+		{
+			name:     "windows path",
+			content:  sumA + "  dist\\terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			wantLine: 1,
+			wantErr:  "is not a bare file name",
+		},
+		{
+			name:     "trailing whitespace",
+			content:  sumA + "  terraform-provider-example_1.0.0_linux_amd64.zip \n",
+			wantLine: 1,
+			wantErr:  "contains whitespace or control characters",
+		},
+		{
+			name:     "other version",
+			content:  sumA + "  terraform-provider-example_0.9.0_linux_amd64.zip\n",
+			wantLine: 1,
+			wantErr:  "does not start with terraform-provider-example_1.0.0_",
+		},
+		{
+			name: "duplicate",
+			content: sumA + "  terraform-provider-example_1.0.0_linux_amd64.zip\n" +
+				sumB + "  terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			wantLine: 2,
+			wantErr:  "is already listed on line 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShaSums([]byte(tt.content), prefix)
+			if tt.wantErr != "" {
+				var shaSumsErr *ShaSumsError
+				if !errors.As(err, &shaSumsErr) || shaSumsErr.Line != tt.wantLine || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseShaSums() error = %v, want *ShaSumsError on line %d containing %q", err, tt.wantLine, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseShaSums() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseShaSums() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzParseShaSums tests that parseShaSums does not panic and only returns valid entries, which
+// parse back to themselves once written out.
+func FuzzParseShaSums(f *testing.F) {
+	prefix := "terraform-provider-example_1.0.0_"
+	f.Add([]byte(strings.Repeat("a", 64) + "  terraform-provider-example_1.0.0_linux_amd64.zip\n"))
+	f.Add([]byte(strings.Repeat("A", 64) + " *terraform-provider-example_1.0.0_darwin_all.zip\r\n\n"))
+	f.Add([]byte(strings.Repeat("a", 64) + "  ../terraform-provider-example_1.0.0_linux_amd64.zip\n"))
+	f.Add([]byte("abc123  terraform-provider-example_1.0.0_linux_amd64.zip"))
+	f.Add([]byte(" \n*\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		entries, err := parseShaSums(data, prefix)
+		if err != nil {
+			return
+		}
+
+		var buf strings.Builder
+		for _, entry := range entries {
+			if len(entry.sum) != 64 || strings.ToLower(entry.sum) != entry.sum {
+				t.Errorf("parseShaSums() sum = %q, want a lowercase SHA256", entry.sum)
+			}
+			if !strings.HasPrefix(entry.name, prefix) || !filepath.IsLocal(entry.name) || strings.ContainsAny(entry.name, "/\\") {
+				t.Errorf("parseShaSums() name = %q, want a bare file name starting with %s", entry.name, prefix)
+			}
+			buf.WriteString(entry.sum + "  " + entry.name + "\n")
+		}
+
+		again, err := parseShaSums([]byte(buf.String()), prefix)
+		if err != nil {
+			t.Fatalf("parseShaSums() of its own entries error = %v", err)
+		}
+		if len(again) != len(entries) {
+			t.Fatalf("parseShaSums() of its own entries returned %d entries, want %d", len(again), len(entries))
+		}
+		for i := range again {
+			if again[i].sum != entries[i].sum || again[i].name != entries[i].name {
+				t.Errorf("parseShaSums() of its own entries = %v, want %v", again[i], entries[i])
+			}
+		}
+	})
+}
+
+// TestShaSumsError tests that the SHA256SUMS of the dist directory is reported with its path.
+func TestShaSumsError(t *testing.T) {
+	distPath := t.TempDir()
+	writeTestTree(t, distPath, map[string]string{"terraform-provider-example_1.0.0_SHA256SUMS": "abc123  terraform-provider-example_1.0.0_linux_amd64.zip\n"})
+	p := newTestPackager(t, testConfig(distPath))
+
+	_, err := p.shaSums()
+	want := filepath.Join(distPath, "terraform-provider-example_1.0.0_SHA256SUMS") + ":1: invalid SHA256 \"abc123\""
+	if err == nil || err.Error() != want {
+		t.Errorf("shaSums() error = %v, want %s", err, want)
+	}
+
+	os.Remove(filepath.Join(distPath, "terraform-provider-example_1.0.0_SHA256SUMS"))
+	_, err = p.shaSums()
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("shaSums() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+// TestCheckShaSums tests that the zips of the dist directory must be the ones listed in SHA256SUMS.
+func TestCheckShaSums(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(t *testing.T, distPath string)
+		wantErr string
+	}{
+		{
+			name:   "listed zips",
+			mutate: func(t *testing.T, distPath string) {},
+		},
+		{
+			name: "zips of other versions",
+			mutate: func(t *testing.T, distPath string) {
+				writeTestTree(t, distPath, map[string]string{"terraform-provider-example_0.9.0_linux_amd64.zip": "old version"})
+			},
+		},
+		{
+			name: "unlisted zip",
+			mutate: func(t *testing.T, distPath string) {
+				writeTestTree(t, distPath, map[string]string{"terraform-provider-example_1.0.0_windows_amd64.zip": "windows"})
+			},
+			wantErr: "terraform-provider-example_1.0.0_windows_amd64.zip not listed in",
+		},
+		{
+			name: "missing zip",
+			mutate: func(t *testing.T, distPath string) {
+				if err := os.Remove(filepath.Join(distPath, "terraform-provider-example_1.0.0_darwin_arm64.zip")); err != nil {
+					t.Fatalf("Failed to setup dist: %v", err)
+				}
+			},
+			wantErr: "terraform-provider-example_1.0.0_darwin_arm64.zip listed in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distPath := t.TempDir()
+			writeTestDist(t, distPath, "linux_amd64", "darwin_arm64")
+			tt.mutate(t, distPath)
+			p := newTestPackager(t, testConfig(distPath))
+
+			err := p.checkShaSums(testReleaseFiles(t, p))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkShaSums() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkShaSums() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestChecksumMismatch tests that every command publishing or hashing zips fails when a zip does
+// not match its SHA256SUMS entry.
+func TestChecksumMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(p *Packager) error
+	}{
+		{
+			name: "hashes",
+			run: func(p *Packager) error {
+				_, err := p.Hashes(context.Background())
+				return err
+			},
+		},
+		{
+			name: "network mirror",
+			run:  func(p *Packager) error { return p.PackageNetworkMirror(context.Background()) },
+		},
+		{
+			name: "packed filesystem mirror",
+			run:  func(p *Packager) error { return p.PackageFilesystemMirror(context.Background()) },
+		},
+		{
+			name: "unpacked filesystem mirror",
+			run: func(p *Packager) error {
+				p.cfg.FilesystemMirrorLayout = LayoutUnpacked
+				return p.PackageFilesystemMirror(context.Background())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			distPath := filepath.Join(tmpDir, "dist")
+			shasums := writeTestDist(t, distPath, "linux_amd64")
+			zipPath := filepath.Join(distPath, "terraform-provider-example_1.0.0_linux_amd64.zip")
+			writeTestZip(t, zipPath, map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "linux_amd64") + "tampered"})
+
+			cfg := testConfig(distPath)
+			cfg.NetworkMirrorDir = filepath.Join(tmpDir, "network-mirror")
+			cfg.FilesystemMirrorDir = filepath.Join(tmpDir, "fs-mirror")
+			p := newTestPackager(t, cfg)
+
+			err := tt.run(p)
+			var checksumErr *ChecksumError
+			if !errors.As(err, &checksumErr) || checksumErr.Path != zipPath || checksumErr.Want != shasums["linux_amd64"] {
+				t.Errorf("error = %v, want *ChecksumError for %s", err, zipPath)
+			}
+		})
+	}
+}
+
+// TestWriteShaSums tests the writeShaSums method.
+func TestWriteShaSums(t *testing.T) {
+	sum := func(content string) string {
+		h := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(h[:])
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "generate from zips and manifest",
+			files: map[string]string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip":  "linux",
+				"terraform-provider-example_1.0.0_darwin_arm64.zip": "darwin",
+				"terraform-provider-example_1.0.0_manifest.json":    "{}",
+				"terraform-provider-example_0.9.0_linux_amd64.zip":  "old version",
+				"terraform-provider-other_1.0.0_linux_amd64.zip":    "other provider",
+				"metadata.json": "{}",
+			},
+			want: sum("darwin") + "  terraform-provider-example_1.0.0_darwin_arm64.zip\n" +
+				sum("linux") + "  terraform-provider-example_1.0.0_linux_amd64.zip\n" +
+				sum("{}") + "  terraform-provider-example_1.0.0_manifest.json\n",
+		},
+		{
+			name: "keep existing SHA256SUMS",
+			files: map[string]string{
+				"terraform-provider-example_1.0.0_linux_amd64.zip": "linux",
+				"terraform-provider-example_1.0.0_SHA256SUMS":      "abc123  terraform-provider-example_1.0.0_linux_amd64.zip\n",
+			},
+			want: "abc123  terraform-provider-example_1.0.0_linux_amd64.zip\n",
+		},
+		{
+			name: "no zips",
+			files: map[string]string{
+				"terraform-provider-example_1.0.0_manifest.json": "{}",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to setup %s: %v", name, err)
+				}
+			}
+			p := newTestPackager(t, testConfig(tmpDir))
+
+			err := p.writeShaSums()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("writeShaSums() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := os.ReadFile(filepath.Join(tmpDir, "terraform-provider-example_1.0.0_SHA256SUMS"))
+			if err != nil {
+				t.Fatalf("Failed to read SHA256SUMS: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("SHA256SUMS = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
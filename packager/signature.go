@@ -0,0 +1,201 @@
+package packager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// verifySignature checks the detached signature of the SHA256SUMS file in the dist directory
+// against the signing keys, the same way Terraform does when installing the provider, and returns
+// the keys to publish in the platform documents. When GPGFingerprint is set, it must identify the
+// key that made the signature.
+func (p *Packager) verifySignature() ([]GpgPublicKey, error) {
+	p.logger.Println("* Verifying SHA256SUMS signature")
+
+	keys := make([]GpgPublicKey, 0, len(p.cfg.SigningKeys))
+	var keyring openpgp.EntityList
+	for _, signingKey := range p.cfg.SigningKeys {
+		key, entities, err := loadSigningKey(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		keyring = append(keyring, entities...)
+	}
+
+	shaSumPath := p.shaSumPath()
+	sigPath := shaSumPath + ".sig"
+
+	shaSums, err := p.readFile(shaSumPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := p.readFile(sigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := checkShaSumsSignature(keyring, shaSums, signature)
+	if err != nil {
+		return nil, &SignatureError{Path: sigPath, Err: err}
+	}
+
+	if p.cfg.GPGFingerprint != "" && !matchesKey(signer, p.cfg.GPGFingerprint) {
+		return nil, &SignatureError{
+			Path: sigPath,
+			Err:  fmt.Errorf("signed by key %X, which does not match GPG fingerprint %s", signer.PrimaryKey.Fingerprint, p.cfg.GPGFingerprint),
+		}
+	}
+
+	return keys, nil
+}
+
+// checkShaSumsSignature verifies the detached signature of a SHA256SUMS file against keyring and
+// returns the signer. GoReleaser writes binary signatures by default, but armored ones are
+// accepted too.
+func checkShaSumsSignature(keyring openpgp.EntityList, shaSums, signature []byte) (*openpgp.Entity, error) {
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+
+	return check(keyring, bytes.NewReader(shaSums), bytes.NewReader(signature), nil)
+}
+
+// loadSigningKey reads the files of key and returns it as published in platform documents,
+// along with the parsed public keys. An explicit KeyID must identify the public key.
+func loadSigningKey(key SigningKey) (GpgPublicKey, openpgp.EntityList, error) {
+	published := GpgPublicKey{
+		KeyId:     key.KeyID,
+		Source:    key.Source,
+		SourceUrl: key.SourceURL,
+	}
+
+	armored, err := os.ReadFile(key.PublicKeyFile)
+	if err != nil {
+		return published, nil, fmt.Errorf("reading '%s' file: %w", key.PublicKeyFile, err)
+	}
+	published.AsciiArmor = normalizeArmor(armored)
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+	if err != nil {
+		return published, nil, &SignatureError{Path: key.PublicKeyFile, Err: fmt.Errorf("parsing public key: %w", err)}
+	}
+	if len(entities) == 0 {
+		return published, nil, &SignatureError{Path: key.PublicKeyFile, Err: errors.New("no public key found")}
+	}
+
+	if key.KeyID == "" {
+		published.KeyId = entities[0].PrimaryKey.KeyIdString()
+	} else if !slices.ContainsFunc(entities, func(entity *openpgp.Entity) bool { return matchesKey(entity, key.KeyID) }) {
+		return published, nil, &SignatureError{Path: key.PublicKeyFile, Err: fmt.Errorf("public key does not match key ID %s", key.KeyID)}
+	}
+
+	if key.TrustSignatureFile != "" {
+		trustSignature, err := os.ReadFile(key.TrustSignatureFile)
+		if err != nil {
+			return published, nil, fmt.Errorf("reading '%s' file: %w", key.TrustSignatureFile, err)
+		}
+		published.TrustSignature = normalizeArmor(trustSignature)
+	}
+
+	return published, entities, nil
+}
+
+// normalizeArmor returns an ASCII-armored block with LF line endings and a single trailing newline.
+func normalizeArmor(data []byte) string {
+	return strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") + "\n"
+}
+
+// signShaSums writes the binary detached signature Terraform expects next to the SHA256SUMS
+// file in the dist directory, using the ASCII-armored private key in GPGPrivateKeyFile. When the
+// file holds several keys, the one matching GPGFingerprint is used.
+func (p *Packager) signShaSums() error {
+	p.logger.Println("* Signing SHA256SUMS")
+
+	armored, err := os.ReadFile(p.cfg.GPGPrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("reading '%s' file: %w", p.cfg.GPGPrivateKeyFile, err)
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armored))
+	if err != nil {
+		return &SignatureError{Path: p.cfg.GPGPrivateKeyFile, Err: fmt.Errorf("parsing private key: %w", err)}
+	}
+
+	var signer *openpgp.Entity
+	for _, entity := range keyring {
+		if entity.PrivateKey != nil && (p.cfg.GPGFingerprint == "" || matchesKey(entity, p.cfg.GPGFingerprint)) {
+			signer = entity
+			break
+		}
+	}
+	if signer == nil {
+		return &SignatureError{Path: p.cfg.GPGPrivateKeyFile, Err: errors.New("no matching private key")}
+	}
+
+	if isEncrypted(signer) {
+		if len(p.cfg.GPGPassphrase) == 0 {
+			return &SignatureError{Path: p.cfg.GPGPrivateKeyFile, Err: errors.New("private key is encrypted and no passphrase was given")}
+		}
+		err = signer.DecryptPrivateKeys(p.cfg.GPGPassphrase)
+		if err != nil {
+			return &SignatureError{Path: p.cfg.GPGPrivateKeyFile, Err: fmt.Errorf("decrypting private key: %w", err)}
+		}
+	}
+
+	shaSums, err := p.readFile(p.shaSumPath())
+	if err != nil {
+		return err
+	}
+
+	var signature bytes.Buffer
+	err = openpgp.DetachSign(&signature, signer, bytes.NewReader(shaSums), nil)
+	if err != nil {
+		return &SignatureError{Path: p.cfg.GPGPrivateKeyFile, Err: err}
+	}
+
+	return p.writeFile(p.shaSumPath()+".sig", signature.Bytes())
+}
+
+// isEncrypted reports whether the primary key or a subkey of entity is protected by a passphrase.
+func isEncrypted(entity *openpgp.Entity) bool {
+	if entity.PrivateKey.Encrypted {
+		return true
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesKey reports whether id is the fingerprint or long key ID of the primary key or of a
+// subkey of entity. Spaces and a 0x prefix are ignored, as printed by gpg.
+func matchesKey(entity *openpgp.Entity, id string) bool {
+	id = strings.ToUpper(strings.ReplaceAll(id, " ", ""))
+	id = strings.TrimPrefix(id, "0X")
+
+	keys := []*packet.PublicKey{entity.PrimaryKey}
+	for _, subkey := range entity.Subkeys {
+		keys = append(keys, subkey.PublicKey)
+	}
+
+	for _, key := range keys {
+		if id == fmt.Sprintf("%X", key.Fingerprint) || id == key.KeyIdString() {
+			return true
+		}
+	}
+
+	return false
+}
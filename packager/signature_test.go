@@ -0,0 +1,520 @@
+package packager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// newTestKey generates a signing key. EdDSA keeps key generation fast.
+func newTestKey(t *testing.T) *openpgp.Entity {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("tfpp test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatalf("Failed to generate GPG key: %v", err)
+	}
+
+	return entity
+}
+
+// writeTestPublicKey writes the ASCII-armored public key of entity to path.
+func writeTestPublicKey(t *testing.T, entity *openpgp.Entity, path string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("Failed to armor GPG key: %v", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("Failed to serialize GPG key: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to armor GPG key: %v", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to create GPG key file: %v", err)
+	}
+}
+
+// writeTestPrivateKey writes the ASCII-armored private keys of entities to path, as a single
+// block like gpg --export-secret-keys, encrypted with passphrase when it is not empty.
+func writeTestPrivateKey(t *testing.T, path, passphrase string, entities ...*openpgp.Entity) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("Failed to armor GPG key: %v", err)
+	}
+	for _, entity := range entities {
+		if passphrase != "" {
+			if err := entity.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+				t.Fatalf("Failed to encrypt GPG key: %v", err)
+			}
+			err = entity.SerializePrivateWithoutSigning(w, nil)
+		} else {
+			err = entity.SerializePrivate(w, nil)
+		}
+		if err != nil {
+			t.Fatalf("Failed to serialize GPG key: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to armor GPG key: %v", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Failed to create GPG private key file: %v", err)
+	}
+}
+
+// writeTestSignature signs the SHA256SUMS file at shaSumPath with entity, as GoReleaser does.
+func writeTestSignature(t *testing.T, entity *openpgp.Entity, shaSumPath string, armored bool) {
+	t.Helper()
+
+	shaSums, err := os.ReadFile(shaSumPath)
+	if err != nil {
+		t.Fatalf("Failed to read SHA256SUMS: %v", err)
+	}
+
+	var sig bytes.Buffer
+	if armored {
+		err = openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(shaSums), nil)
+	} else {
+		err = openpgp.DetachSign(&sig, entity, bytes.NewReader(shaSums), nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign SHA256SUMS: %v", err)
+	}
+
+	if err := os.WriteFile(shaSumPath+".sig", sig.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to create SHA256SUMS signature: %v", err)
+	}
+}
+
+// TestVerifySignature tests the verifySignature method.
+func TestVerifySignature(t *testing.T) {
+	key := newTestKey(t)
+	otherKey := newTestKey(t)
+	fingerprint := fmt.Sprintf("%X", key.PrimaryKey.Fingerprint)
+	keyID := key.PrimaryKey.KeyIdString()
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		signer      *openpgp.Entity
+		armored     bool
+		tamper      bool
+		publicKey   string
+		wantKeyID   string
+		wantErr     bool
+	}{
+		{
+			name:        "binary signature with fingerprint",
+			fingerprint: fingerprint,
+			signer:      key,
+			wantKeyID:   fingerprint,
+		},
+		{
+			name:        "armored signature with long key ID",
+			fingerprint: keyID,
+			signer:      key,
+			armored:     true,
+			wantKeyID:   keyID,
+		},
+		{
+			name:        "fingerprint as printed by gpg",
+			fingerprint: "0x" + strings.ToLower(fingerprint[:20]+" "+fingerprint[20:]),
+			signer:      key,
+			wantKeyID:   "0x" + strings.ToLower(fingerprint[:20]+" "+fingerprint[20:]),
+		},
+		{
+			name:      "key ID derived from the key",
+			signer:    key,
+			wantKeyID: keyID,
+		},
+		{
+			name:        "fingerprint of another key",
+			fingerprint: fmt.Sprintf("%X", otherKey.PrimaryKey.Fingerprint),
+			signer:      key,
+			wantErr:     true,
+		},
+		{
+			name:    "signed by another key",
+			signer:  otherKey,
+			wantErr: true,
+		},
+		{
+			name:    "SHA256SUMS changed after signing",
+			signer:  key,
+			tamper:  true,
+			wantErr: true,
+		},
+		{
+			name:      "invalid public key",
+			signer:    key,
+			publicKey: "-----BEGIN PGP PUBLIC KEY BLOCK-----\ntest key\n-----END PGP PUBLIC KEY BLOCK-----",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := testConfig(tmpDir)
+			cfg.GPGFingerprint = tt.fingerprint
+			cfg.GPGPubKeyFile = filepath.Join(tmpDir, "pubkey.txt")
+			p := newTestPackager(t, cfg)
+
+			shaSumPath := filepath.Join(tmpDir, "terraform-provider-example_1.0.0_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(testShaSum+"  terraform-provider-example_1.0.0_linux_amd64.zip\n"), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+			writeTestSignature(t, tt.signer, shaSumPath, tt.armored)
+			if tt.tamper {
+				if err := os.WriteFile(shaSumPath, []byte("def4560000000000000000000000000000000000000000000000000000000000  terraform-provider-example_1.0.0_linux_amd64.zip\n"), 0644); err != nil {
+					t.Fatalf("Failed to change SHA256SUMS: %v", err)
+				}
+			}
+
+			writeTestPublicKey(t, key, cfg.GPGPubKeyFile)
+			if tt.publicKey != "" {
+				if err := os.WriteFile(cfg.GPGPubKeyFile, []byte(tt.publicKey), 0644); err != nil {
+					t.Fatalf("Failed to create GPG key file: %v", err)
+				}
+			}
+
+			keys, err := p.verifySignature()
+			if tt.wantErr {
+				var sigErr *SignatureError
+				if !errors.As(err, &sigErr) {
+					t.Errorf("verifySignature() error = %v, want *SignatureError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySignature() error = %v", err)
+			}
+			if len(keys) != 1 || keys[0].KeyId != tt.wantKeyID {
+				t.Errorf("verifySignature() = %+v, want key ID %q", keys, tt.wantKeyID)
+			}
+		})
+	}
+}
+
+// TestVerifySignatureKeySet tests verifying and publishing several signing keys.
+func TestVerifySignatureKeySet(t *testing.T) {
+	current := newTestKey(t)
+	next := newTestKey(t)
+	unrelated := newTestKey(t)
+
+	tests := []struct {
+		name        string
+		signer      *openpgp.Entity
+		fingerprint string
+		nextKeyID   string
+		wantErr     bool
+	}{
+		{
+			name:   "signed by the current key",
+			signer: current,
+		},
+		{
+			name:        "signed by the next key",
+			signer:      next,
+			fingerprint: next.PrimaryKey.KeyIdString(),
+		},
+		{
+			name:    "signed by a key outside the set",
+			signer:  unrelated,
+			wantErr: true,
+		},
+		{
+			name:        "fingerprint of a key in the set that did not sign",
+			signer:      current,
+			fingerprint: next.PrimaryKey.KeyIdString(),
+			wantErr:     true,
+		},
+		{
+			name:      "key ID that does not match its public key",
+			signer:    current,
+			nextKeyID: unrelated.PrimaryKey.KeyIdString(),
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := testConfig(tmpDir)
+			cfg.GPGFingerprint = tt.fingerprint
+			cfg.SigningKeys = []SigningKey{
+				{PublicKeyFile: filepath.Join(tmpDir, "current.asc")},
+				{
+					KeyID:              tt.nextKeyID,
+					PublicKeyFile:      filepath.Join(tmpDir, "next.asc"),
+					TrustSignatureFile: filepath.Join(tmpDir, "next.trust.asc"),
+					Source:             "Example Org",
+					SourceURL:          "https://example.com/security",
+				},
+			}
+			p := newTestPackager(t, cfg)
+
+			writeTestPublicKey(t, current, cfg.SigningKeys[0].PublicKeyFile)
+			writeTestPublicKey(t, next, cfg.SigningKeys[1].PublicKeyFile)
+			trustSignature := "-----BEGIN PGP SIGNATURE-----\r\n\r\ntrust\r\n-----END PGP SIGNATURE-----\r\n"
+			if err := os.WriteFile(cfg.SigningKeys[1].TrustSignatureFile, []byte(trustSignature), 0644); err != nil {
+				t.Fatalf("Failed to create trust signature: %v", err)
+			}
+
+			shaSumPath := filepath.Join(tmpDir, "terraform-provider-example_1.0.0_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(testShaSum+"  terraform-provider-example_1.0.0_linux_amd64.zip\n"), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+			writeTestSignature(t, tt.signer, shaSumPath, false)
+
+			keys, err := p.verifySignature()
+			if tt.wantErr {
+				var sigErr *SignatureError
+				if !errors.As(err, &sigErr) {
+					t.Errorf("verifySignature() error = %v, want *SignatureError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifySignature() error = %v", err)
+			}
+
+			if len(keys) != 2 || keys[0].KeyId != current.PrimaryKey.KeyIdString() || keys[1].KeyId != next.PrimaryKey.KeyIdString() {
+				t.Fatalf("verifySignature() = %+v, want the current and next keys", keys)
+			}
+			if keys[0].TrustSignature != "" || keys[0].Source != "" {
+				t.Errorf("current key = %+v, want no trust signature or source", keys[0])
+			}
+			wantTrust := "-----BEGIN PGP SIGNATURE-----\n\ntrust\n-----END PGP SIGNATURE-----\n"
+			if keys[1].TrustSignature != wantTrust || keys[1].Source != "Example Org" || keys[1].SourceUrl != "https://example.com/security" {
+				t.Errorf("next key = %+v", keys[1])
+			}
+			if !strings.HasPrefix(keys[1].AsciiArmor, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+				t.Errorf("next key ascii_armor = %q", keys[1].AsciiArmor)
+			}
+		})
+	}
+}
+
+// TestVerifySignatureMissingFiles tests that a missing key, SHA256SUMS or signature file is an error.
+func TestVerifySignatureMissingFiles(t *testing.T) {
+	key := newTestKey(t)
+
+	for _, missing := range []string{"pubkey.txt", "terraform-provider-example_1.0.0_SHA256SUMS", "terraform-provider-example_1.0.0_SHA256SUMS.sig"} {
+		t.Run(missing, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := testConfig(tmpDir)
+			cfg.GPGFingerprint = ""
+			cfg.GPGPubKeyFile = filepath.Join(tmpDir, "pubkey.txt")
+			p := newTestPackager(t, cfg)
+
+			shaSumPath := filepath.Join(tmpDir, "terraform-provider-example_1.0.0_SHA256SUMS")
+			if err := os.WriteFile(shaSumPath, []byte(testShaSum+"  terraform-provider-example_1.0.0_linux_amd64.zip\n"), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+			writeTestSignature(t, key, shaSumPath, false)
+			writeTestPublicKey(t, key, cfg.GPGPubKeyFile)
+
+			if err := os.Remove(filepath.Join(tmpDir, missing)); err != nil {
+				t.Fatalf("Failed to remove %s: %v", missing, err)
+			}
+
+			_, err := p.verifySignature()
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("verifySignature() error = %v, want os.ErrNotExist", err)
+			}
+		})
+	}
+}
+
+// TestSignShaSums tests the signShaSums method.
+func TestSignShaSums(t *testing.T) {
+	tests := []struct {
+		name          string
+		passphrase    string
+		givePassword  string
+		otherKeyFirst bool
+		fingerprint   func(key, otherKey *openpgp.Entity) string
+		wantErr       bool
+	}{
+		{
+			name: "unencrypted key",
+		},
+		{
+			name:         "encrypted key",
+			passphrase:   "secret",
+			givePassword: "secret",
+		},
+		{
+			name:       "encrypted key without passphrase",
+			passphrase: "secret",
+			wantErr:    true,
+		},
+		{
+			name:         "encrypted key with wrong passphrase",
+			passphrase:   "secret",
+			givePassword: "wrong",
+			wantErr:      true,
+		},
+		{
+			name:          "key selected by fingerprint",
+			otherKeyFirst: true,
+			fingerprint: func(key, _ *openpgp.Entity) string {
+				return fmt.Sprintf("%X", key.PrimaryKey.Fingerprint)
+			},
+		},
+		{
+			name: "no key matches fingerprint",
+			fingerprint: func(_, _ *openpgp.Entity) string {
+				return "1234567890ABCDEF"
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			key := newTestKey(t)
+			otherKey := newTestKey(t)
+
+			cfg := testConfig(tmpDir)
+			cfg.GPGFingerprint = ""
+			if tt.fingerprint != nil {
+				cfg.GPGFingerprint = tt.fingerprint(key, otherKey)
+			}
+			cfg.GPGPubKeyFile = filepath.Join(tmpDir, "pubkey.txt")
+			cfg.GPGPrivateKeyFile = filepath.Join(tmpDir, "private.asc")
+			cfg.GPGPassphrase = []byte(tt.givePassword)
+			p := newTestPackager(t, cfg)
+
+			writeTestPublicKey(t, key, cfg.GPGPubKeyFile)
+			if tt.otherKeyFirst {
+				writeTestPrivateKey(t, cfg.GPGPrivateKeyFile, tt.passphrase, otherKey, key)
+			} else {
+				writeTestPrivateKey(t, cfg.GPGPrivateKeyFile, tt.passphrase, key)
+			}
+
+			if err := os.WriteFile(p.shaSumPath(), []byte(testShaSum+"  terraform-provider-example_1.0.0_linux_amd64.zip\n"), 0644); err != nil {
+				t.Fatalf("Failed to create SHA256SUMS: %v", err)
+			}
+
+			err := p.signShaSums()
+			if tt.wantErr {
+				var sigErr *SignatureError
+				if !errors.As(err, &sigErr) {
+					t.Errorf("signShaSums() error = %v, want *SignatureError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("signShaSums() error = %v", err)
+			}
+
+			signature, err := os.ReadFile(p.shaSumPath() + ".sig")
+			if err != nil {
+				t.Fatalf("Failed to read signature: %v", err)
+			}
+			if bytes.HasPrefix(signature, []byte("-----BEGIN")) {
+				t.Error("signShaSums() wrote an armored signature, want binary")
+			}
+
+			if _, err := p.verifySignature(); err != nil {
+				t.Errorf("verifySignature() error = %v", err)
+			}
+		})
+	}
+}
+
+// TestPackageSignsDist tests packaging a dist that only contains the zips.
+func TestPackageSignsDist(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{
+		"/.well-known/terraform.json": {http.StatusOK, `{"providers.v1": "/v1/providers/"}`},
+	})
+
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	cfg.GPGPrivateKeyFile = "private.asc"
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestPrivateKey(t, cfg.GPGPrivateKeyFile, "", key)
+
+	if err := os.MkdirAll(cfg.DistPath, os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup dist: %v", err)
+	}
+	zipName := "terraform-provider-example_1.0.0_linux_amd64.zip"
+	shasum := writeTestZip(t, filepath.Join(cfg.DistPath, zipName), map[string]string{"terraform-provider-example_v1.0.0": testExecutable(t, "linux_amd64")})
+
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Package() error = %v", err)
+	}
+
+	versionPath := "release/v1/providers/example-org/example/1.0.0/"
+	shaSums, err := os.ReadFile(versionPath + "terraform-provider-example_1.0.0_SHA256SUMS")
+	if err != nil {
+		t.Fatalf("Failed to read published SHA256SUMS: %v", err)
+	}
+	if want := shasum + "  " + zipName + "\n"; string(shaSums) != want {
+		t.Errorf("SHA256SUMS = %q, want %q", shaSums, want)
+	}
+	if _, err := os.Stat(versionPath + "terraform-provider-example_1.0.0_SHA256SUMS.sig"); err != nil {
+		t.Errorf("Expected signature: %v", err)
+	}
+}
+
+// TestPackageInvalidSignature tests that nothing is written when the signature does not verify.
+func TestPackageInvalidSignature(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+
+	cfg := testConfig("dist")
+	cfg.GPGFingerprint = ""
+	p := newTestPackager(t, cfg)
+
+	writeTestDist(t, cfg.DistPath, "linux_amd64")
+	writeTestSignature(t, newTestKey(t), filepath.Join(cfg.DistPath, "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+	writeTestPublicKey(t, newTestKey(t), "pubkey.txt")
+
+	published := filepath.Join("release", "v1", "providers", "example-org", "example", "versions")
+	if err := os.MkdirAll(filepath.Dir(published), os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
+	}
+	if err := os.WriteFile(published, []byte(`{"versions": []}`), 0644); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
+	}
+
+	err := p.Package(context.Background())
+	var sigErr *SignatureError
+	if !errors.As(err, &sigErr) {
+		t.Fatalf("Package() error = %v, want *SignatureError", err)
+	}
+
+	if _, err := os.Stat(published); err != nil {
+		t.Errorf("Package() modified the output directory: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package packager
+
+// Platform is an OS and architecture pair listed for a version in the registry versions file.
+type Platform struct {
+	Os   string `json:"os"`
+	Arch string `json:"arch"`
+}
+
+// Version is a single entry of the registry versions file.
+type Version struct {
+	Version   string     `json:"version"`
+	Protocols []string   `json:"protocols"`
+	Platforms []Platform `json:"platforms"`
+}
+
+// Versions is the document served at <providers.v1>/<namespace>/<type>/versions.
+type Versions struct {
+	Versions []Version `json:"versions"`
+}
+
+// WellKnown is the service discovery document served at /.well-known/terraform.json.
+type WellKnown struct {
+	ProvidersV1 string   `json:"providers.v1"`
+	ModulesV1   string   `json:"modules.v1"`
+	LoginV1     *LoginV1 `json:"login.v1,omitempty"`
+}
+
+// LoginV1 is the login.v1 service of WellKnown, the OAuth 2.0 client configuration "terraform
+// login" obtains an API token with.
+type LoginV1 struct {
+	Client     string   `json:"client"`
+	GrantTypes []string `json:"grant_types,omitempty"`
+	Authz      string   `json:"authz,omitempty"`
+	Token      string   `json:"token"`
+	Ports      []int    `json:"ports,omitempty"`
+}
+
+// service returns the base path of the named service, "providers.v1" or "modules.v1".
+func (w WellKnown) service(name string) string {
+	switch name {
+	case "providers.v1":
+		return w.ProvidersV1
+	case "modules.v1":
+		return w.ModulesV1
+	}
+	return ""
+}
+
+// DefaultWellKnown is used when the registry domain does not serve a service discovery document yet.
+var DefaultWellKnown = WellKnown{
+	ProvidersV1: "/v1/providers/",
+	ModulesV1:   "/v1/modules/",
+}
+
+// Architecture is the platform document served at <version>/download/<os>/<arch>.
+type Architecture struct {
+	Protocols           []string    `json:"protocols"`
+	Os                  string      `json:"os"`
+	Arch                string      `json:"arch"`
+	Filename            string      `json:"filename"`
+	DownloadUrl         string      `json:"download_url"`
+	ShasumsUrl          string      `json:"shasums_url"`
+	ShasumsSignatureUrl string      `json:"shasums_signature_url"`
+	Shasum              string      `json:"shasum"`
+	SigningKeys         SigningKeys `json:"signing_keys"`
+}
+
+// SigningKeys lists the keys Terraform accepts the SHA256SUMS signature from.
+type SigningKeys struct {
+	GpgPublicKeys []GpgPublicKey `json:"gpg_public_keys"`
+}
+
+// GpgPublicKey is a signing key of a platform document. TrustSignature is the ASCII-armored
+// signature of the key by a trusted (partner) key, Source and SourceUrl identify its owner.
+type GpgPublicKey struct {
+	KeyId          string `json:"key_id"`
+	AsciiArmor     string `json:"ascii_armor"`
+	TrustSignature string `json:"trust_signature"`
+	Source         string `json:"source"`
+	SourceUrl      string `json:"source_url"`
+}
+
+// ModuleVersions is the document served at <modules.v1>/<namespace>/<name>/<system>/versions.
+type ModuleVersions struct {
+	Modules []ModuleVersionList `json:"modules"`
+}
+
+// ModuleVersionList lists the versions of a module in ModuleVersions.
+type ModuleVersionList struct {
+	Versions []ModuleVersion `json:"versions"`
+}
+
+// ModuleVersion is a single entry of ModuleVersionList.
+type ModuleVersion struct {
+	Version string `json:"version"`
+}
+
+// ModuleDownload is the document served at <modules.v1>/<namespace>/<name>/<system>/<version>/download.
+// Terraform reads the location of the module archive from it when the response has no
+// X-Terraform-Get header, which a static file host cannot set.
+type ModuleDownload struct {
+	Location string `json:"location"`
+}
+
+// MirrorIndex is the network mirror document served at <hostname>/<namespace>/<type>/index.json.
+type MirrorIndex struct {
+	Versions map[string]struct{} `json:"versions"`
+}
+
+// MirrorVersion is the network mirror document served at <hostname>/<namespace>/<type>/<version>.json.
+type MirrorVersion struct {
+	Archives map[string]MirrorArchive `json:"archives"`
+}
+
+// MirrorArchive is a platform entry of MirrorVersion, keyed by <os>_<arch>. URL is resolved
+// relative to the <version>.json document.
+type MirrorArchive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// VersionHashes is the sidecar document written to <version>/hashes.json with the lock file
+// hashes of every platform of a version.
+type VersionHashes struct {
+	Version   string                    `json:"version"`
+	Platforms map[string]PlatformHashes `json:"platforms"`
+}
+
+// PlatformHashes are the lock file hashes of a platform zip, keyed by <os>_<arch> in VersionHashes.
+type PlatformHashes struct {
+	Filename string `json:"filename"`
+	H1       string `json:"h1"`
+	ZH       string `json:"zh"`
+}
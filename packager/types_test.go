@@ -0,0 +1,166 @@
+package packager
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestPlatformJSON tests Platform struct JSON marshalling.
+func TestPlatformJSON(t *testing.T) {
+	platform := Platform{
+		Os:   "linux",
+		Arch: "amd64",
+	}
+
+	data, err := json.Marshal(platform)
+	if err != nil {
+		t.Fatalf("Failed to marshal Platform: %v", err)
+	}
+
+	var decoded Platform
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal Platform: %v", err)
+	}
+
+	if decoded.Os != platform.Os || decoded.Arch != platform.Arch {
+		t.Errorf("Platform mismatch after marshal/unmarshal. Got %+v, want %+v", decoded, platform)
+	}
+}
+
+// TestVersionJSON tests Version struct JSON marshalling.
+func TestVersionJSON(t *testing.T) {
+	version := Version{
+		Version:   "1.0.0",
+		Protocols: []string{"4.0", "5.0", "5.1"},
+		Platforms: []Platform{
+			{Os: "linux", Arch: "amd64"},
+			{Os: "darwin", Arch: "amd64"},
+		},
+	}
+
+	data, err := json.Marshal(version)
+	if err != nil {
+		t.Fatalf("Failed to marshal Version: %v", err)
+	}
+
+	var decoded Version
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal Version: %v", err)
+	}
+
+	if decoded.Version != version.Version {
+		t.Errorf("Version mismatch. Got %v, want %v", decoded.Version, version.Version)
+	}
+	if len(decoded.Protocols) != len(version.Protocols) {
+		t.Errorf("Protocols length mismatch. Got %d, want %d", len(decoded.Protocols), len(version.Protocols))
+	}
+	if len(decoded.Platforms) != len(version.Platforms) {
+		t.Errorf("Platforms length mismatch. Got %d, want %d", len(decoded.Platforms), len(version.Platforms))
+	}
+}
+
+// TestVersionsJSON tests Versions struct JSON marshalling.
+func TestVersionsJSON(t *testing.T) {
+	versions := Versions{
+		Versions: []Version{
+			{
+				Version:   "1.0.0",
+				Protocols: []string{"4.0", "5.1"},
+				Platforms: []Platform{{Os: "linux", Arch: "amd64"}},
+			},
+			{
+				Version:   "1.1.0",
+				Protocols: []string{"5.0", "5.1"},
+				Platforms: []Platform{{Os: "darwin", Arch: "arm64"}},
+			},
+		},
+	}
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		t.Fatalf("Failed to marshal Versions: %v", err)
+	}
+
+	var decoded Versions
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal Versions: %v", err)
+	}
+
+	if len(decoded.Versions) != len(versions.Versions) {
+		t.Errorf("Versions length mismatch. Got %d, want %d", len(decoded.Versions), len(versions.Versions))
+	}
+}
+
+// TestWellKnownJSON tests WellKnown struct JSON marshalling.
+func TestWellKnownJSON(t *testing.T) {
+	wellKnown := WellKnown{
+		ProvidersV1: "/v1/providers/",
+		ModulesV1:   "/v1/modules/",
+	}
+
+	data, err := json.Marshal(wellKnown)
+	if err != nil {
+		t.Fatalf("Failed to marshal WellKnown: %v", err)
+	}
+
+	var decoded WellKnown
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal WellKnown: %v", err)
+	}
+
+	if decoded.ProvidersV1 != wellKnown.ProvidersV1 || decoded.ModulesV1 != wellKnown.ModulesV1 {
+		t.Errorf("WellKnown mismatch. Got %+v, want %+v", decoded, wellKnown)
+	}
+}
+
+// TestArchitectureJSON tests Architecture struct JSON marshalling.
+func TestArchitectureJSON(t *testing.T) {
+	architecture := Architecture{
+		Protocols:           []string{"4.0", "5.1"},
+		Os:                  "linux",
+		Arch:                "amd64",
+		Filename:            "terraform-provider-example_1.0.0_linux_amd64.zip",
+		DownloadUrl:         "https://example.com/download/terraform-provider-example_1.0.0_linux_amd64.zip",
+		ShasumsUrl:          "https://example.com/SHA256SUMS",
+		ShasumsSignatureUrl: "https://example.com/SHA256SUMS.sig",
+		Shasum:              "abc123def456",
+	}
+
+	data, err := json.Marshal(architecture)
+	if err != nil {
+		t.Fatalf("Failed to marshal Architecture: %v", err)
+	}
+
+	var decoded Architecture
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal Architecture: %v", err)
+	}
+
+	if decoded.Os != architecture.Os {
+		t.Errorf("Os mismatch. Got %v, want %v", decoded.Os, architecture.Os)
+	}
+	if decoded.Arch != architecture.Arch {
+		t.Errorf("Arch mismatch. Got %v, want %v", decoded.Arch, architecture.Arch)
+	}
+	if decoded.Filename != architecture.Filename {
+		t.Errorf("Filename mismatch. Got %v, want %v", decoded.Filename, architecture.Filename)
+	}
+	if decoded.Shasum != architecture.Shasum {
+		t.Errorf("Shasum mismatch. Got %v, want %v", decoded.Shasum, architecture.Shasum)
+	}
+}
+
+// TestDefaultWellKnown tests the default well-known data.
+func TestDefaultWellKnown(t *testing.T) {
+	if DefaultWellKnown.ProvidersV1 != "/v1/providers/" {
+		t.Errorf("ProvidersV1 = %v, want /v1/providers/", DefaultWellKnown.ProvidersV1)
+	}
+	if DefaultWellKnown.ModulesV1 != "/v1/modules/" {
+		t.Errorf("ModulesV1 = %v, want /v1/modules/", DefaultWellKnown.ModulesV1)
+	}
+}
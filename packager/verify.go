@@ -0,0 +1,411 @@
+package packager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Problem is an inconsistency of a release that would make "terraform init" fail.
+type Problem struct {
+	// Provider is the <namespace>/<type> address of the provider, Version and Platform (<os>_<arch>)
+	// the release concerned, when known.
+	Provider string `json:"provider,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	// Path is the document or file concerned, as a path of the tree or a URL.
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	var where []string
+	for _, s := range []string{p.Provider, p.Version, p.Platform} {
+		if s != "" {
+			where = append(where, s)
+		}
+	}
+	if p.Path != "" {
+		where = append(where, p.Path)
+	}
+	if len(where) == 0 {
+		return p.Message
+	}
+
+	return strings.Join(where, " ") + ": " + p.Message
+}
+
+// releaseSource reads the documents and files of a release tree. References are URLs, or URL paths
+// for a tree on disk.
+type releaseSource interface {
+	open(ctx context.Context, ref string) (io.ReadCloser, error)
+}
+
+// dirSource reads a release tree on disk. Only the path of a URL is used, so that documents
+// packaged for any domain resolve to files of the tree.
+type dirSource struct {
+	root string
+}
+
+func (d dirSource) open(_ context.Context, ref string) (io.ReadCloser, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filepath.Join(d.root, filepath.FromSlash(path.Clean("/"+u.Path))))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+// verifier checks the releases of a source and collects the problems found.
+type verifier struct {
+	src      releaseSource
+	problems []Problem
+	// platforms are the results of the platforms checked, with their share of the problems.
+	platforms []PlatformResult
+
+	// shaSums caches the SHA256SUMS files by URL.
+	shaSums map[string]shaSumsFile
+	// signatures caches the signature problems by SHA256SUMS, signature and key references.
+	signatures map[string]string
+}
+
+func newVerifier(src releaseSource) *verifier {
+	return &verifier{
+		src:        src,
+		shaSums:    map[string]shaSumsFile{},
+		signatures: map[string]string{},
+	}
+}
+
+func (v *verifier) report(p Problem) {
+	v.problems = append(v.problems, p)
+}
+
+// readJSON decodes the document at ref into v, reporting missing and invalid documents.
+func (v *verifier) readJSON(ctx context.Context, ref string, problem Problem, doc any) bool {
+	r, err := v.src.open(ctx, ref)
+	if err != nil {
+		problem.Message = describeFetchError(err)
+		v.report(problem)
+		return false
+	}
+	defer r.Close()
+
+	err = json.NewDecoder(r).Decode(doc)
+	if err != nil {
+		problem.Message = fmt.Sprintf("invalid JSON: %v", err)
+		v.report(problem)
+		return false
+	}
+
+	return true
+}
+
+func describeFetchError(err error) string {
+	if errors.Is(err, ErrNotFound) {
+		return "not found"
+	}
+	return err.Error()
+}
+
+// Verify checks every provider version of the release tree in root the way "terraform init"
+// would: each platform of the versions files must have a platform document, whose download,
+// SHA256SUMS and signature URLs resolve to files of the tree, the zip must match the shasum of
+// the document and of the SHA256SUMS file, and the SHA256SUMS signature must verify against the
+// signing keys of the document. The error is only set when the tree cannot be read at all.
+func Verify(ctx context.Context, root string) ([]Problem, error) {
+	v := newVerifier(dirSource{root: root})
+
+	wellKnownData := DefaultWellKnown
+	ok, err := readJSONFile(filepath.Join(root, ".well-known", "terraform.json"), &wellKnownData)
+	switch {
+	case err != nil:
+		v.report(Problem{Path: "/.well-known/terraform.json", Message: err.Error()})
+	case !ok:
+		v.report(Problem{Path: "/.well-known/terraform.json", Message: "not found, service discovery will fail"})
+	case wellKnownData.ProvidersV1 == "":
+		v.report(Problem{Path: "/.well-known/terraform.json", Message: "does not advertise providers.v1"})
+		return v.problems, nil
+	}
+
+	providersV1 := "/" + strings.Trim(wellKnownData.ProvidersV1, "/") + "/"
+	providersDir := filepath.Join(root, filepath.FromSlash(providersV1))
+
+	namespaces, err := os.ReadDir(providersDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		v.report(Problem{Path: providersV1, Message: "no providers"})
+		return v.problems, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, namespace := range namespaces {
+		if !namespace.IsDir() {
+			continue
+		}
+		types, err := os.ReadDir(filepath.Join(providersDir, namespace.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, providerType := range types {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !providerType.IsDir() {
+				continue
+			}
+			v.verifyProvider(ctx, providersV1+namespace.Name()+"/"+providerType.Name()+"/", namespace.Name()+"/"+providerType.Name())
+		}
+	}
+
+	return v.problems, nil
+}
+
+// verifyProvider checks every platform of the versions file of the provider at providerURL.
+func (v *verifier) verifyProvider(ctx context.Context, providerURL, provider string) {
+	var versions Versions
+	if !v.readJSON(ctx, providerURL+"versions", Problem{Provider: provider, Path: providerURL + "versions"}, &versions) {
+		return
+	}
+
+	for _, version := range versions.Versions {
+		if len(version.Platforms) == 0 {
+			v.report(Problem{Provider: provider, Version: version.Version, Path: providerURL + "versions", Message: "no platforms"})
+		}
+		for _, platform := range version.Platforms {
+			if ctx.Err() != nil {
+				return
+			}
+			docURL := fmt.Sprintf("%s%s/download/%s/%s", providerURL, version.Version, platform.Os, platform.Arch)
+			start := len(v.problems)
+			v.verifyPlatform(ctx, docURL, provider, version, platform)
+			v.platforms = append(v.platforms, PlatformResult{
+				Version:  version.Version,
+				Platform: platform.Os + "_" + platform.Arch,
+				Problems: slices.Clone(v.problems[start:]),
+			})
+		}
+	}
+}
+
+// verifyPlatform checks the platform document at docURL and the files it references.
+func (v *verifier) verifyPlatform(ctx context.Context, docURL, provider string, version Version, platform Platform) {
+	problem := Problem{Provider: provider, Version: version.Version, Platform: platform.Os + "_" + platform.Arch, Path: docURL}
+	report := func(ref, format string, args ...any) {
+		p := problem
+		p.Path = ref
+		p.Message = fmt.Sprintf(format, args...)
+		v.report(p)
+	}
+
+	var architecture Architecture
+	if !v.readJSON(ctx, docURL, problem, &architecture) {
+		return
+	}
+
+	if architecture.Os != platform.Os || architecture.Arch != platform.Arch {
+		report(docURL, "platform document is for %s_%s", architecture.Os, architecture.Arch)
+	}
+	if len(version.Protocols) > 0 && !slices.Equal(architecture.Protocols, version.Protocols) {
+		report(docURL, "protocols %v differ from %v in the versions file", architecture.Protocols, version.Protocols)
+	}
+	if architecture.Filename == "" || architecture.Shasum == "" {
+		report(docURL, "filename or shasum is missing")
+		return
+	}
+
+	refs := []struct {
+		name string
+		ref  *string
+	}{
+		{"download_url", &architecture.DownloadUrl},
+		{"shasums_url", &architecture.ShasumsUrl},
+		{"shasums_signature_url", &architecture.ShasumsSignatureUrl},
+	}
+	for _, r := range refs {
+		resolved, err := resolveRef(docURL, *r.ref)
+		if err != nil || *r.ref == "" {
+			report(docURL, "invalid %s %q", r.name, *r.ref)
+			return
+		}
+		*r.ref = resolved
+	}
+
+	sum, err := v.hash(ctx, architecture.DownloadUrl)
+	if err != nil {
+		report(architecture.DownloadUrl, "%s", describeFetchError(err))
+	} else if sum != architecture.Shasum {
+		report(architecture.DownloadUrl, "SHA256 %s does not match shasum %s", sum, architecture.Shasum)
+	}
+
+	shaSums := v.readShaSums(ctx, architecture.ShasumsUrl, problem)
+	if shaSums != nil {
+		listed, ok := shaSums[architecture.Filename]
+		switch {
+		case !ok:
+			report(architecture.ShasumsUrl, "no entry for %s", architecture.Filename)
+		case listed != architecture.Shasum:
+			report(architecture.ShasumsUrl, "SHA256 %s of %s does not match shasum %s", listed, architecture.Filename, architecture.Shasum)
+		}
+	}
+
+	if message := v.checkSignature(ctx, architecture); message != "" {
+		report(architecture.ShasumsSignatureUrl, "%s", message)
+	}
+}
+
+// resolveRef resolves ref, absolute or relative to the document at base.
+func resolveRef(base, ref string) (string, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return baseURL.ResolveReference(refURL).String(), nil
+}
+
+// hash returns the hex encoded SHA256 of the file at ref.
+func (v *verifier) hash(ctx context.Context, ref string) (string, error) {
+	r, err := v.src.open(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// shaSumsFile is the parsed content of a SHA256SUMS file, or the error reading it.
+type shaSumsFile struct {
+	entries map[string]string
+	err     error
+}
+
+// readShaSums returns the entries of the SHA256SUMS file at ref, reporting it for every platform
+// when it cannot be read or parsed.
+func (v *verifier) readShaSums(ctx context.Context, ref string, problem Problem) map[string]string {
+	file, ok := v.shaSums[ref]
+	if !ok {
+		file = v.parseShaSums(ctx, ref)
+		v.shaSums[ref] = file
+	}
+
+	if file.err != nil {
+		problem.Path = ref
+		problem.Message = describeFetchError(file.err)
+		v.report(problem)
+		return nil
+	}
+
+	return file.entries
+}
+
+// parseShaSums reads and parses the SHA256SUMS file at ref. Its file names are not checked
+// against the <repo>_<version>_ prefix, as the repository name is not part of the tree.
+func (v *verifier) parseShaSums(ctx context.Context, ref string) shaSumsFile {
+	data, err := v.readAll(ctx, ref)
+	if err != nil {
+		return shaSumsFile{err: err}
+	}
+
+	entries, err := parseShaSums(data, "")
+	if err != nil {
+		return shaSumsFile{err: err}
+	}
+
+	file := shaSumsFile{entries: map[string]string{}}
+	for _, entry := range entries {
+		file.entries[entry.name] = entry.sum
+	}
+
+	return file
+}
+
+// checkSignature verifies the SHA256SUMS signature of a platform document against its signing
+// keys and returns the problem, empty when it verifies. Results are cached, as all the platforms
+// of a version share them.
+func (v *verifier) checkSignature(ctx context.Context, architecture Architecture) string {
+	var keys []string
+	for _, key := range architecture.SigningKeys.GpgPublicKeys {
+		keys = append(keys, key.AsciiArmor)
+	}
+	cacheKey := architecture.ShasumsUrl + "\n" + architecture.ShasumsSignatureUrl + "\n" + strings.Join(keys, "\n")
+	if message, ok := v.signatures[cacheKey]; ok {
+		return message
+	}
+
+	message := v.signatureProblem(ctx, architecture)
+	v.signatures[cacheKey] = message
+
+	return message
+}
+
+func (v *verifier) signatureProblem(ctx context.Context, architecture Architecture) string {
+	if len(architecture.SigningKeys.GpgPublicKeys) == 0 {
+		return "no signing keys in the platform document"
+	}
+
+	var keyring openpgp.EntityList
+	for _, key := range architecture.SigningKeys.GpgPublicKeys {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.AsciiArmor))
+		if err != nil {
+			return fmt.Sprintf("invalid signing key %s: %v", key.KeyId, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+
+	shaSums, err := v.readAll(ctx, architecture.ShasumsUrl)
+	if err != nil {
+		return "SHA256SUMS: " + describeFetchError(err)
+	}
+	signature, err := v.readAll(ctx, architecture.ShasumsSignatureUrl)
+	if err != nil {
+		return describeFetchError(err)
+	}
+
+	_, err = checkShaSumsSignature(keyring, shaSums, signature)
+	if err != nil {
+		return fmt.Sprintf("signature does not verify against the signing keys: %v", err)
+	}
+
+	return ""
+}
+
+func (v *verifier) readAll(ctx context.Context, ref string) ([]byte, error) {
+	r, err := v.src.open(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,156 @@
+package packager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestRelease packages a signed linux_amd64 and darwin_arm64 release into "release" in the
+// current directory, for a new registry.
+func writeTestRelease(t *testing.T) Config {
+	t.Helper()
+
+	key := newTestKey(t)
+	writeTestPublicKey(t, key, "pubkey.txt")
+	writeTestDist(t, "dist", "linux_amd64", "darwin_arm64")
+	writeTestSignature(t, key, filepath.Join("dist", "terraform-provider-example_1.0.0_SHA256SUMS"), false)
+
+	domain, client := newTestRegistry(t, map[string]testResponse{})
+	cfg := testConfig("dist")
+	cfg.Domain = domain
+	cfg.GPGFingerprint = ""
+	p := newTestPackager(t, cfg, WithHTTPClient(client), WithAllowNew(true))
+	if err := p.Package(context.Background()); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
+	}
+
+	return cfg
+}
+
+// TestVerify tests that Verify reports the problems of a release tree.
+func TestVerify(t *testing.T) {
+	versionDir := "release/v1/providers/example-org/example/1.0.0"
+	linuxDoc := versionDir + "/download/linux/amd64"
+
+	tests := []struct {
+		name         string
+		mutate       func(t *testing.T)
+		wantProblems []string
+	}{
+		{
+			name:   "valid release",
+			mutate: func(*testing.T) {},
+		},
+		{
+			name: "corrupted zip",
+			mutate: func(t *testing.T) {
+				writeTestTree(t, versionDir, map[string]string{"download/terraform-provider-example_1.0.0_linux_amd64.zip": "corrupted"})
+			},
+			wantProblems: []string{"linux_amd64 https://registry.example.com/v1/providers/example-org/example/1.0.0/download/terraform-provider-example_1.0.0_linux_amd64.zip: SHA256"},
+		},
+		{
+			name: "missing platform document",
+			mutate: func(t *testing.T) {
+				if err := os.Remove(linuxDoc); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantProblems: []string{"linux_amd64 /v1/providers/example-org/example/1.0.0/download/linux/amd64: not found"},
+		},
+		{
+			name: "missing signature",
+			mutate: func(t *testing.T) {
+				if err := os.Remove(versionDir + "/terraform-provider-example_1.0.0_SHA256SUMS.sig"); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantProblems: []string{"linux_amd64 https://registry.example.com/v1/providers/example-org/example/1.0.0/terraform-provider-example_1.0.0_SHA256SUMS.sig: not found", "darwin_arm64"},
+		},
+		{
+			name: "missing SHA256SUMS",
+			mutate: func(t *testing.T) {
+				if err := os.Remove(versionDir + "/terraform-provider-example_1.0.0_SHA256SUMS"); err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+			},
+			wantProblems: []string{"linux_amd64 https://registry.example.com/v1/providers/example-org/example/1.0.0/terraform-provider-example_1.0.0_SHA256SUMS: not found", "SHA256SUMS: not found", "darwin_arm64", "SHA256SUMS: not found"},
+		},
+		{
+			name: "signature by another key",
+			mutate: func(t *testing.T) {
+				writeTestSignature(t, newTestKey(t), versionDir+"/terraform-provider-example_1.0.0_SHA256SUMS", false)
+			},
+			wantProblems: []string{"signature does not verify", "signature does not verify"},
+		},
+		{
+			name: "SHA256SUMS without the zip",
+			mutate: func(t *testing.T) {
+				writeTestTree(t, versionDir, map[string]string{"terraform-provider-example_1.0.0_SHA256SUMS": testShaSum + "  other.zip\n"})
+			},
+			wantProblems: []string{"no entry for terraform-provider-example_1.0.0_linux_amd64.zip", "signature does not verify", "no entry for terraform-provider-example_1.0.0_darwin_arm64.zip", "signature does not verify"},
+		},
+		{
+			name: "platform document of another platform",
+			mutate: func(t *testing.T) {
+				data, err := os.ReadFile(linuxDoc)
+				if err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+				writeTestTree(t, ".", map[string]string{linuxDoc: strings.Replace(string(data), `"arch": "amd64"`, `"arch": "arm64"`, 1)})
+			},
+			wantProblems: []string{"platform document is for linux_arm64"},
+		},
+		{
+			name: "invalid versions file",
+			mutate: func(t *testing.T) {
+				writeTestTree(t, ".", map[string]string{"release/v1/providers/example-org/example/versions": "{"})
+			},
+			wantProblems: []string{"example-org/example /v1/providers/example-org/example/versions: invalid JSON"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			cfg := writeTestRelease(t)
+
+			// Documents are packaged for the test registry, Verify must only use the URL paths.
+			for _, doc := range []string{linuxDoc, versionDir + "/download/darwin/arm64"} {
+				data, err := os.ReadFile(doc)
+				if err != nil {
+					t.Fatalf("Failed to setup release: %v", err)
+				}
+				writeTestTree(t, ".", map[string]string{doc: strings.ReplaceAll(string(data), cfg.Domain, "registry.example.com")})
+			}
+			tt.mutate(t)
+
+			problems, err := Verify(context.Background(), "release")
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if len(problems) != len(tt.wantProblems) {
+				t.Fatalf("Verify() = %v, want %d problems", problems, len(tt.wantProblems))
+			}
+			for i, want := range tt.wantProblems {
+				if !strings.Contains(problems[i].String(), want) {
+					t.Errorf("Verify()[%d] = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+// TestVerifyEmptyTree tests the problems of a tree without providers.
+func TestVerifyEmptyTree(t *testing.T) {
+	problems, err := Verify(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(problems) != 2 || problems[0].Path != "/.well-known/terraform.json" || problems[1].Message != "no providers" {
+		t.Errorf("Verify() = %v, want missing well-known and no providers", problems)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/marceloalmeida/tfpp/packager"
+)
+
+// serveFlags are the flags of the serve command that are not packaging settings.
+type serveFlags struct {
+	listen      string
+	selfSigned  bool
+	certFile    string
+	keyFile     string
+	certOutFile string
+	pkg         bool
+	tokenFile   string
+	login       bool
+}
+
+func (f *serveFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.listen, "listen", "localhost:8443", "Address to listen on.")
+	flags.BoolVar(&f.selfSigned, "tls", false, "Serve HTTPS with a self-signed certificate, as Terraform requires for service discovery.")
+	flags.StringVar(&f.certFile, "tls-cert", "", "Serve HTTPS with this PEM certificate file, along with -tls-key.")
+	flags.StringVar(&f.keyFile, "tls-key", "", "PEM private key file of -tls-cert.")
+	flags.StringVar(&f.certOutFile, "tls-cert-out", "tfpp-serve.pem", "Where to write the self-signed certificate for clients to trust, e.g. with SSL_CERT_FILE.")
+	flags.StringVar(&f.tokenFile, "tokens", "", "YAML or JSON file mapping bearer tokens to the namespaces they give access to. The registry is public without it.")
+	flags.BoolVar(&f.login, "login", false, "Advertise a login.v1 service so that terraform login can store a token of -tokens.")
+	flags.BoolVar(&f.pkg, "package", false, "Package the provider version from the dist directory into the served tree before serving it.")
+}
+
+func runServe(ctx context.Context, args []string) error {
+	var f serveFlags
+	s, err := loadSettings("tfpp serve", args, f.register)
+	if err != nil {
+		return err
+	}
+
+	server, err := prepareServe(ctx, s, f)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := serveTLSConfig(s, f)
+	if err != nil {
+		return fmt.Errorf("configuring TLS: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", f.listen)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Handler:           server,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = httpServer.Shutdown(context.Background())
+	})
+	defer stop()
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	log.Printf("🌐 Serving %s on %s://%s", serveRoot(s), scheme, listener.Addr())
+
+	if tlsConfig != nil {
+		err = httpServer.ServeTLS(listener, "", "")
+	} else {
+		err = httpServer.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// serveRoot returns the release tree served, the output directory of the packaging commands.
+func serveRoot(s settings) string {
+	if s.Output == "" {
+		return "release"
+	}
+	return s.Output
+}
+
+// serveDomain returns the registry domain of the served tree, the listen address when none is set.
+func serveDomain(s settings, f serveFlags) string {
+	if s.Domain != "" {
+		return s.Domain
+	}
+
+	host, port, err := net.SplitHostPort(f.listen)
+	if err != nil {
+		return f.listen
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// prepareServe returns the Server for the settings, after packaging the provider version into its
+// tree when -package is set. Packaging merges into the served tree, as if it were the registry.
+func prepareServe(ctx context.Context, s settings, f serveFlags) (*packager.Server, error) {
+	s.Domain = serveDomain(s, f)
+	s.Output = serveRoot(s)
+
+	serverCfg := packager.ServerConfig{Root: s.Output, Domain: s.Domain, Login: f.login}
+	if f.tokenFile == "" {
+		f.tokenFile = s.TokenFile
+	}
+	if f.tokenFile != "" {
+		tokens, err := packager.LoadTokenACL(f.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		serverCfg.Tokens = tokens
+	}
+
+	server, err := packager.NewServer(serverCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if !f.pkg {
+		return server, nil
+	}
+
+	log.Println("📦 Packaging Terraform Provider into the served tree...")
+
+	cfg, opts := s.packagerConfig()
+	cfg.Incremental = true
+	opts = append(opts, packager.WithHTTPClient(&http.Client{Transport: server.Transport()}), packager.WithAllowNew(true))
+
+	p, err := packager.New(cfg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	err = p.Package(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("packaging provider: %w", err)
+	}
+
+	return server, nil
+}
+
+// serveTLSConfig returns the TLS configuration of the serve flags, nil for plain HTTP. The
+// self-signed certificate covers the loopback addresses, the listen host and the registry domain.
+func serveTLSConfig(s settings, f serveFlags) (*tls.Config, error) {
+	switch {
+	case f.certFile != "" || f.keyFile != "":
+		cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	case !f.selfSigned:
+		return nil, nil
+	}
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	for _, address := range []string{f.listen, serveDomain(s, f)} {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		hosts = append(hosts, host)
+	}
+
+	cert, certPEM, err := packager.SelfSignedCertificate(hosts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(f.certOutFile, certPEM, 0644)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Wrote self-signed certificate to %s, trust it with SSL_CERT_FILE=%s", f.certOutFile, f.certOutFile)
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
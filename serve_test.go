@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestServeDomain tests the registry domain of the served tree.
+func TestServeDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		domain string
+		listen string
+		want   string
+	}{
+		{"configured domain", "registry.example.com", "localhost:8443", "registry.example.com"},
+		{"listen address", "", "127.0.0.1:8443", "127.0.0.1:8443"},
+		{"any interface", "", ":8443", "localhost:8443"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := serveDomain(settings{Domain: tt.domain}, serveFlags{listen: tt.listen})
+			if got != tt.want {
+				t.Errorf("serveDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServeTLSConfig tests the TLS modes of the serve command.
+func TestServeTLSConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	tlsConfig, err := serveTLSConfig(settings{}, serveFlags{listen: "localhost:8443"})
+	if err != nil || tlsConfig != nil {
+		t.Errorf("serveTLSConfig() without TLS = %v, %v, want nil", tlsConfig, err)
+	}
+
+	f := serveFlags{listen: "localhost:8443", selfSigned: true, certOutFile: "ca.pem"}
+	tlsConfig, err = serveTLSConfig(settings{Domain: "registry.internal:8443"}, f)
+	if err != nil || tlsConfig == nil || len(tlsConfig.Certificates) != 1 {
+		t.Fatalf("serveTLSConfig() self-signed = %v, %v", tlsConfig, err)
+	}
+	cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if err := cert.VerifyHostname("registry.internal"); err != nil {
+		t.Errorf("certificate does not cover the domain: %v", err)
+	}
+	if _, err := os.Stat("ca.pem"); err != nil {
+		t.Errorf("self-signed certificate was not written: %v", err)
+	}
+
+	f = serveFlags{listen: "localhost:8443", certFile: "missing.pem", keyFile: "missing-key.pem"}
+	if _, err := serveTLSConfig(settings{}, f); err == nil {
+		t.Error("serveTLSConfig() with missing certificate error = nil, want error")
+	}
+}
+
+// TestPrepareServe tests that the served tree is the output directory and that its URLs are
+// rewritten to the request host.
+func TestPrepareServe(t *testing.T) {
+	root := t.TempDir()
+	document := filepath.Join(root, "v1/modules/example-org/network/aws/1.0.0/download")
+	if err := os.MkdirAll(filepath.Dir(document), os.ModePerm); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
+	}
+	location := `{"location": "https://localhost:8443/v1/modules/example-org/network/aws/1.0.0/network-aws-1.0.0.tar.gz"}`
+	if err := os.WriteFile(document, []byte(location), 0644); err != nil {
+		t.Fatalf("Failed to setup release: %v", err)
+	}
+
+	server, err := prepareServe(context.Background(), settings{Output: root}, serveFlags{listen: "localhost:8443"})
+	if err != nil {
+		t.Fatalf("prepareServe() error = %v", err)
+	}
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/v1/modules/example-org/network/aws/1.0.0/download")
+	if err != nil {
+		t.Fatalf("GET download error = %v", err)
+	}
+	resp.Body.Close()
+
+	if got := resp.Header.Get("X-Terraform-Get"); !strings.HasPrefix(got, ts.URL+"/v1/modules/") {
+		t.Errorf("X-Terraform-Get = %q, want it served by %s", got, ts.URL)
+	}
+}
+
+// TestRunServe tests that the serve command stops when its context is done.
+func TestRunServe(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := run(ctx, []string{"serve", "-listen", "127.0.0.1:0"}); err != nil {
+		t.Errorf("run() error = %v", err)
+	}
+}
+
+// TestPrepareServeTokens tests that the token file of the config file protects the served tree.
+func TestPrepareServeTokens(t *testing.T) {
+	root := t.TempDir()
+	tokenFile := filepath.Join(t.TempDir(), "tokens.yaml")
+	if err := os.WriteFile(tokenFile, []byte("team-token: [example-org]\n"), 0600); err != nil {
+		t.Fatalf("Failed to setup token file: %v", err)
+	}
+
+	server, err := prepareServe(context.Background(), settings{Output: root, TokenFile: tokenFile}, serveFlags{listen: "localhost:8443", login: true})
+	if err != nil {
+		t.Fatalf("prepareServe() error = %v", err)
+	}
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/v1/providers/example-org/example/versions")
+	if err != nil {
+		t.Fatalf("GET versions error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET versions without token status = %d, want 401", resp.StatusCode)
+	}
+
+	if _, err := prepareServe(context.Background(), settings{Output: root}, serveFlags{listen: "localhost:8443", login: true}); err == nil {
+		t.Error("prepareServe() with -login and no token file error = nil, want error")
+	}
+}